@@ -4,14 +4,17 @@ package azugo
 import (
 	"context"
 	"crypto/rand"
+	"crypto/x509"
 	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
-	"time"
 
 	"azugo.io/azugo/config"
 
 	"azugo.io/core"
-	"azugo.io/core/cert"
 	"azugo.io/core/http"
 	"github.com/lafriks/http2"
 	"github.com/oklog/ulid/v2"
@@ -28,6 +31,7 @@ type App struct {
 
 	router     RouteSwitcher
 	defaultMux *mux
+	management *mux
 	entropy    ulid.MonotonicReader
 
 	// Request context pool
@@ -52,9 +56,20 @@ type App struct {
 	ServerOptions ServerOptions
 
 	// Running servers
-	serverLock sync.Mutex
-	server     *fasthttp.Server
-	h2server   *http2.Server
+	serverLock   sync.Mutex
+	server       *fasthttp.Server
+	h2server     *http2.Server
+	mgmtServer   *fasthttp.Server
+	certificates *serverCertificates
+	listeners    []*appListener
+
+	// Background tasks run while the application is running
+	taskLock    sync.Mutex
+	tasks       []func(ctx context.Context)
+	tasksOnce   []func(ctx context.Context)
+	taskRunning sync.WaitGroup
+	taskCtx     context.Context
+	taskCancel  context.CancelFunc
 }
 
 // ServerOptions configures the HTTP server buffer sizes.
@@ -99,11 +114,85 @@ func New(opts ...*core.App) *App {
 	}
 
 	a.defaultMux = newMux(a)
+	a.management = newMux(a)
 	a.router = defaultRouter{App: a}
 
 	return a
 }
 
+// runTask registers function to be run in background every time the application
+// is started until it is stopped. If the application is already running the
+// function is started right away.
+func (a *App) runTask(fn func(ctx context.Context)) {
+	a.taskLock.Lock()
+	defer a.taskLock.Unlock()
+
+	a.tasks = append(a.tasks, fn)
+
+	if a.taskCtx != nil {
+		a.goTask(fn)
+	}
+}
+
+// runTaskOnce runs function in background once. If the application is not running
+// the function is started when the application is started.
+func (a *App) runTaskOnce(fn func(ctx context.Context)) {
+	a.taskLock.Lock()
+	defer a.taskLock.Unlock()
+
+	if a.taskCtx == nil {
+		a.tasksOnce = append(a.tasksOnce, fn)
+
+		return
+	}
+
+	a.goTask(fn)
+}
+
+// goTask starts the function in background. Must be called with the task lock held.
+func (a *App) goTask(fn func(ctx context.Context)) {
+	ctx := a.taskCtx
+
+	a.taskRunning.Go(func() {
+		fn(ctx)
+	})
+}
+
+// startTasks starts registered background tasks with a new context.
+func (a *App) startTasks() {
+	a.taskLock.Lock()
+	defer a.taskLock.Unlock()
+
+	if a.taskCtx != nil {
+		return
+	}
+
+	a.taskCtx, a.taskCancel = context.WithCancel(context.Background())
+
+	for _, fn := range a.tasks {
+		a.goTask(fn)
+	}
+
+	for _, fn := range a.tasksOnce {
+		a.goTask(fn)
+	}
+
+	a.tasksOnce = nil
+}
+
+// stopTasks cancels background tasks and waits for them to finish.
+func (a *App) stopTasks() {
+	a.taskLock.Lock()
+	if a.taskCancel != nil {
+		a.taskCancel()
+	}
+
+	a.taskCtx, a.taskCancel = nil, nil
+	a.taskLock.Unlock()
+
+	a.taskRunning.Wait()
+}
+
 // RouterOptions for default router.
 func (a *App) RouterOptions() *RouterOptions {
 	return a.defaultMux.RouterOptions
@@ -124,6 +213,9 @@ func (a *App) ApplyConfig() {
 
 	// Apply configuration to default server router options.
 	a.RouterOptions().ApplyConfig(conf)
+	// Management server trusts the same proxies but is always served from the root path.
+	a.management.RouterOptions.ApplyConfig(conf)
+	a.management.RouterOptions.BasePath = ""
 
 	// Apply Metrics configuration.
 	if conf.Metrics.Enabled {
@@ -180,8 +272,23 @@ func (a *App) Start() error {
 		return err
 	}
 
+	a.startTasks()
+
 	conf := a.Config().Server
 
+	var (
+		certs *serverCertificates
+		err   error
+	)
+
+	if conf.HTTPS != nil && conf.HTTPS.Enabled {
+		if certs, err = a.loadServerCertificates(&conf.HTTPS.ServerTLS); err != nil {
+			a.Log().Error("failed to load TLS certificate", zap.Error(err))
+
+			return err
+		}
+	}
+
 	server := &fasthttp.Server{
 		NoDefaultServerHeader:        true,
 		Handler:                      a.Handler,
@@ -196,101 +303,231 @@ func (a *App) Start() error {
 		MaxRequestBodySize:           conf.MaxRequestBodySize,
 	}
 
+	if certs != nil {
+		if server.TLSConfig, err = serverTLSConfig(&conf.HTTPS.ServerTLS, certs); err != nil {
+			a.Log().Error("failed to load TLS client CA certificates", zap.Error(err))
+
+			return err
+		}
+	}
+
 	var h2server *http2.Server
 
-	// HTTP2 is supported only over HTTPS
-	if conf.HTTPS != nil && conf.HTTPS.Enabled {
-		h2server = http2.ConfigureServer(server, http2.ServerConfig{
-			PingInterval:         30 * time.Second,
-			MaxConcurrentStreams: 256,
-		})
+	// HTTP2 is supported over HTTPS or cleartext HTTP with prior knowledge
+	if (conf.HTTPS != nil && conf.HTTPS.Enabled) || (conf.HTTP != nil && conf.HTTP.Enabled && conf.HTTP.H2C) {
+		h2server = a.newHTTP2Server(server)
+	}
+
+	var mgmtServer *fasthttp.Server
+	if conf.Management != nil && conf.Management.Enabled {
+		mgmtServer = a.newManagementServer()
+	}
+
+	a.serverLock.Lock()
+	listeners := slices.Clone(a.listeners)
+	a.serverLock.Unlock()
+
+	servers := make([]*listenerServer, len(listeners))
+
+	for i, l := range listeners {
+		if servers[i], err = a.newListenerServer(l); err != nil {
+			a.Log().Error("failed to start listener", zap.String("listener", l.name), zap.Error(err))
+
+			return err
+		}
 	}
 
 	a.serverLock.Lock()
 	a.server = server
 	a.h2server = h2server
+	a.mgmtServer = mgmtServer
+	a.certificates = certs
+
+	for i, l := range listeners {
+		l.running = servers[i]
+	}
 	a.serverLock.Unlock()
 
+	// Sockets passed by systemd socket activation are used instead of configured addresses
+	inherited, err := systemdListeners()
+	if err != nil {
+		a.Log().Error("failed to use systemd sockets", zap.Error(err))
+
+		return err
+	}
+
+	defer inherited.Close()
+
 	var wg sync.WaitGroup
 
 	if conf.HTTP != nil && conf.HTTP.Enabled {
-		addr := conf.HTTP.Address
-		if addr == "0.0.0.0" {
-			addr = ""
-		}
+		ln := inherited.take("http")
 
 		wg.Go(func() {
-			a.Log().Info(fmt.Sprintf("Listening on http://%s:%d%s...", conf.HTTP.Address, conf.HTTP.Port, conf.Path))
+			ln, err := a.listen(ln, "http", conf.HTTP.Address, conf.HTTP.Port, conf.Path, conf.HTTP.ServerSocket)
+			if err != nil {
+				a.Log().Error("failed to start HTTP server", zap.Error(err))
+
+				return
+			}
+
+			if conf.HTTP.ProxyProtocol {
+				ln = newProxyProtocolListener(ln, &a.RouterOptions().Proxy)
+			}
 
-			if err := server.ListenAndServe(fmt.Sprintf("%s:%d", addr, conf.HTTP.Port)); err != nil {
+			if conf.HTTP.H2C {
+				ln = newH2CListener(ln, h2server)
+			}
+
+			if err := server.Serve(ln); err != nil {
 				a.Log().Error("failed to start HTTP server", zap.Error(err))
 			}
 		})
 	}
 
 	if conf.HTTPS != nil && conf.HTTPS.Enabled {
-		addr := conf.HTTPS.Address
-		if addr == "0.0.0.0" {
-			addr = ""
-		}
-
-		var (
-			certData, keyData []byte
-
-			err error
-		)
+		ln := inherited.take("https")
 
-		if len(conf.HTTPS.CertificatePEMFile) > 0 {
-			certData, keyData, err = cert.LoadPEMFromFile(conf.HTTPS.CertificatePEMFile)
+		wg.Go(func() {
+			ln, err := a.listen(ln, "https", conf.HTTPS.Address, conf.HTTPS.Port, conf.Path, conf.HTTPS.ServerSocket)
 			if err != nil {
-				a.Log().Error("failed to load TLS certificate", zap.Error(err))
+				a.Log().Error("failed to start HTTPS server", zap.Error(err))
 
-				return err
+				return
 			}
-		} else {
-			certData, keyData, err = cert.DevPEMFile("azugo", "localhost")
-			if err != nil {
-				a.Log().Error("failed to load or generate self-signed TLS certificate", zap.Error(err))
 
-				return err
+			if conf.HTTPS.ProxyProtocol {
+				ln = newProxyProtocolListener(ln, &a.RouterOptions().Proxy)
 			}
-		}
 
-		wg.Go(func() {
-			a.Log().Info(fmt.Sprintf("Listening on https://%s:%d%s...", conf.HTTPS.Address, conf.HTTPS.Port, conf.Path))
-
-			if err := server.ListenAndServeTLSEmbed(fmt.Sprintf("%s:%d", addr, conf.HTTPS.Port), certData, keyData); err != nil {
+			// Certificates are provided by the GetCertificate callback
+			if err := server.ServeTLSEmbed(ln, nil, nil); err != nil {
 				a.Log().Error("failed to start HTTPS server", zap.Error(err))
 			}
 		})
 	}
 
+	if mgmtServer != nil {
+		ln := inherited.take("management")
+
+		wg.Go(func() {
+			a.serveManagement(mgmtServer, ln, conf.Management)
+		})
+	}
+
+	for i, l := range listeners {
+		ln := inherited.take(l.name)
+
+		wg.Go(func() {
+			a.serveListener(l, servers[i], ln)
+		})
+	}
+
 	wg.Wait()
 
 	return nil
 }
 
+// listen returns the listener for the server. Inherited listener is used if available,
+// otherwise listens on the unix domain socket or TCP address.
+func (a *App) listen(ln net.Listener, scheme, address string, port int, path string, sock config.ServerSocket) (net.Listener, error) {
+	if ln != nil {
+		a.Log().Info(fmt.Sprintf("Listening on %s://%s%s (systemd)...", scheme, ln.Addr(), path))
+
+		return ln, nil
+	}
+
+	if socket, ok := strings.CutPrefix(address, config.UnixSocketPrefix); ok {
+		a.Log().Info(fmt.Sprintf("Listening on %s+unix://%s...", scheme, socket))
+
+		return listenUnix(socket, sock)
+	}
+
+	a.Log().Info(fmt.Sprintf("Listening on %s://%s:%d%s...", scheme, address, port, path))
+
+	if address == "0.0.0.0" {
+		address = ""
+	}
+
+	return net.Listen("tcp4", net.JoinHostPort(address, strconv.Itoa(port)))
+}
+
+// TLSCertificates returns the TLS certificates used by the running HTTPS server
+// and additional listeners.
+func (a *App) TLSCertificates() []*x509.Certificate {
+	a.serverLock.Lock()
+	defer a.serverLock.Unlock()
+
+	var certs []*x509.Certificate
+
+	if a.certificates != nil {
+		certs = append(certs, a.certificates.Certificates()...)
+	}
+
+	for _, l := range a.listeners {
+		if l.running != nil && l.running.certs != nil {
+			certs = append(certs, l.running.certs.Certificates()...)
+		}
+	}
+
+	return certs
+}
+
 // Stop web application and its services waiting for active connections to finish.
+// All servers are shut down concurrently within the server shutdown timeout.
 func (a *App) Stop() {
 	a.serverLock.Lock()
-	server, h2server := a.server, a.h2server
-	a.server, a.h2server = nil, nil
+	server, h2server, mgmtServer := a.server, a.h2server, a.mgmtServer
+	a.server, a.h2server, a.mgmtServer, a.certificates = nil, nil, nil, nil
+
+	running := make(map[string]*listenerServer, len(a.listeners))
+	for _, l := range a.listeners {
+		if l.running != nil {
+			running[l.name] = l.running
+			l.running = nil
+		}
+	}
 	a.serverLock.Unlock()
 
+	ctx, cancel := context.WithTimeout(context.Background(), a.Config().Server.ShutdownTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+
+	if mgmtServer != nil {
+		wg.Go(func() {
+			a.shutdownServer(ctx, "management", mgmtServer, nil)
+		})
+	}
+
 	if server != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), a.Config().Server.ShutdownTimeout)
-		defer cancel()
+		wg.Go(func() {
+			a.shutdownServer(ctx, "HTTP", server, h2server)
+		})
+	}
 
-		if h2server != nil {
-			if err := h2server.Shutdown(ctx); err != nil {
-				a.Log().Warn("failed to gracefully shut down HTTP2 connections", zap.Error(err))
-			}
-		}
+	for name, l := range running {
+		wg.Go(func() {
+			a.shutdownServer(ctx, name+" listener", l.server, l.h2server)
+		})
+	}
 
-		if err := server.ShutdownWithContext(ctx); err != nil {
-			a.Log().Warn("failed to gracefully shut down HTTP server", zap.Error(err))
+	wg.Wait()
+
+	a.stopTasks()
+
+	a.App.Stop()
+}
+
+// shutdownServer gracefully shuts down the server and its HTTP2 connections.
+func (a *App) shutdownServer(ctx context.Context, name string, server *fasthttp.Server, h2server *http2.Server) {
+	if h2server != nil {
+		if err := h2server.Shutdown(ctx); err != nil {
+			a.Log().Warn(fmt.Sprintf("failed to gracefully shut down %s HTTP2 connections", name), zap.Error(err))
 		}
 	}
 
-	a.App.Stop()
+	if err := server.ShutdownWithContext(ctx); err != nil {
+		a.Log().Warn(fmt.Sprintf("failed to gracefully shut down %s server", name), zap.Error(err))
+	}
 }
@@ -0,0 +1,170 @@
+package azugo
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+
+	"azugo.io/azugo/config"
+
+	"github.com/lafriks/http2"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+)
+
+// reservedListenerNames are names of the listeners started by the application itself.
+var reservedListenerNames = []string{"http", "https", "management"}
+
+// appListener is an additional named listener serving its own router.
+type appListener struct {
+	name    string
+	conf    *config.ServerListener
+	handler RouterHandler
+	options ServerOptions
+
+	// Running server
+	running *listenerServer
+}
+
+// listenerServer is the running server of the additional listener.
+type listenerServer struct {
+	server   *fasthttp.Server
+	h2server *http2.Server
+	certs    *serverCertificates
+}
+
+// Listen registers an additional named listener serving the router with its own
+// middlewares, ex. internal API on a separate port. If the listener configuration
+// is nil it is taken from the server listeners configuration by the name.
+// Application server options are used if none are provided.
+//
+// Listeners must be registered before the application is started and are
+// gracefully shut down together with the application.
+//
+//	internal := azugo.NewRouter(app)
+//	internal.Get("/users", listUsers)
+//	if err := app.Listen("internal", nil, internal); err != nil {
+//		return err
+//	}
+func (a *App) Listen(name string, conf *config.ServerListener, handler RouterHandler, opts ...ServerOptions) error {
+	if len(name) == 0 {
+		return errors.New("listener name is required")
+	}
+
+	if slices.Contains(reservedListenerNames, name) {
+		return fmt.Errorf("listener name %s is reserved", name)
+	}
+
+	if handler == nil {
+		return fmt.Errorf("listener %s router is required", name)
+	}
+
+	if conf == nil {
+		conf = a.Config().Server.Listeners[name]
+		if conf == nil {
+			return fmt.Errorf("listener %s is not configured", name)
+		}
+	}
+
+	options := a.ServerOptions
+	if len(opts) > 0 {
+		if opts[0].RequestReadBufferSize > 0 {
+			options.RequestReadBufferSize = opts[0].RequestReadBufferSize
+		}
+
+		if opts[0].ResponseWriteBufferSize > 0 {
+			options.ResponseWriteBufferSize = opts[0].ResponseWriteBufferSize
+		}
+	}
+
+	a.serverLock.Lock()
+	defer a.serverLock.Unlock()
+
+	if slices.ContainsFunc(a.listeners, func(l *appListener) bool { return l.name == name }) {
+		return fmt.Errorf("listener %s is already registered", name)
+	}
+
+	a.listeners = append(a.listeners, &appListener{
+		name:    name,
+		conf:    conf,
+		handler: handler,
+		options: options,
+	})
+
+	return nil
+}
+
+// newListenerServer returns the server for the additional listener. Timeouts and
+// maximum request body size not set for the listener are taken from the server
+// configuration.
+func (a *App) newListenerServer(l *appListener) (*listenerServer, error) {
+	conf := a.Config().Server
+
+	server := &fasthttp.Server{
+		NoDefaultServerHeader:        true,
+		Handler:                      l.handler.Handler,
+		Logger:                       zap.NewStdLog(a.Log().Named(l.name)),
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
+		ReadBufferSize:               l.options.RequestReadBufferSize,
+		WriteBufferSize:              l.options.ResponseWriteBufferSize,
+		ReadTimeout:                  cmp.Or(l.conf.ReadTimeout, conf.ReadTimeout),
+		WriteTimeout:                 cmp.Or(l.conf.WriteTimeout, conf.WriteTimeout),
+		IdleTimeout:                  cmp.Or(l.conf.IdleTimeout, conf.IdleTimeout),
+		MaxRequestBodySize:           cmp.Or(l.conf.MaxRequestBodySize, conf.MaxRequestBodySize),
+	}
+
+	if l.conf.TLS == nil {
+		if l.conf.H2C {
+			return &listenerServer{server: server, h2server: a.newHTTP2Server(server)}, nil
+		}
+
+		return &listenerServer{server: server}, nil
+	}
+
+	certs, err := a.loadServerCertificates(l.conf.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load listener %s TLS certificate: %w", l.name, err)
+	}
+
+	if server.TLSConfig, err = serverTLSConfig(l.conf.TLS, certs); err != nil {
+		return nil, fmt.Errorf("failed to load listener %s TLS client CA certificates: %w", l.name, err)
+	}
+
+	return &listenerServer{server: server, h2server: a.newHTTP2Server(server), certs: certs}, nil
+}
+
+// serveListener serves the additional listener.
+func (a *App) serveListener(l *appListener, s *listenerServer, ln net.Listener) {
+	scheme := "http"
+	if l.conf.TLS != nil {
+		scheme = "https"
+	}
+
+	ln, err := a.listen(ln, scheme, l.conf.Address, l.conf.Port, "/", l.conf.ServerSocket)
+	if err != nil {
+		a.Log().Error(fmt.Sprintf("failed to start %s listener", l.name), zap.Error(err))
+
+		return
+	}
+
+	if l.conf.ProxyProtocol {
+		ln = newProxyProtocolListener(ln, &a.RouterOptions().Proxy)
+	}
+
+	switch {
+	case l.conf.TLS != nil:
+		// Certificates are provided by the GetCertificate callback
+		err = s.server.ServeTLSEmbed(ln, nil, nil)
+	case s.h2server != nil:
+		err = s.server.Serve(newH2CListener(ln, s.h2server))
+	default:
+		err = s.server.Serve(ln)
+	}
+
+	if err != nil {
+		a.Log().Error(fmt.Sprintf("failed to start %s listener", l.name), zap.Error(err))
+	}
+}
@@ -0,0 +1,103 @@
+package azugo
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"azugo.io/azugo/config"
+
+	"azugo.io/core/http"
+	"github.com/go-quicktest/qt"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func TestListenRegister(t *testing.T) {
+	a := NewTestApp()
+	a.Config().Server.Listeners = map[string]*config.ServerListener{
+		"internal": {Address: "127.0.0.1", Port: 8081},
+	}
+
+	router := NewRouter(a.App)
+
+	qt.Check(t, qt.IsNil(a.Listen("internal", nil, router)))
+	qt.Check(t, qt.ErrorMatches(a.Listen("internal", nil, router), "listener internal is already registered"))
+	qt.Check(t, qt.ErrorMatches(a.Listen("https", &config.ServerListener{}, router), "listener name https is reserved"))
+	qt.Check(t, qt.ErrorMatches(a.Listen("admin", nil, router), "listener admin is not configured"))
+	qt.Check(t, qt.ErrorMatches(a.Listen("admin", &config.ServerListener{}, nil), "listener admin router is required"))
+
+	qt.Assert(t, qt.HasLen(a.listeners, 1))
+	qt.Check(t, qt.Equals(a.listeners[0].conf.Port, 8081))
+	qt.Check(t, qt.Equals(a.listeners[0].options, a.ServerOptions))
+}
+
+func TestListenServer(t *testing.T) {
+	a := NewTestApp()
+	a.Config().Server.ReadTimeout = 5 * time.Second
+
+	a.Get("/public", func(ctx *Context) {
+		ctx.Text("public")
+	})
+
+	internal := NewRouter(a.App)
+	internal.Use(func(next RequestHandler) RequestHandler {
+		return func(ctx *Context) {
+			ctx.Header.Set("X-Internal", "true")
+			next(ctx)
+		}
+	})
+	internal.Get("/users", func(ctx *Context) {
+		ctx.Text("internal")
+	})
+
+	qt.Assert(t, qt.IsNil(a.Listen("internal", &config.ServerListener{
+		Port:        8081,
+		IdleTimeout: time.Minute,
+	}, internal, ServerOptions{RequestReadBufferSize: 16384})))
+
+	a.Start(t)
+	defer a.Stop()
+
+	s, err := a.newListenerServer(a.listeners[0])
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.IsNil(s.h2server))
+	qt.Check(t, qt.Equals(s.server.ReadTimeout, 5*time.Second))
+	qt.Check(t, qt.Equals(s.server.IdleTimeout, time.Minute))
+	qt.Check(t, qt.Equals(s.server.ReadBufferSize, 16384))
+	qt.Check(t, qt.Equals(s.server.WriteBufferSize, a.ServerOptions.ResponseWriteBufferSize))
+
+	ln := fasthttputil.NewInmemoryListener()
+
+	go a.serveListener(a.listeners[0], s, ln)
+	defer func() { _ = s.server.Shutdown() }()
+
+	c := &fasthttp.Client{
+		Dial: func(_ string) (net.Conn, error) {
+			return ln.Dial()
+		},
+	}
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	req.SetRequestURI("http://internal/users")
+	qt.Assert(t, qt.IsNil(c.Do(req, resp)))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+	qt.Check(t, qt.Equals(string(resp.Body()), "internal"))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("X-Internal")), "true"))
+
+	req.SetRequestURI("http://internal/public")
+	qt.Assert(t, qt.IsNil(c.Do(req, resp)))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusNotFound))
+
+	// Public router does not serve internal routes
+	pub, err := a.TestClient().Get("/users")
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(pub.StatusCode(), http.StatusNotFound))
+	qt.Check(t, qt.Equals(len(pub.Header.Peek("X-Internal")), 0))
+	fasthttp.ReleaseResponse(pub)
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"time"
+
+	"azugo.io/core/validation"
+	"github.com/spf13/viper"
+)
+
+// Concurrency configuration of the in-flight request limit.
+type Concurrency struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// Strategy of the limit: static, aimd or gradient.
+	Strategy string `mapstructure:"strategy" validate:"required,oneof=static aimd gradient"`
+	// Limit of the in-flight requests. Initial limit for the adaptive strategies.
+	Limit int `mapstructure:"limit" validate:"required,gt=0"`
+	// MinLimit is the lower bound of the adaptive limit.
+	MinLimit int `mapstructure:"min_limit" validate:"required,gt=0,ltefield=Limit"`
+	// MaxLimit is the upper bound of the adaptive limit.
+	MaxLimit int `mapstructure:"max_limit" validate:"required,gtefield=Limit"`
+
+	// QueueSize is the maximum number of requests waiting for the in-flight slot.
+	// Requests are shed immediately if the queue size is zero.
+	QueueSize int `mapstructure:"queue_size" validate:"min=0"`
+	// QueueTimeout is the maximum duration the request waits in the queue.
+	QueueTimeout time.Duration `mapstructure:"queue_timeout" validate:"required_with=QueueSize,omitempty,gt=0"`
+
+	// LatencyThreshold above which AIMD strategy decreases the limit.
+	LatencyThreshold time.Duration `mapstructure:"latency_threshold" validate:"required_if=Strategy aimd,omitempty,gt=0"`
+	// BackoffRatio is the multiplier AIMD strategy decreases the limit with.
+	BackoffRatio float64 `mapstructure:"backoff_ratio" validate:"required_if=Strategy aimd,omitempty,gt=0,lt=1"`
+
+	// RetryAfter is the duration returned to clients of the shed requests.
+	RetryAfter time.Duration `mapstructure:"retry_after" validate:"min=0"`
+}
+
+// Bind concurrency limit configuration section.
+func (c *Concurrency) Bind(prefix string, v *viper.Viper) {
+	v.SetDefault(prefix+".enabled", false)
+	v.SetDefault(prefix+".strategy", "static")
+	v.SetDefault(prefix+".limit", 100)
+	v.SetDefault(prefix+".min_limit", 10)
+	v.SetDefault(prefix+".max_limit", 1000)
+	v.SetDefault(prefix+".queue_size", 100)
+	v.SetDefault(prefix+".queue_timeout", time.Second)
+	v.SetDefault(prefix+".latency_threshold", time.Second)
+	v.SetDefault(prefix+".backoff_ratio", 0.9)
+	v.SetDefault(prefix+".retry_after", time.Second)
+
+	_ = v.BindEnv(prefix+".enabled", "CONCURRENCY_ENABLED")
+	_ = v.BindEnv(prefix+".strategy", "CONCURRENCY_STRATEGY")
+	_ = v.BindEnv(prefix+".limit", "CONCURRENCY_LIMIT")
+	_ = v.BindEnv(prefix+".min_limit", "CONCURRENCY_MIN_LIMIT")
+	_ = v.BindEnv(prefix+".max_limit", "CONCURRENCY_MAX_LIMIT")
+	_ = v.BindEnv(prefix+".queue_size", "CONCURRENCY_QUEUE_SIZE")
+	_ = v.BindEnv(prefix+".queue_timeout", "CONCURRENCY_QUEUE_TIMEOUT")
+	_ = v.BindEnv(prefix+".latency_threshold", "CONCURRENCY_LATENCY_THRESHOLD")
+	_ = v.BindEnv(prefix+".backoff_ratio", "CONCURRENCY_BACKOFF_RATIO")
+	_ = v.BindEnv(prefix+".retry_after", "CONCURRENCY_RETRY_AFTER")
+}
+
+// Validate concurrency limit configuration section.
+func (c *Concurrency) Validate(valid *validation.Validate) error {
+	if !c.Enabled {
+		return nil
+	}
+
+	return valid.Struct(c)
+}
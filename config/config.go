@@ -27,8 +27,12 @@ type Configuration struct {
 	Healthz *Healthz `mapstructure:"healthz"`
 	// RateLimit configuration section.
 	RateLimit *RateLimit `mapstructure:"rate_limit"`
+	// Concurrency configuration section.
+	Concurrency *Concurrency `mapstructure:"concurrency"`
 	// HTTPClient configuration section.
 	HTTPClient *http.Configuration `mapstructure:"http_client"`
+	// Routes configuration section.
+	Routes *Routes `mapstructure:"routes"`
 }
 
 // New returns a new configuration.
@@ -58,7 +62,9 @@ func (c *Configuration) Bind(_ string, v *viper.Viper) {
 	c.Metrics = config.Bind(c.Metrics, "metrics", v)
 	c.Healthz = config.Bind(c.Healthz, "healthz", v)
 	c.RateLimit = config.Bind(c.RateLimit, "rate_limit", v)
+	c.Concurrency = config.Bind(c.Concurrency, "concurrency", v)
 	c.HTTPClient = config.Bind(c.HTTPClient, "http_client", v)
+	c.Routes = config.Bind(c.Routes, "routes", v)
 }
 
 // BindCmd adds configuration bindings from command arguments.
@@ -98,9 +104,17 @@ func (c *Configuration) Validate(validate *validation.Validate) error {
 		return err
 	}
 
+	if err := c.Concurrency.Validate(validate); err != nil {
+		return err
+	}
+
 	if err := c.HTTPClient.Validate(validate); err != nil {
 		return err
 	}
 
+	if err := c.Routes.Validate(validate); err != nil {
+		return err
+	}
+
 	return nil
 }
@@ -14,6 +14,8 @@ type Proxy struct {
 	Address        []string `mapstructure:"address" validate:"dive,required,ip_addr|cidr|eq=*"`
 	Limit          int      `mapstructure:"limit" validate:"min=0,max=10"`
 	TrustedHeaders []string `mapstructure:"trusted_headers"`
+	// TrustUnixSocket trusts peers connected over unix domain socket as local proxies.
+	TrustUnixSocket bool `mapstructure:"trust_unix_socket"`
 }
 
 // Validate Proxy configuration section.
@@ -56,4 +58,5 @@ func (c *Proxy) Bind(prefix string, v *viper.Viper) {
 	v.SetDefault(prefix+".trusted_headers", headers)
 
 	_ = v.BindEnv(prefix+".limit", "REVERSE_PROXY_LIMIT")
+	_ = v.BindEnv(prefix+".trust_unix_socket", "REVERSE_PROXY_TRUST_UNIX_SOCKET")
 }
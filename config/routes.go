@@ -0,0 +1,194 @@
+package config
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"azugo.io/core/validation"
+	"github.com/spf13/viper"
+)
+
+// ProxyUpstream is a proxy route upstream server configuration.
+type ProxyUpstream struct {
+	URL    string `mapstructure:"url" validate:"required,url"`
+	Weight *int   `mapstructure:"weight" validate:"omitempty,min=0"`
+}
+
+// ProxyHeaders is a configuration of headers modified by the proxy route.
+type ProxyHeaders struct {
+	// Set headers replacing existing values.
+	Set map[string]string `mapstructure:"set" validate:"dive,keys,required,endkeys"`
+	// Add header values keeping existing values.
+	Add map[string]string `mapstructure:"add" validate:"dive,keys,required,endkeys"`
+	// Remove headers.
+	Remove []string `mapstructure:"remove" validate:"dive,required"`
+}
+
+// ProxyRetry is a proxy route retry configuration.
+type ProxyRetry struct {
+	Attempts      int           `mapstructure:"attempts" validate:"omitempty,min=1"`
+	StatusCodes   []int         `mapstructure:"status_codes" validate:"dive,min=100,max=599"`
+	NonIdempotent bool          `mapstructure:"non_idempotent"`
+	TryTimeout    time.Duration `mapstructure:"try_timeout" validate:"omitempty,min=0"`
+	Budget        float64       `mapstructure:"budget" validate:"omitempty,gt=0"`
+	BudgetBurst   int           `mapstructure:"budget_burst" validate:"omitempty,min=1"`
+	MaxBodySize   int           `mapstructure:"max_body_size" validate:"omitempty,min=0"`
+}
+
+// ProxyHealthCheck is a proxy route active health check configuration.
+type ProxyHealthCheck struct {
+	Path     string        `mapstructure:"path" validate:"omitempty,startswith=/"`
+	Status   int           `mapstructure:"status" validate:"omitempty,min=100,max=599"`
+	Interval time.Duration `mapstructure:"interval" validate:"omitempty,min=0"`
+	Timeout  time.Duration `mapstructure:"timeout" validate:"omitempty,min=0"`
+}
+
+// ProxyTLS is a proxy route upstream TLS configuration.
+type ProxyTLS struct {
+	InsecureSkipVerify bool     `mapstructure:"insecure_skip_verify"`
+	CAFile             string   `mapstructure:"ca_file" validate:"omitempty,file"`
+	CertFile           string   `mapstructure:"cert_file" validate:"required_with=KeyFile,omitempty,file"`
+	KeyFile            string   `mapstructure:"key_file" validate:"required_with=CertFile,omitempty,file"`
+	ServerName         string   `mapstructure:"server_name" validate:"omitempty,hostname|fqdn|ip_addr"`
+	MinVersion         string   `mapstructure:"min_version" validate:"omitempty,oneof=1.2 1.3"`
+	CipherSuites       []string `mapstructure:"cipher_suites" validate:"dive,required"`
+}
+
+// TLSMinVersion returns minimum TLS version or zero if not set.
+func (c *ProxyTLS) TLSMinVersion() uint16 {
+	switch c.MinVersion {
+	case "1.2":
+		return tls.VersionTLS12
+	case "1.3":
+		return tls.VersionTLS13
+	default:
+		return 0
+	}
+}
+
+// TLSCipherSuites returns cipher suite IDs by their names.
+func (c *ProxyTLS) TLSCipherSuites() ([]uint16, error) {
+	if len(c.CipherSuites) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint16, 0, len(c.CipherSuites))
+
+next:
+	for _, name := range c.CipherSuites {
+		for _, s := range tls.CipherSuites() {
+			if s.Name == name {
+				ids = append(ids, s.ID)
+
+				continue next
+			}
+		}
+
+		return nil, fmt.Errorf("unsupported TLS cipher suite %q", name)
+	}
+
+	return ids, nil
+}
+
+// ProxyPathRewrite is a proxy route path rewrite rule.
+type ProxyPathRewrite struct {
+	Pattern     string `mapstructure:"pattern" validate:"required"`
+	Replacement string `mapstructure:"replacement"`
+}
+
+// ProxyBodyReplace is a proxy route response body text replacement rule.
+type ProxyBodyReplace struct {
+	From string `mapstructure:"from" validate:"required"`
+	To   string `mapstructure:"to"`
+}
+
+// ProxyRoute is a declarative reverse proxy route configuration.
+type ProxyRoute struct {
+	// Path the proxy is mounted on.
+	Path string `mapstructure:"path" validate:"required,startswith=/"`
+	// Upstreams to forward requests to.
+	Upstreams []*ProxyUpstream `mapstructure:"upstreams" validate:"required,min=1,dive,required"`
+	// Balancer is the load balancing strategy. Defaults to round-robin.
+	Balancer string `mapstructure:"balancer" validate:"omitempty,oneof=round-robin weighted-round-robin least-outstanding random-two-choices consistent-hash"`
+	// HashKey for the consistent hash balancer: header:<name>, cookie:<name>, client-ip or user-id.
+	HashKey string `mapstructure:"hash_key" validate:"required_if=Balancer consistent-hash,omitempty,startswith=header:|startswith=cookie:|eq=client-ip|eq=user-id"`
+	// Timeout is the overall deadline for the upstream request including retries.
+	Timeout time.Duration `mapstructure:"timeout" validate:"omitempty,min=0"`
+	// Retry configuration. Requests are not retried if not set.
+	Retry *ProxyRetry `mapstructure:"retry"`
+	// HealthCheck configuration. Active health checks are disabled if not set.
+	HealthCheck *ProxyHealthCheck `mapstructure:"health_check"`
+	// Host header sent to the upstream. By default upstream URL host is used.
+	Host string `mapstructure:"host"`
+	// KeepPrefix keeps the mount path in the path sent to the upstream.
+	KeepPrefix bool `mapstructure:"keep_prefix"`
+	// PathRewrite rules applied to the upstream request path.
+	PathRewrite []*ProxyPathRewrite `mapstructure:"path_rewrite" validate:"dive,required"`
+	// RequestHeaders modified before sending request to the upstream.
+	RequestHeaders *ProxyHeaders `mapstructure:"request_headers"`
+	// ResponseHeaders modified before returning response to the client.
+	ResponseHeaders *ProxyHeaders `mapstructure:"response_headers"`
+	// BodyReplace rules applied to the response body.
+	BodyReplace []*ProxyBodyReplace `mapstructure:"body_replace" validate:"dive,required"`
+	// BodyReplaceURL replaces upstream URL in the response body with the proxy URL.
+	// Defaults to true.
+	BodyReplaceURL *bool `mapstructure:"body_replace_url"`
+	// TLS configuration for upstream connections.
+	TLS *ProxyTLS `mapstructure:"tls"`
+}
+
+// Routes is a configuration of declarative routes.
+type Routes struct {
+	// Proxy routes.
+	Proxy []*ProxyRoute `mapstructure:"proxy" validate:"dive,required"`
+}
+
+// Validate Routes configuration section.
+func (c *Routes) Validate(valid *validation.Validate) error {
+	if err := valid.Struct(c); err != nil {
+		return err
+	}
+
+	for _, r := range c.Proxy {
+		for _, rw := range r.PathRewrite {
+			if _, err := regexp.Compile(rw.Pattern); err != nil {
+				return fmt.Errorf("invalid proxy route %s path rewrite pattern: %w", r.Path, err)
+			}
+		}
+
+		if r.TLS == nil {
+			continue
+		}
+
+		if _, err := r.TLS.TLSCipherSuites(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Bind Routes configuration section.
+//
+// No routes are declared by default. Proxy routes can be set by ROUTES_PROXY
+// environment variable as JSON array of proxy route configurations.
+func (c *Routes) Bind(prefix string, v *viper.Viper) {
+	env := os.Getenv("ROUTES_PROXY")
+	if len(env) == 0 {
+		return
+	}
+
+	var routes []any
+	if err := json.Unmarshal([]byte(env), &routes); err != nil {
+		// Invalid value is reported when configuration is loaded
+		v.SetDefault(prefix+".proxy", env)
+
+		return
+	}
+
+	v.SetDefault(prefix+".proxy", routes)
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"crypto/tls"
+	"fmt"
 	"net/url"
 	"os"
 	"strconv"
@@ -12,11 +14,68 @@ import (
 	"github.com/spf13/viper"
 )
 
+// UnixSocketPrefix is the address prefix of the unix domain socket path, ex. "unix:/run/app.sock".
+const UnixSocketPrefix = "unix:"
+
+// ServerSocket is a unix domain socket configuration.
+type ServerSocket struct {
+	// SocketMode is the file mode of the socket in octal notation, ex. "0660".
+	SocketMode string `mapstructure:"socket_mode"`
+	// SocketOwner is the user name or ID that owns the socket.
+	SocketOwner string `mapstructure:"socket_owner"`
+	// SocketGroup is the group name or ID that owns the socket.
+	SocketGroup string `mapstructure:"socket_group"`
+}
+
+// FileMode returns the socket file mode or zero if not set.
+func (s ServerSocket) FileMode() (os.FileMode, error) {
+	if len(s.SocketMode) == 0 {
+		return 0, nil
+	}
+
+	m, err := strconv.ParseUint(s.SocketMode, 8, 32)
+	if err != nil || m > 0o777 {
+		return 0, fmt.Errorf("invalid socket mode %q", s.SocketMode)
+	}
+
+	return os.FileMode(m), nil
+}
+
+func unixSocketPath(addr string) string {
+	if path, ok := strings.CutPrefix(addr, UnixSocketPrefix); ok {
+		return path
+	}
+
+	return ""
+}
+
+// serverURLAddress returns the address from the SERVER_URLS entry. Unix domain
+// socket is specified using http+unix or https+unix scheme, ex. "http+unix:///run/app.sock".
+func serverURLAddress(u *url.URL) string {
+	if strings.HasSuffix(strings.ToLower(u.Scheme), "+unix") {
+		return UnixSocketPrefix + u.Path
+	}
+
+	return u.Hostname()
+}
+
 // ServerHTTP is a HTTP server configuration.
 type ServerHTTP struct {
 	Enabled bool   `mapstructure:"enabled"`
-	Address string `mapstructure:"address" validate:"ip_addr|hostname|fqdn"`
+	Address string `mapstructure:"address" validate:"ip_addr|hostname|fqdn|startswith=unix:"`
 	Port    int    `mapstructure:"port" validate:"required,min=1,max=65535"`
+	// ProxyProtocol enables PROXY protocol v1 and v2 headers from trusted proxies.
+	ProxyProtocol bool `mapstructure:"proxy_protocol"`
+	// H2C enables cleartext HTTP/2 for clients with prior knowledge or that upgrade
+	// to h2c, ex. behind TLS terminating service mesh.
+	H2C bool `mapstructure:"h2c"`
+
+	ServerSocket `mapstructure:",squash"`
+}
+
+// UnixSocket returns the unix domain socket path if the server listens on it.
+func (s *ServerHTTP) UnixSocket() string {
+	return unixSocketPath(s.Address)
 }
 
 // Bind server configuration section.
@@ -33,14 +92,14 @@ func (s *ServerHTTP) Bind(prefix string, v *viper.Viper) {
 		}
 
 		if u, err := url.Parse(servu); err == nil {
-			if strings.ToLower(u.Scheme) != "http" {
+			if scheme := strings.ToLower(u.Scheme); scheme != "http" && scheme != "http+unix" {
 				enabled = false
 
 				continue
 			}
 
 			enabled = true
-			addr = u.Hostname()
+			addr = serverURLAddress(u)
 
 			if p, err := strconv.Atoi(u.Port()); err == nil {
 				port = p
@@ -53,19 +112,109 @@ func (s *ServerHTTP) Bind(prefix string, v *viper.Viper) {
 	v.SetDefault(prefix+".enabled", enabled)
 	v.SetDefault(prefix+".address", addr)
 	v.SetDefault(prefix+".port", port)
+
+	_ = v.BindEnv(prefix+".proxy_protocol", "SERVER_HTTP_PROXY_PROTOCOL")
+	_ = v.BindEnv(prefix+".h2c", "SERVER_HTTP_H2C")
 }
 
 // Validate server configuration section.
 func (s *ServerHTTP) Validate(valid *validation.Validate) error {
+	if _, err := s.FileMode(); err != nil {
+		return err
+	}
+
 	return valid.Struct(s)
 }
 
+// ClientAuthMode is the TLS client certificate authentication mode.
+type ClientAuthMode string
+
+const (
+	// ClientAuthNone does not request client certificate.
+	ClientAuthNone ClientAuthMode = "none"
+	// ClientAuthRequest requests client certificate but does not require or verify it.
+	// Context ClientCertificates returns nil in this mode as the certificate is not verified.
+	ClientAuthRequest ClientAuthMode = "request"
+	// ClientAuthRequire requires valid client certificate signed by the client CA.
+	ClientAuthRequire ClientAuthMode = "require"
+	// ClientAuthVerifyIfGiven verifies client certificate only if it is provided.
+	ClientAuthVerifyIfGiven ClientAuthMode = "verify-if-given"
+)
+
+// TLSClientAuth returns the TLS client authentication type for the mode.
+func (m ClientAuthMode) TLSClientAuth() tls.ClientAuthType {
+	switch m {
+	case ClientAuthRequest:
+		return tls.RequestClientCert
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert
+	case ClientAuthVerifyIfGiven:
+		return tls.VerifyClientCertIfGiven
+	case ClientAuthNone:
+		return tls.NoClientCert
+	}
+
+	return tls.NoClientCert
+}
+
+// ServerCertificate is a TLS certificate configuration.
+type ServerCertificate struct {
+	// CertificatePEMFile is the PEM file with the certificate chain. Private key
+	// can be stored in the same file.
+	CertificatePEMFile string `mapstructure:"certificate_pem_file" validate:"required,file"`
+	// KeyPEMFile is the PEM file with the private key if it is not stored in the certificate file.
+	KeyPEMFile string `mapstructure:"key_pem_file" validate:"omitempty,file"`
+}
+
+// ServerTLS is a TLS configuration of the server.
+type ServerTLS struct {
+	CertificatePEMFile string `mapstructure:"certificate_pem_file" validate:"omitempty,file"`
+	// Certificates are additional certificates selected by the SNI server name.
+	Certificates []ServerCertificate `mapstructure:"certificates" validate:"dive"`
+	// CertificateReloadInterval is the interval certificate files are checked for changes.
+	// Zero disables reloading.
+	CertificateReloadInterval time.Duration `mapstructure:"certificate_reload_interval" validate:"omitempty,min=0"`
+	// ClientCAFile is the PEM file with CA certificates used to verify client certificates.
+	ClientCAFile string `mapstructure:"client_ca_file" validate:"omitempty,file"`
+	// ClientAuth is the client certificate authentication mode.
+	ClientAuth ClientAuthMode `mapstructure:"client_auth" validate:"omitempty,oneof=none request require verify-if-given"`
+}
+
+// CertificateFiles returns all configured certificates with the default certificate first.
+func (s *ServerTLS) CertificateFiles() []ServerCertificate {
+	certs := make([]ServerCertificate, 0, len(s.Certificates)+1)
+
+	if len(s.CertificatePEMFile) > 0 {
+		certs = append(certs, ServerCertificate{CertificatePEMFile: s.CertificatePEMFile})
+	}
+
+	return append(certs, s.Certificates...)
+}
+
+// validateClientAuth checks that the client CA is set for modes that verify client certificates.
+func (s *ServerTLS) validateClientAuth() error {
+	if (s.ClientAuth == ClientAuthRequire || s.ClientAuth == ClientAuthVerifyIfGiven) && len(s.ClientCAFile) == 0 {
+		return fmt.Errorf("client CA file is required for client auth mode %q", s.ClientAuth)
+	}
+
+	return nil
+}
+
 // ServerHTTPS is a HTTPS server configuration.
 type ServerHTTPS struct {
-	Enabled            bool   `mapstructure:"enabled"`
-	Address            string `mapstructure:"address" validate:"ip_addr|hostname|fqdn"`
-	Port               int    `mapstructure:"port" validate:"required,min=1,max=65535"`
-	CertificatePEMFile string `mapstructure:"certificate_pem_file" validate:"omitempty,file"`
+	Enabled bool   `mapstructure:"enabled"`
+	Address string `mapstructure:"address" validate:"ip_addr|hostname|fqdn|startswith=unix:"`
+	Port    int    `mapstructure:"port" validate:"required,min=1,max=65535"`
+	// ProxyProtocol enables PROXY protocol v1 and v2 headers from trusted proxies.
+	ProxyProtocol bool `mapstructure:"proxy_protocol"`
+
+	ServerTLS    `mapstructure:",squash"`
+	ServerSocket `mapstructure:",squash"`
+}
+
+// UnixSocket returns the unix domain socket path if the server listens on it.
+func (s *ServerHTTPS) UnixSocket() string {
+	return unixSocketPath(s.Address)
 }
 
 // Bind server configuration section.
@@ -82,12 +231,12 @@ func (s *ServerHTTPS) Bind(prefix string, v *viper.Viper) {
 		}
 
 		if u, err := url.Parse(servu); err == nil {
-			if strings.ToLower(u.Scheme) != "https" {
+			if scheme := strings.ToLower(u.Scheme); scheme != "https" && scheme != "https+unix" {
 				continue
 			}
 
 			enabled = true
-			addr = u.Hostname()
+			addr = serverURLAddress(u)
 
 			if p, err := strconv.Atoi(u.Port()); err == nil {
 				port = p
@@ -100,20 +249,167 @@ func (s *ServerHTTPS) Bind(prefix string, v *viper.Viper) {
 	v.SetDefault(prefix+".enabled", enabled)
 	v.SetDefault(prefix+".address", addr)
 	v.SetDefault(prefix+".port", port)
+	v.SetDefault(prefix+".certificate_reload_interval", time.Minute)
 
 	_ = v.BindEnv(prefix+".certificate_pem_file", "SERVER_HTTPS_CERTIFICATE_PEM_FILE")
+	_ = v.BindEnv(prefix+".certificate_reload_interval", "SERVER_HTTPS_CERTIFICATE_RELOAD_INTERVAL")
+	_ = v.BindEnv(prefix+".client_ca_file", "SERVER_HTTPS_CLIENT_CA_FILE")
+	_ = v.BindEnv(prefix+".client_auth", "SERVER_HTTPS_CLIENT_AUTH")
+	_ = v.BindEnv(prefix+".proxy_protocol", "SERVER_HTTPS_PROXY_PROTOCOL")
 }
 
 // Validate server configuration section.
 func (s *ServerHTTPS) Validate(valid *validation.Validate) error {
+	if _, err := s.FileMode(); err != nil {
+		return err
+	}
+
+	if err := s.validateClientAuth(); err != nil {
+		return err
+	}
+
+	return valid.Struct(s)
+}
+
+// ServerManagement is a management server configuration. Management server serves
+// metrics, health check and administration endpoints separately from the public server.
+// It listens only on the loopback interface by default as the endpoints do not
+// require authentication.
+type ServerManagement struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Address string `mapstructure:"address" validate:"ip_addr|hostname|fqdn|startswith=unix:"`
+	Port    int    `mapstructure:"port" validate:"required,min=1,max=65535"`
+	// Pprof enables profiling endpoints under /debug/pprof/.
+	Pprof bool `mapstructure:"pprof"`
+	// Admin enables administration endpoints under /admin/ that list routes and
+	// proxy upstreams.
+	Admin bool `mapstructure:"admin"`
+
+	ServerSocket `mapstructure:",squash"`
+}
+
+// UnixSocket returns the unix domain socket path if the server listens on it.
+func (s *ServerManagement) UnixSocket() string {
+	return unixSocketPath(s.Address)
+}
+
+// Bind server configuration section.
+func (s *ServerManagement) Bind(prefix string, v *viper.Viper) {
+	v.SetDefault(prefix+".enabled", false)
+	v.SetDefault(prefix+".address", "127.0.0.1")
+	v.SetDefault(prefix+".port", 9090)
+	v.SetDefault(prefix+".pprof", false)
+	v.SetDefault(prefix+".admin", false)
+
+	_ = v.BindEnv(prefix+".enabled", "SERVER_MANAGEMENT_ENABLED")
+	_ = v.BindEnv(prefix+".address", "SERVER_MANAGEMENT_ADDRESS")
+	_ = v.BindEnv(prefix+".port", "SERVER_MANAGEMENT_PORT")
+	_ = v.BindEnv(prefix+".pprof", "SERVER_MANAGEMENT_PPROF")
+	_ = v.BindEnv(prefix+".admin", "SERVER_MANAGEMENT_ADMIN")
+}
+
+// Validate server configuration section.
+func (s *ServerManagement) Validate(valid *validation.Validate) error {
+	if !s.Enabled {
+		return nil
+	}
+
+	if _, err := s.FileMode(); err != nil {
+		return err
+	}
+
+	return valid.Struct(s)
+}
+
+// ServerListener is an additional listener configuration. Listener is started
+// with the router it is registered with using App.Listen.
+type ServerListener struct {
+	Address string `mapstructure:"address" validate:"ip_addr|hostname|fqdn|startswith=unix:"`
+	Port    int    `mapstructure:"port" validate:"required,min=1,max=65535"`
+	// ProxyProtocol enables PROXY protocol v1 and v2 headers from trusted proxies.
+	ProxyProtocol bool `mapstructure:"proxy_protocol"`
+	// TLS enables HTTPS on the listener.
+	TLS *ServerTLS `mapstructure:"tls"`
+	// H2C enables cleartext HTTP/2 for clients with prior knowledge or that upgrade
+	// to h2c if TLS is not enabled.
+	H2C bool `mapstructure:"h2c"`
+
+	// Maximum duration for reading the full request including body.
+	// Defaults to the server read timeout.
+	ReadTimeout time.Duration `mapstructure:"read_timeout" validate:"omitempty,min=0"`
+	// Maximum duration for writing the response.
+	// Defaults to the server write timeout.
+	WriteTimeout time.Duration `mapstructure:"write_timeout" validate:"omitempty,min=0"`
+	// Maximum duration to wait for the next request on a keep-alive connection.
+	// Defaults to the server idle timeout.
+	IdleTimeout time.Duration `mapstructure:"idle_timeout" validate:"omitempty,min=0"`
+	// Maximum request body size.
+	// Defaults to the server maximum request body size.
+	MaxRequestBodySize int `mapstructure:"max_request_body_size" validate:"omitempty,min=0"`
+
+	ServerSocket `mapstructure:",squash"`
+}
+
+// UnixSocket returns the unix domain socket path if the server listens on it.
+func (s *ServerListener) UnixSocket() string {
+	return unixSocketPath(s.Address)
+}
+
+// Validate listener configuration.
+func (s *ServerListener) Validate(valid *validation.Validate) error {
+	if _, err := s.FileMode(); err != nil {
+		return err
+	}
+
+	if s.TLS != nil {
+		if err := s.TLS.validateClientAuth(); err != nil {
+			return err
+		}
+	}
+
+	return valid.Struct(s)
+}
+
+// ServerHTTP2 is a HTTP/2 protocol configuration.
+//
+// Maximum frame size, initial window sizes and header table size can not be
+// configured as the HTTP/2 server uses fixed values for them.
+type ServerHTTP2 struct {
+	// MaxConcurrentStreams is the maximum number of concurrent streams per connection.
+	MaxConcurrentStreams int `mapstructure:"max_concurrent_streams" validate:"min=0"`
+	// PingInterval is the interval of ping frames sent to the client.
+	// Negative value disables pings.
+	PingInterval time.Duration `mapstructure:"ping_interval"`
+	// ShutdownGracePeriod is the maximum duration to accept new streams after
+	// the connection is notified about the shutdown.
+	ShutdownGracePeriod time.Duration `mapstructure:"shutdown_grace_period"`
+}
+
+// Bind HTTP/2 configuration section.
+func (s *ServerHTTP2) Bind(prefix string, v *viper.Viper) {
+	v.SetDefault(prefix+".max_concurrent_streams", 256)
+	v.SetDefault(prefix+".ping_interval", 30*time.Second)
+	v.SetDefault(prefix+".shutdown_grace_period", 500*time.Millisecond)
+
+	_ = v.BindEnv(prefix+".max_concurrent_streams", "SERVER_HTTP2_MAX_CONCURRENT_STREAMS")
+	_ = v.BindEnv(prefix+".ping_interval", "SERVER_HTTP2_PING_INTERVAL")
+	_ = v.BindEnv(prefix+".shutdown_grace_period", "SERVER_HTTP2_SHUTDOWN_GRACE_PERIOD")
+}
+
+// Validate HTTP/2 configuration section.
+func (s *ServerHTTP2) Validate(valid *validation.Validate) error {
 	return valid.Struct(s)
 }
 
 // Server configuration section.
 type Server struct {
-	HTTP  *ServerHTTP  `mapstructure:"http"`
-	HTTPS *ServerHTTPS `mapstructure:"https"`
-	Path  string       `mapstructure:"path"`
+	HTTP       *ServerHTTP       `mapstructure:"http"`
+	HTTPS      *ServerHTTPS      `mapstructure:"https"`
+	Management *ServerManagement `mapstructure:"management"`
+	HTTP2      *ServerHTTP2      `mapstructure:"http2"`
+	Path       string            `mapstructure:"path"`
+	// Listeners are additional named listeners, ex. for the internal API.
+	Listeners map[string]*ServerListener `mapstructure:"listeners"`
 
 	// Maximum duration for reading the full request including body.
 	ReadTimeout time.Duration `mapstructure:"read_timeout" validate:"omitempty,min=0"`
@@ -133,7 +429,8 @@ func (s *Server) Bind(prefix string, v *viper.Viper) {
 	path := "/"
 
 	if servu, _, _ := strings.Cut(os.Getenv("SERVER_URLS"), ";"); len(servu) > 0 {
-		if u, err := url.Parse(servu); err == nil && len(u.Path) > 0 {
+		// Path of the unix domain socket URL is the socket path
+		if u, err := url.Parse(servu); err == nil && len(u.Path) > 0 && !strings.HasSuffix(strings.ToLower(u.Scheme), "+unix") {
 			path = u.Path
 		}
 	}
@@ -154,6 +451,8 @@ func (s *Server) Bind(prefix string, v *viper.Viper) {
 
 	s.HTTP = config.Bind(s.HTTP, prefix+".http", v)
 	s.HTTPS = config.Bind(s.HTTPS, prefix+".https", v)
+	s.Management = config.Bind(s.Management, prefix+".management", v)
+	s.HTTP2 = config.Bind(s.HTTP2, prefix+".http2", v)
 }
 
 // Validate server configuration section.
@@ -170,5 +469,27 @@ func (s *Server) Validate(valid *validation.Validate) error {
 		}
 	}
 
+	if s.Management != nil {
+		if err := s.Management.Validate(valid); err != nil {
+			return err
+		}
+	}
+
+	if s.HTTP2 != nil {
+		if err := s.HTTP2.Validate(valid); err != nil {
+			return err
+		}
+	}
+
+	for name, l := range s.Listeners {
+		if l == nil {
+			continue
+		}
+
+		if err := l.Validate(valid); err != nil {
+			return fmt.Errorf("invalid listener %s: %w", name, err)
+		}
+	}
+
 	return valid.Struct(s)
 }
@@ -0,0 +1,368 @@
+package azugo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"azugo.io/azugo/config"
+
+	"azugo.io/core/http"
+	"github.com/lafriks/http2"
+	"github.com/valyala/fasthttp"
+)
+
+// h2cPrefaceTimeout is the maximum duration to wait for the client connection preface.
+const h2cPrefaceTimeout = 10 * time.Second
+
+// h2cPreface is the HTTP/2 client connection preface.
+var h2cPreface = []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+
+// h2cUpgradeResponse is the response switching the connection to HTTP/2.
+var h2cUpgradeResponse = []byte("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: h2c\r\n\r\n")
+
+// h2cUpgradeSkipHeaders are the HTTP/1 request headers not passed to the upgraded HTTP/2 request.
+var h2cUpgradeSkipHeaders = []string{
+	"Connection",
+	"Host",
+	"HTTP2-Settings",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"TE",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+const (
+	// h2cFrameHeaderSize is the size of the HTTP/2 frame header.
+	h2cFrameHeaderSize = 9
+	// h2cFrameSettings is the HTTP/2 SETTINGS frame type.
+	h2cFrameSettings = 0x4
+	// h2cMaxSettingsSize is the maximum accepted size of the client SETTINGS frame payload.
+	h2cMaxSettingsSize = 1 << 14
+)
+
+// newHTTP2Server configures HTTP/2 support for the server.
+func (a *App) newHTTP2Server(server *fasthttp.Server) *http2.Server {
+	conf := a.Config().Server.HTTP2
+	if conf == nil {
+		conf = &config.ServerHTTP2{
+			MaxConcurrentStreams: 256,
+			PingInterval:         30 * time.Second,
+		}
+	}
+
+	return http2.ConfigureServer(server, http2.ServerConfig{
+		PingInterval:         conf.PingInterval,
+		MaxConcurrentStreams: conf.MaxConcurrentStreams,
+		ShutdownGracePeriod:  conf.ShutdownGracePeriod,
+	})
+}
+
+// h2cListener serves cleartext HTTP/2 connections of the clients with prior knowledge
+// (RFC 9113, section 3.3) or that upgrade the first HTTP/1.1 request to h2c (RFC 7540,
+// section 3.2) and passes all other connections to the HTTP/1 server.
+//
+// Upgrade requests with a body are served over HTTP/1.1 as allowed by the RFC 9110,
+// section 7.8.
+type h2cListener struct {
+	net.Listener
+
+	h2server *http2.Server
+	conns    chan net.Conn
+	errs     chan error
+	done     chan struct{}
+	once     sync.Once
+}
+
+// newH2CListener returns listener that serves cleartext HTTP/2 connections.
+func newH2CListener(ln net.Listener, h2server *http2.Server) net.Listener {
+	l := &h2cListener{
+		Listener: ln,
+		h2server: h2server,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error),
+		done:     make(chan struct{}),
+	}
+
+	go l.accept()
+
+	return l
+}
+
+func (l *h2cListener) accept() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.errs <- err:
+			case <-l.done:
+				return
+			}
+
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+
+			return
+		}
+
+		go l.detect(conn)
+	}
+}
+
+// detect serves connection as HTTP/2 if it starts with the client connection preface.
+func (l *h2cListener) detect(conn net.Conn) {
+	c := &h2cConn{
+		Conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+
+	ok := c.isHTTP2()
+	if !ok {
+		var err error
+		if ok, err = c.upgrade(); err != nil {
+			_ = conn.Close()
+
+			return
+		}
+	}
+
+	if ok {
+		// Connection is closed by the HTTP/2 server
+		_ = l.h2server.ServeConn(c)
+
+		return
+	}
+
+	select {
+	case l.conns <- c:
+	case <-l.done:
+		_ = conn.Close()
+	}
+}
+
+func (l *h2cListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *h2cListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+
+	return l.Listener.Close()
+}
+
+// h2cConn replays the bytes read while detecting the protocol.
+type h2cConn struct {
+	net.Conn
+
+	reader *bufio.Reader
+	// prefix is read before the rest of the connection data.
+	prefix []byte
+}
+
+// isHTTP2 reads until the received data differs from the client connection preface.
+func (c *h2cConn) isHTTP2() bool {
+	_ = c.Conn.SetReadDeadline(time.Now().Add(h2cPrefaceTimeout))
+	defer func() { _ = c.Conn.SetReadDeadline(time.Time{}) }()
+
+	for i := 1; i <= len(h2cPreface); i++ {
+		b, err := c.reader.Peek(i)
+		if err != nil || b[i-1] != h2cPreface[i-1] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// upgrade switches the connection to HTTP/2 if the first request asks to upgrade to h2c.
+// The upgrade request is then served by the HTTP/2 server as the stream 1. Error is
+// returned if the connection fails after the protocols have been switched.
+func (c *h2cConn) upgrade() (bool, error) {
+	_ = c.Conn.SetReadDeadline(time.Now().Add(h2cPrefaceTimeout))
+	defer func() { _ = c.Conn.SetReadDeadline(time.Time{}) }()
+
+	raw := c.peekRequestHeader()
+	if raw == nil {
+		return false, nil
+	}
+
+	var h fasthttp.RequestHeader
+	if err := h.Read(bufio.NewReader(bytes.NewReader(raw))); err != nil {
+		return false, nil
+	}
+
+	settings, ok := h2cUpgradeSettings(&h)
+	if !ok {
+		return false, nil
+	}
+
+	stream := h2cUpgradeStream(&h)
+
+	if _, err := c.reader.Discard(len(raw)); err != nil {
+		return false, err
+	}
+
+	if _, err := c.Conn.Write(h2cUpgradeResponse); err != nil {
+		return false, err
+	}
+
+	// Client sends the connection preface starting with the SETTINGS frame after the switch
+	preface := make([]byte, len(h2cPreface)+h2cFrameHeaderSize)
+	if _, err := io.ReadFull(c.reader, preface); err != nil {
+		return false, err
+	}
+
+	header := preface[len(h2cPreface):]
+	size := int(header[0])<<16 | int(header[1])<<8 | int(header[2])
+
+	if !bytes.Equal(preface[:len(h2cPreface)], h2cPreface) || header[3] != h2cFrameSettings || header[4] != 0 ||
+		!bytes.Equal(header[5:], []byte{0, 0, 0, 0}) || size%6 != 0 || size > h2cMaxSettingsSize {
+		return false, errors.New("invalid HTTP/2 connection preface")
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, err
+	}
+
+	// Settings from the HTTP2-Settings header are applied before the client SETTINGS frame
+	// values as a single frame so that the client receives only one acknowledgement
+	size += len(settings)
+	header[0], header[1], header[2] = byte(size>>16), byte(size>>8), byte(size)
+
+	prefix := make([]byte, 0, len(preface)+size+len(stream))
+	prefix = append(prefix, preface...)
+	prefix = append(prefix, settings...)
+	prefix = append(prefix, payload...)
+	c.prefix = append(prefix, stream...)
+
+	return true, nil
+}
+
+// peekRequestHeader returns the buffered HTTP/1 request header or nil if it is not complete
+// and does not fit in the buffer.
+func (c *h2cConn) peekRequestHeader() []byte {
+	for {
+		b, _ := c.reader.Peek(c.reader.Buffered())
+		if i := bytes.Index(b, []byte("\r\n\r\n")); i != -1 {
+			return b[:i+4]
+		}
+
+		if len(b) >= c.reader.Size() {
+			return nil
+		}
+
+		if _, err := c.reader.Peek(len(b) + 1); err != nil {
+			return nil
+		}
+	}
+}
+
+// h2cUpgradeSettings returns the decoded HTTP2-Settings header value if the request
+// can be upgraded to h2c.
+func h2cUpgradeSettings(h *fasthttp.RequestHeader) ([]byte, bool) {
+	if !h.IsHTTP11() || !h.ConnectionUpgrade() ||
+		!strings.EqualFold(strings.TrimSpace(string(h.Peek(http.HeaderUpgrade))), "h2c") {
+		return nil, false
+	}
+
+	// Upgrade of requests with body is not supported
+	if n := h.ContentLength(); n != 0 && n != -2 {
+		return nil, false
+	}
+
+	values := h.PeekAll("HTTP2-Settings")
+	if len(values) != 1 {
+		return nil, false
+	}
+
+	settings, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(string(values[0]), "="))
+	if err != nil || len(settings)%6 != 0 {
+		return nil, false
+	}
+
+	return settings, true
+}
+
+// h2cUpgradeStream returns the HTTP/2 HEADERS frame of the upgrade request sent as the stream 1.
+func h2cUpgradeStream(h *fasthttp.RequestHeader) []byte {
+	hp := http2.AcquireHPACK()
+	defer http2.ReleaseHPACK(hp)
+
+	hf := http2.AcquireHeaderField()
+	defer http2.ReleaseHeaderField(hf)
+
+	fr := http2.AcquireFrameHeader()
+	defer http2.ReleaseFrameHeader(fr)
+
+	headers, _ := http2.AcquireFrame(http2.FrameHeaders).(*http2.Headers)
+	headers.SetEndStream(true)
+	headers.SetEndHeaders(true)
+
+	fr.SetStream(1)
+	fr.SetBody(headers)
+
+	// Header fields are not stored in the dynamic table as the client is not aware of them
+	add := func(key, value []byte) {
+		hf.SetBytes(key, value)
+		headers.AppendHeaderField(hp, hf, false)
+	}
+
+	add([]byte(":method"), h.Method())
+	add([]byte(":scheme"), []byte("http"))
+	add([]byte(":authority"), h.Host())
+	add([]byte(":path"), h.RequestURI())
+
+	for key, value := range h.All() {
+		if slices.ContainsFunc(h2cUpgradeSkipHeaders, func(name string) bool {
+			return strings.EqualFold(name, string(key))
+		}) {
+			continue
+		}
+
+		add(bytes.ToLower(key), value)
+	}
+
+	var buf bytes.Buffer
+
+	bw := bufio.NewWriter(&buf)
+	_, _ = fr.WriteTo(bw)
+	_ = bw.Flush()
+
+	return buf.Bytes()
+}
+
+func (c *h2cConn) Read(b []byte) (int, error) {
+	if len(c.prefix) > 0 {
+		n := copy(b, c.prefix)
+		c.prefix = c.prefix[n:]
+
+		return n, nil
+	}
+
+	return c.reader.Read(b)
+}
+
+// NetConn returns the underlying connection.
+func (c *h2cConn) NetConn() net.Conn {
+	return c.Conn
+}
@@ -0,0 +1,204 @@
+package azugo
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	nethttp "net/http"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+	"github.com/lafriks/http2"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func TestH2CListener(t *testing.T) {
+	a := NewTestApp()
+
+	a.Get("/proto", func(ctx *Context) {
+		ctx.Text(ctx.Protocol())
+	})
+
+	a.Start(t)
+	defer a.Stop()
+
+	server := &fasthttp.Server{
+		Handler: a.Handler,
+	}
+	h2server := a.newHTTP2Server(server)
+
+	ln := fasthttputil.NewInmemoryListener()
+
+	go func() {
+		_ = server.Serve(newH2CListener(ln, h2server))
+	}()
+	defer func() { _ = server.Shutdown() }()
+
+	request := func(protocols *nethttp.Protocols) (string, string) {
+		c := &nethttp.Client{
+			Transport: &nethttp.Transport{
+				Protocols: protocols,
+				DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+					return ln.Dial()
+				},
+			},
+		}
+		defer c.CloseIdleConnections()
+
+		resp, err := c.Get("http://localhost/proto")
+		qt.Assert(t, qt.IsNil(err))
+
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		qt.Assert(t, qt.IsNil(err))
+
+		return resp.Proto, string(body)
+	}
+
+	var h2c nethttp.Protocols
+	h2c.SetUnencryptedHTTP2(true)
+
+	proto, body := request(&h2c)
+	qt.Check(t, qt.Equals(proto, "HTTP/2.0"))
+	qt.Check(t, qt.Equals(body, "HTTP/2"))
+
+	proto, body = request(nil)
+	qt.Check(t, qt.Equals(proto, "HTTP/1.1"))
+	qt.Check(t, qt.Equals(body, "HTTP/1.1"))
+}
+
+func TestH2CConnShortRequest(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	go func() {
+		_, _ = client.Write([]byte("GET / HTTP/1.0\r\n\r\n"))
+	}()
+
+	c := &h2cConn{Conn: server, reader: bufio.NewReader(server)}
+	qt.Check(t, qt.IsFalse(c.isHTTP2()))
+
+	b := make([]byte, 3)
+	_, err := io.ReadFull(c, b)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(b), "GET"))
+}
+
+func TestH2CListenerUpgrade(t *testing.T) {
+	a := NewTestApp()
+
+	a.Any("/proto", func(ctx *Context) {
+		ctx.Text(ctx.Protocol() + " " + ctx.Header.Get("X-Test"))
+	})
+
+	a.Start(t)
+	defer a.Stop()
+
+	server := &fasthttp.Server{
+		Handler: a.Handler,
+	}
+	h2server := a.newHTTP2Server(server)
+
+	ln := fasthttputil.NewInmemoryListener()
+
+	go func() {
+		_ = server.Serve(newH2CListener(ln, h2server))
+	}()
+	defer func() { _ = server.Shutdown() }()
+
+	// SETTINGS_MAX_CONCURRENT_STREAMS = 100
+	settings := base64.RawURLEncoding.EncodeToString([]byte{0, 3, 0, 0, 0, 100})
+
+	t.Run("upgrade", func(t *testing.T) {
+		conn, err := ln.Dial()
+		qt.Assert(t, qt.IsNil(err))
+
+		defer conn.Close()
+
+		_, err = conn.Write([]byte("GET /proto HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade, HTTP2-Settings\r\n" +
+			"Upgrade: h2c\r\nHTTP2-Settings: " + settings + "\r\nX-Test: upgraded\r\n\r\n"))
+		qt.Assert(t, qt.IsNil(err))
+
+		br := bufio.NewReader(conn)
+
+		resp, err := nethttp.ReadResponse(br, nil)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.Equals(resp.StatusCode, nethttp.StatusSwitchingProtocols))
+
+		// Connection preface with empty SETTINGS frame
+		_, err = conn.Write(append(append([]byte(nil), h2cPreface...), 0, 0, 0, 4, 0, 0, 0, 0, 0))
+		qt.Assert(t, qt.IsNil(err))
+
+		hp := http2.AcquireHPACK()
+		defer http2.ReleaseHPACK(hp)
+
+		var (
+			status string
+			body   []byte
+			acks   int
+		)
+
+		for end := false; !end; {
+			fr, err := http2.ReadFrameFrom(br)
+			qt.Assert(t, qt.IsNil(err))
+
+			switch b := fr.Body().(type) {
+			case *http2.Settings:
+				if b.IsAck() {
+					acks++
+				}
+			case *http2.Headers:
+				qt.Check(t, qt.Equals(fr.Stream(), uint32(1)))
+
+				hf := http2.AcquireHeaderField()
+
+				for raw := b.Headers(); len(raw) > 0; {
+					raw, err = hp.Next(hf, raw)
+					qt.Assert(t, qt.IsNil(err))
+
+					if hf.Key() == ":status" {
+						status = hf.Value()
+					}
+				}
+
+				http2.ReleaseHeaderField(hf)
+			case *http2.Data:
+				qt.Check(t, qt.Equals(fr.Stream(), uint32(1)))
+
+				body = append(body, b.Data()...)
+				end = b.EndStream()
+			}
+
+			http2.ReleaseFrameHeader(fr)
+		}
+
+		qt.Check(t, qt.Equals(status, "200"))
+		qt.Check(t, qt.Equals(string(body), "HTTP/2 upgraded"))
+		qt.Check(t, qt.Equals(acks, 1))
+	})
+
+	t.Run("with body", func(t *testing.T) {
+		conn, err := ln.Dial()
+		qt.Assert(t, qt.IsNil(err))
+
+		defer conn.Close()
+
+		_, err = conn.Write([]byte("POST /proto HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade, HTTP2-Settings\r\n" +
+			"Upgrade: h2c\r\nHTTP2-Settings: " + settings + "\r\nContent-Length: 4\r\n\r\ntest"))
+		qt.Assert(t, qt.IsNil(err))
+
+		resp, err := nethttp.ReadResponse(bufio.NewReader(conn), nil)
+		qt.Assert(t, qt.IsNil(err))
+
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Check(t, qt.Equals(resp.StatusCode, nethttp.StatusOK))
+		qt.Check(t, qt.Equals(string(body), "HTTP/1.1 "))
+	})
+}
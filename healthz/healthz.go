@@ -52,7 +52,8 @@ type CheckFunc func(*azugo.Context) *Response
 
 // Handler returns an azugo.RequestHandler for the health check endpoint.
 // Allowed source IPs are controlled by app.HealthzOptions, configured via
-// the healthz section in the application configuration.
+// the healthz section in the application configuration. Requests served by
+// the management server are not checked.
 // All provided checks are run; the worst status wins. When multiple checks
 // share the worst status the description from the first one is used.
 //
@@ -75,7 +76,7 @@ func Handler(checks ...CheckFunc) azugo.RequestHandler {
 		ctx.SkipRequestLog()
 		ctx.SkipMetrics()
 
-		if !ctx.App().HealthzOptions.IsTrusted(ctx.IP()) {
+		if !ctx.IsManagement() && !ctx.App().HealthzOptions.IsTrusted(ctx.IP()) {
 			ctx.NotFound()
 
 			return
@@ -0,0 +1,44 @@
+package healthz
+
+import (
+	"fmt"
+	"time"
+
+	"azugo.io/azugo"
+)
+
+// TLSCertificates returns a check of the TLS certificates used by the HTTPS server.
+// Fail is returned when any certificate has expired and warn when it expires
+// within the warnBefore duration.
+//
+//	app.Get("/healthz", healthz.Handler(healthz.TLSCertificates(14*24*time.Hour)))
+func TLSCertificates(warnBefore time.Duration) CheckFunc {
+	return func(ctx *azugo.Context) *Response {
+		var resp *Response
+
+		now := time.Now()
+
+		for _, c := range ctx.App().TLSCertificates() {
+			name := c.Subject.CommonName
+			if len(c.DNSNames) > 0 {
+				name = c.DNSNames[0]
+			}
+
+			if now.After(c.NotAfter) {
+				return &Response{
+					Status:      Fail,
+					Description: fmt.Sprintf("TLS certificate for %s has expired", name),
+				}
+			}
+
+			if resp == nil && c.NotAfter.Sub(now) < warnBefore {
+				resp = &Response{
+					Status:      Warn,
+					Description: fmt.Sprintf("TLS certificate for %s expires on %s", name, c.NotAfter.UTC().Format(time.RFC3339)),
+				}
+			}
+		}
+
+		return resp
+	}
+}
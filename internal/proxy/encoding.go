@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+)
+
+type encoding int
+
+const (
+	encodingIdentity encoding = iota
+	encodingGzip
+	encodingDeflate
+	encodingBrotli
+	encodingZstd
+	encodingUnsupported
+)
+
+// contentEncoding returns the encoding of the Content-Encoding header value.
+func contentEncoding(v []byte) encoding {
+	v = bytes.TrimSpace(v)
+
+	switch {
+	case len(v) == 0, bytes.EqualFold(v, []byte("identity")):
+		return encodingIdentity
+	case bytes.EqualFold(v, []byte("gzip")), bytes.EqualFold(v, []byte("x-gzip")):
+		return encodingGzip
+	case bytes.EqualFold(v, []byte("deflate")):
+		return encodingDeflate
+	case bytes.EqualFold(v, []byte("br")):
+		return encodingBrotli
+	case bytes.EqualFold(v, []byte("zstd")):
+		return encodingZstd
+	default:
+		return encodingUnsupported
+	}
+}
+
+// newDecoder returns the reader decoding the body.
+func newDecoder(enc encoding, r io.Reader) (io.ReadCloser, error) {
+	switch enc {
+	case encodingGzip:
+		return gzip.NewReader(r)
+	case encodingDeflate:
+		return zlib.NewReader(r)
+	case encodingBrotli:
+		return io.NopCloser(brotli.NewReader(r)), nil
+	case encodingZstd:
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+
+		return d.IOReadCloser(), nil
+	default:
+		return io.NopCloser(r), nil
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// newEncoder returns the writer encoding the body. Writer must be closed to flush the encoded data.
+func newEncoder(enc encoding, w io.Writer) (io.WriteCloser, error) {
+	switch enc {
+	case encodingGzip:
+		return gzip.NewWriter(w), nil
+	case encodingDeflate:
+		return zlib.NewWriter(w), nil
+	case encodingBrotli:
+		return brotli.NewWriter(w), nil
+	case encodingZstd:
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
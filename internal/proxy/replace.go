@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// replaceWriter replaces all occurrences of the text in the data written to it.
+// Data that could be the beginning of the text is held back until more data is
+// written or the writer is flushed.
+type replaceWriter struct {
+	w        io.Writer
+	from, to []byte
+	buf      []byte
+}
+
+func newReplaceWriter(w io.Writer, from, to []byte) *replaceWriter {
+	return &replaceWriter{
+		w:    w,
+		from: from,
+		to:   to,
+	}
+}
+
+// Write implements io.Writer.
+func (r *replaceWriter) Write(p []byte) (int, error) {
+	if len(r.from) == 0 {
+		return r.w.Write(p)
+	}
+
+	r.buf = append(r.buf, p...)
+
+	if err := r.replace(false); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Flush writes all held back data.
+func (r *replaceWriter) Flush() error {
+	return r.replace(true)
+}
+
+func (r *replaceWriter) replace(final bool) error {
+	buf := r.buf
+
+	for {
+		i := bytes.Index(buf, r.from)
+		if i == -1 {
+			break
+		}
+
+		if _, err := r.w.Write(buf[:i]); err != nil {
+			return err
+		}
+
+		if _, err := r.w.Write(r.to); err != nil {
+			return err
+		}
+
+		buf = buf[i+len(r.from):]
+	}
+
+	// Hold back possible partial match at the end
+	n := len(buf)
+	if !final {
+		n = max(n-len(r.from)+1, 0)
+	}
+
+	if n > 0 {
+		if _, err := r.w.Write(buf[:n]); err != nil {
+			return err
+		}
+	}
+
+	r.buf = r.buf[:copy(r.buf, buf[n:])]
+
+	return nil
+}
+
+// newReplaceWriters returns writer that applies all replacements in order before
+// writing to w and replace writers that must be flushed in the same order.
+func newReplaceWriters(w io.Writer, pairs []*replacePair) (io.Writer, []*replaceWriter) {
+	replacers := make([]*replaceWriter, len(pairs))
+
+	for i := len(pairs) - 1; i >= 0; i-- {
+		replacers[i] = newReplaceWriter(w, pairs[i].from, pairs[i].to)
+		w = replacers[i]
+	}
+
+	return w, replacers
+}
+
+func flushReplaceWriters(replacers []*replaceWriter) error {
+	for _, rw := range replacers {
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// replaceReader applies replacements in order to the data read from the reader.
+type replaceReader struct {
+	r         io.Reader
+	w         io.Writer
+	replacers []*replaceWriter
+	buf       bytes.Buffer
+	chunk     []byte
+	err       error
+}
+
+func newReplaceReader(r io.Reader, pairs []*replacePair) *replaceReader {
+	rr := &replaceReader{
+		r:     r,
+		chunk: make([]byte, 32<<10),
+	}
+
+	rr.w, rr.replacers = newReplaceWriters(&rr.buf, pairs)
+
+	return rr
+}
+
+// Read implements io.Reader.
+func (r *replaceReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 && r.err == nil {
+		n, err := r.r.Read(r.chunk)
+		if n > 0 {
+			if _, werr := r.w.Write(r.chunk[:n]); werr != nil {
+				return 0, werr
+			}
+		}
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				if ferr := flushReplaceWriters(r.replacers); ferr != nil {
+					return 0, ferr
+				}
+			}
+
+			r.err = err
+		}
+	}
+
+	if r.buf.Len() > 0 {
+		return r.buf.Read(p)
+	}
+
+	return 0, r.err
+}
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// rewriteCSS rewrites upstream URLs in CSS url() references.
+//
+// Stylesheet is processed in chunks ending with ')' so references longer than
+// the read buffer, ex. large inline data URLs, are passed unchanged.
+func rewriteCSS(dst io.Writer, src io.Reader, u *urlRewriter) error {
+	br := bufio.NewReaderSize(src, 32<<10)
+
+	var buf []byte
+
+	for {
+		chunk, err := br.ReadSlice(')')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			if _, err := dst.Write(chunk); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		buf = rewriteCSSURLs(buf[:0], chunk, u)
+		if _, werr := dst.Write(buf); werr != nil {
+			return werr
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// rewriteCSSURLs appends CSS to dst with upstream URLs in url() references rewritten.
+func rewriteCSSURLs(dst, css []byte, u *urlRewriter) []byte {
+	if !u.enabled {
+		return append(dst, css...)
+	}
+
+	for {
+		i := indexFold(css, []byte("url("))
+		if i == -1 {
+			break
+		}
+
+		i += len("url(")
+		dst = append(dst, css[:i]...)
+		css = css[i:]
+
+		// Skip whitespace and optional quote
+		j := 0
+		for j < len(css) && isHTMLSpace(css[j]) {
+			j++
+		}
+
+		end := byte(')')
+		if j < len(css) && (css[j] == '"' || css[j] == '\'') {
+			end = css[j]
+			j++
+		}
+
+		dst = append(dst, css[:j]...)
+		css = css[j:]
+
+		k := bytes.IndexByte(css, end)
+		if k == -1 {
+			continue
+		}
+
+		v := bytes.TrimRight(css[:k], " \t\r\n\f")
+		dst = append(dst, u.URL(v)...)
+		css = css[len(v):]
+	}
+
+	return append(dst, css...)
+}
+
+// indexFold returns the index of the first case-insensitive instance of ASCII sep in s.
+func indexFold(s, sep []byte) int {
+	for i := 0; i+len(sep) <= len(s); i++ {
+		if bytes.EqualFold(s[i:i+len(sep)], sep) {
+			return i
+		}
+	}
+
+	return -1
+}
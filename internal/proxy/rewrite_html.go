@@ -0,0 +1,418 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+var errNoTag = errors.New("not a tag")
+
+const (
+	// maxTagSize is the maximum size of HTML tag that is parsed. Larger tags are passed unchanged.
+	maxTagSize = 64 << 10
+	// maxStyleSize is the maximum size of inline style element content that is rewritten.
+	maxStyleSize = 1 << 20
+)
+
+// rewriteHTML rewrites upstream URLs in href, src, action, formaction, poster and
+// srcset attributes, in CSS url() references of style attributes and elements and
+// anywhere in the meta element content attribute and inline script elements.
+func rewriteHTML(dst io.Writer, src io.Reader, u *urlRewriter) error {
+	br := bufio.NewReaderSize(src, 32<<10)
+	tag := make([]byte, 0, 1024)
+
+	for {
+		text, err := br.ReadSlice('<')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			if _, err := dst.Write(text); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err != nil {
+			if _, werr := dst.Write(text); werr != nil {
+				return werr
+			}
+
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return err
+		}
+
+		if _, err := dst.Write(text[:len(text)-1]); err != nil {
+			return err
+		}
+
+		// Comments can contain anything so copy them as is
+		if p, _ := br.Peek(3); bytes.Equal(p, []byte("!--")) {
+			if err := copyHTMLComment(dst, br); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		tag, err = readHTMLTag(append(tag[:0], '<'), br)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, errNoTag) {
+			return err
+		}
+
+		// Incomplete or too large tag is passed unchanged
+		if err != nil {
+			if _, err := dst.Write(tag); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		name := htmlTagName(tag)
+
+		if _, err := dst.Write(rewriteHTMLTag(tag, u)); err != nil {
+			return err
+		}
+
+		if bytes.HasSuffix(tag, []byte("/>")) {
+			continue
+		}
+
+		switch {
+		case bytes.EqualFold(name, []byte("style")):
+			err = rewriteHTMLStyle(dst, br, u)
+		case bytes.EqualFold(name, []byte("script")) && u.enabled:
+			err = rewriteHTMLScript(dst, br, u)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// copyHTMLComment copies comment until its end "-->".
+func copyHTMLComment(dst io.Writer, br *bufio.Reader) error {
+	if _, err := dst.Write([]byte("<")); err != nil {
+		return err
+	}
+
+	// Number of dashes at the end of data copied so far
+	dashes := 0
+
+	for {
+		chunk, err := br.ReadSlice('>')
+		if _, werr := dst.Write(chunk); werr != nil {
+			return werr
+		}
+
+		switch {
+		case err == nil:
+			if trailingDashes(chunk[:len(chunk)-1], dashes) >= 2 {
+				return nil
+			}
+
+			dashes = 0
+		case errors.Is(err, bufio.ErrBufferFull):
+			dashes = trailingDashes(chunk, dashes)
+		case errors.Is(err, io.EOF):
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+func trailingDashes(b []byte, prev int) int {
+	n := len(b) - len(bytes.TrimRight(b, "-"))
+	if n == len(b) {
+		n += prev
+	}
+
+	return n
+}
+
+// readHTMLTag reads the tag until the closing '>' outside of quoted attribute values.
+func readHTMLTag(tag []byte, br *bufio.Reader) ([]byte, error) {
+	var quote byte
+
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return tag, err
+		}
+
+		// Tag name must start with a letter or be an end tag, comment or declaration
+		if len(tag) == 1 && !isHTMLTagStart(c) {
+			_ = br.UnreadByte()
+
+			return tag, errNoTag
+		}
+
+		tag = append(tag, c)
+
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return tag, nil
+		}
+
+		if len(tag) >= maxTagSize {
+			return tag, errNoTag
+		}
+	}
+}
+
+func isHTMLTagStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '/' || c == '!' || c == '?'
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// htmlTagName returns the name of the start tag or nil for end tags and declarations.
+func htmlTagName(tag []byte) []byte {
+	i := 1
+	for i < len(tag) && (tag[i] >= 'a' && tag[i] <= 'z' || tag[i] >= 'A' && tag[i] <= 'Z' || tag[i] >= '0' && tag[i] <= '9' || tag[i] == '-') {
+		i++
+	}
+
+	return tag[1:i]
+}
+
+// rewriteHTMLTag rewrites URL attributes of the start tag.
+func rewriteHTMLTag(tag []byte, u *urlRewriter) []byte {
+	name := htmlTagName(tag)
+	if len(name) == 0 || !u.enabled {
+		return tag
+	}
+
+	var out []byte
+
+	last := 0
+	i := 1 + len(name)
+
+	for i < len(tag) {
+		// Attribute name
+		for i < len(tag) && (isHTMLSpace(tag[i]) || tag[i] == '/') {
+			i++
+		}
+
+		start := i
+		for i < len(tag) && !isHTMLSpace(tag[i]) && tag[i] != '=' && tag[i] != '>' && tag[i] != '/' {
+			i++
+		}
+
+		attr := tag[start:i]
+		if len(attr) == 0 {
+			break
+		}
+
+		for i < len(tag) && isHTMLSpace(tag[i]) {
+			i++
+		}
+
+		if i >= len(tag) || tag[i] != '=' {
+			continue
+		}
+
+		i++
+
+		for i < len(tag) && isHTMLSpace(tag[i]) {
+			i++
+		}
+
+		// Attribute value
+		var vs, ve int
+
+		if i < len(tag) && (tag[i] == '"' || tag[i] == '\'') {
+			q := tag[i]
+
+			vs = i + 1
+
+			j := bytes.IndexByte(tag[vs:], q)
+			if j == -1 {
+				break
+			}
+
+			ve = vs + j
+			i = ve + 1
+		} else {
+			vs = i
+			for i < len(tag) && !isHTMLSpace(tag[i]) && tag[i] != '>' {
+				i++
+			}
+
+			ve = i
+		}
+
+		v := tag[vs:ve]
+
+		var nv []byte
+
+		switch {
+		case bytes.EqualFold(attr, []byte("href")), bytes.EqualFold(attr, []byte("src")),
+			bytes.EqualFold(attr, []byte("action")), bytes.EqualFold(attr, []byte("formaction")),
+			bytes.EqualFold(attr, []byte("poster")):
+			// Keep whitespace around the URL
+			tv := bytes.TrimSpace(v)
+			vs += bytes.Index(v, tv)
+			ve = vs + len(tv)
+			v, nv = tv, u.URL(tv)
+		case bytes.EqualFold(attr, []byte("srcset")):
+			nv = rewriteSrcset(v, u)
+		case bytes.EqualFold(attr, []byte("style")):
+			nv = rewriteCSSURLs(nil, v, u)
+		case bytes.EqualFold(attr, []byte("content")) && bytes.EqualFold(name, []byte("meta")):
+			nv = u.Text(v)
+		default:
+			continue
+		}
+
+		if bytes.Equal(nv, v) {
+			continue
+		}
+
+		out = append(append(out, tag[last:vs]...), nv...)
+		last = ve
+	}
+
+	if out == nil {
+		return tag
+	}
+
+	return append(out, tag[last:]...)
+}
+
+// rewriteSrcset rewrites URLs of image candidates in srcset attribute value.
+func rewriteSrcset(v []byte, u *urlRewriter) []byte {
+	out := make([]byte, 0, len(v))
+
+	for i, c := range bytes.Split(v, []byte(",")) {
+		if i > 0 {
+			out = append(out, ',')
+		}
+
+		// Keep whitespace around the URL
+		start := 0
+		for start < len(c) && isHTMLSpace(c[start]) {
+			start++
+		}
+
+		end := start
+		for end < len(c) && !isHTMLSpace(c[end]) {
+			end++
+		}
+
+		out = append(out, c[:start]...)
+		out = append(out, u.URL(c[start:end])...)
+		out = append(out, c[end:]...)
+	}
+
+	return out
+}
+
+// rewriteHTMLStyle rewrites CSS URLs in the style element content until the closing style tag.
+func rewriteHTMLStyle(dst io.Writer, br *bufio.Reader, u *urlRewriter) error {
+	var css []byte
+
+	for {
+		chunk, err := br.ReadSlice('<')
+		css = append(css, chunk...)
+
+		if err == nil {
+			// Check for closing style tag
+			p, _ := br.Peek(6)
+			if len(p) == 6 && p[0] == '/' && bytes.EqualFold(p[1:], []byte("style")) {
+				// Unread '<' by writing it with the closing tag later
+				css = css[:len(css)-1]
+
+				if _, err := dst.Write(rewriteCSSURLs(nil, css, u)); err != nil {
+					return err
+				}
+
+				_, err := dst.Write([]byte("<"))
+
+				return err
+			}
+		}
+
+		if err != nil && !errors.Is(err, bufio.ErrBufferFull) {
+			if _, werr := dst.Write(rewriteCSSURLs(nil, css, u)); werr != nil {
+				return werr
+			}
+
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return err
+		}
+
+		// Too large style element is passed unchanged
+		if len(css) >= maxStyleSize {
+			_, err := dst.Write(css)
+
+			return err
+		}
+	}
+}
+
+// rewriteHTMLScript replaces upstream URLs anywhere in the script element content until the closing script tag.
+func rewriteHTMLScript(dst io.Writer, br *bufio.Reader, u *urlRewriter) error {
+	w, replacers := newReplaceWriters(dst, u.textPairs())
+
+	for {
+		chunk, err := br.ReadSlice('<')
+		if err != nil {
+			if _, werr := w.Write(chunk); werr != nil {
+				return werr
+			}
+
+			if errors.Is(err, bufio.ErrBufferFull) {
+				continue
+			}
+
+			if ferr := flushReplaceWriters(replacers); ferr != nil {
+				return ferr
+			}
+
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return err
+		}
+
+		// Chunk must be written before peeking as it can be overwritten
+		if _, err := w.Write(chunk[:len(chunk)-1]); err != nil {
+			return err
+		}
+
+		// Check for closing script tag
+		p, _ := br.Peek(7)
+		if len(p) == 7 && p[0] == '/' && bytes.EqualFold(p[1:], []byte("script")) {
+			if err := flushReplaceWriters(replacers); err != nil {
+				return err
+			}
+
+			_, err := dst.Write([]byte("<"))
+
+			return err
+		}
+
+		if _, err := w.Write([]byte("<")); err != nil {
+			return err
+		}
+	}
+}
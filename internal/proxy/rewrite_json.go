@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// maxJSONStringSize is the maximum size of JSON string value that is rewritten.
+const maxJSONStringSize = 1 << 20
+
+// rewriteJSON rewrites upstream URLs in JSON string values. Object keys are never rewritten.
+func rewriteJSON(dst io.Writer, src io.Reader, u *urlRewriter) error {
+	br := bufio.NewReaderSize(src, 32<<10)
+	bw := bufio.NewWriter(dst)
+
+	// Stack of nested containers, true for objects
+	var stack []bool
+
+	key := false
+
+	for {
+		c, err := br.ReadByte()
+		if errors.Is(err, io.EOF) {
+			return bw.Flush()
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := bw.WriteByte(c); err != nil {
+			return err
+		}
+
+		switch c {
+		case '{':
+			stack = append(stack, true)
+			key = true
+		case '[':
+			stack = append(stack, false)
+			key = false
+		case '}', ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+
+			key = false
+		case ',':
+			key = len(stack) > 0 && stack[len(stack)-1]
+		case ':':
+			key = false
+		case '"':
+			if err := rewriteJSONString(bw, br, u, key); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// rewriteJSONString copies JSON string after the opening quote rewriting it if it is not an object key.
+func rewriteJSONString(bw *bufio.Writer, br *bufio.Reader, u *urlRewriter, key bool) error {
+	var s []byte
+
+	escaped := false
+
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			_, _ = bw.Write(s)
+
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return err
+		}
+
+		if c == '"' && !escaped {
+			if !key {
+				s = u.Text(s)
+			}
+
+			if _, err := bw.Write(s); err != nil {
+				return err
+			}
+
+			return bw.WriteByte('"')
+		}
+
+		escaped = c == '\\' && !escaped
+		s = append(s, c)
+
+		// Too large string is passed unchanged
+		if len(s) >= maxJSONStringSize {
+			if _, err := bw.Write(s); err != nil {
+				return err
+			}
+
+			key = true
+			s = s[:0]
+		}
+	}
+}
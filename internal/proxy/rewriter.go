@@ -1,19 +1,14 @@
 package proxy
 
 import (
+	"bufio"
 	"bytes"
+	"io"
 
 	"azugo.io/core/http"
-	"github.com/valyala/bytebufferpool"
 	"github.com/valyala/fasthttp"
 )
 
-var (
-	contentEncodingGzip    = []byte("gzip")
-	contentEncodingDeflate = []byte("deflate")
-	contentEncodingBr      = []byte("br")
-)
-
 var (
 	contentTypePlain  = []byte(http.ContentTypeTextPlain)
 	contentTypeHTML   = []byte(http.ContentTypeTextHTML)
@@ -26,13 +21,28 @@ var (
 	contentTypeXHTML  = []byte("application/xhtml")
 )
 
+// RewriteFunc rewrites the decoded response body read from src writing the result to dst.
+//
+// URL function returns the URL pointing to the upstream rewritten to point to the proxy
+// or the URL unchanged otherwise.
+type RewriteFunc func(dst io.Writer, src io.Reader, url func(u []byte) []byte) error
+
 type replacePair struct {
 	from, to []byte
 }
 
+type contentRewriter struct {
+	contentType []byte
+	// fn is the custom rewrite function.
+	fn RewriteFunc
+	// builtin is the built-in content aware rewrite function. Upstream URLs are replaced
+	// anywhere in the body if neither fn nor builtin is set.
+	builtin func(dst io.Writer, src io.Reader, u *urlRewriter) error
+}
+
 // BodyRewriter rewrites response bodies for proxied requests.
 type BodyRewriter struct {
-	contentTypes [][]byte
+	rewriters    []*contentRewriter
 	replaceRules []*replacePair
 
 	BasePath       string
@@ -42,24 +52,22 @@ type BodyRewriter struct {
 // NewBodyRewriter creates a new BodyRewriter.
 func NewBodyRewriter() *BodyRewriter {
 	return &BodyRewriter{
-		contentTypes: [][]byte{
-			contentTypePlain,
-			contentTypeHTML,
-			contentTypeCSS,
-			contentTypeJS,
-			contentTypeJSAlt,
-			contentTypeJSXAlt,
-			contentTypeJSON,
-			contentTypeXML,
-			contentTypeXHTML,
+		rewriters: []*contentRewriter{
+			{contentType: contentTypePlain},
+			{contentType: contentTypeHTML, builtin: rewriteHTML},
+			{contentType: contentTypeCSS, builtin: rewriteCSS},
+			{contentType: contentTypeJS},
+			{contentType: contentTypeJSAlt},
+			{contentType: contentTypeJSXAlt},
+			{contentType: contentTypeJSON, builtin: rewriteJSON},
+			{contentType: contentTypeXML},
+			{contentType: contentTypeXHTML, builtin: rewriteHTML},
 		},
 		RewriteBaseURL: true,
 		replaceRules:   make([]*replacePair, 0),
 	}
 }
 
-var responseBodyPool bytebufferpool.Pool
-
 // AddReplace adds a replacement in response body from upstream.
 func (r *BodyRewriter) AddReplace(from, to []byte) {
 	if r.replaceRules == nil {
@@ -69,126 +77,215 @@ func (r *BodyRewriter) AddReplace(from, to []byte) {
 	r.replaceRules = append(r.replaceRules, &replacePair{from, to})
 }
 
-func getDecodedBody(resp *fasthttp.Response) []byte {
-	enc := resp.Header.Peek(http.HeaderContentEncoding)
-	if bytes.Equal(enc, contentEncodingGzip) {
-		b, err := resp.BodyGunzip()
-		if err != nil {
-			return nil
-		}
+// Register registers the rewrite function for the content type. Content type is
+// matched by prefix and registered functions take precedence over the built-in ones.
+func (r *BodyRewriter) Register(contentType string, fn RewriteFunc) {
+	r.rewriters = append([]*contentRewriter{{contentType: []byte(contentType), fn: fn}}, r.rewriters...)
+}
 
-		return b
+func trimScheme(url []byte) []byte {
+	i := bytes.IndexByte(url, ':')
+	if i == -1 {
+		return url
 	}
 
-	if bytes.Equal(enc, contentEncodingDeflate) {
-		b, err := resp.BodyInflate()
-		if err != nil {
-			return nil
-		}
+	return url[i+1:]
+}
 
-		return b
+// Enabled checks if the rewriter is enabled.
+func (r *BodyRewriter) Enabled() bool {
+	if len(r.replaceRules) > 0 || r.RewriteBaseURL {
+		return true
 	}
 
-	if bytes.Equal(enc, contentEncodingBr) {
-		b, err := resp.BodyUnbrotli()
-		if err != nil {
+	for _, cr := range r.rewriters {
+		if cr.fn != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rewriter returns the rewriter for the content type.
+func (r *BodyRewriter) rewriter(ct []byte) *contentRewriter {
+	for _, cr := range r.rewriters {
+		if !bytes.HasPrefix(ct, cr.contentType) {
+			continue
+		}
+
+		if cr.fn == nil && len(r.replaceRules) == 0 && !r.RewriteBaseURL {
 			return nil
 		}
 
-		return b
+		return cr
 	}
 
-	return resp.Body()
+	return nil
 }
 
-func setEncodedBody(resp *fasthttp.Response, body []byte) {
-	if len(body) == 0 {
-		resp.ResetBody()
+// Rewrite returns the rewritten response body read from the body or nil if the
+// response is not rewritten. Rewriting is done while the returned body is read
+// so the response body is never fully buffered.
+//
+// Body is closed when rewriting is done if it implements io.Closer. Returned
+// reader must be closed to abort rewriting if it is not read until the end.
+func (r *BodyRewriter) Rewrite(baseURL, upstream []byte, header *fasthttp.ResponseHeader, body io.Reader) io.ReadCloser {
+	if !r.Enabled() {
+		return nil
+	}
+
+	cr := r.rewriter(header.ContentType())
+	if cr == nil {
+		return nil
+	}
 
-		return
+	enc := contentEncoding(header.ContentEncoding())
+	if enc == encodingUnsupported {
+		return nil
 	}
 
-	enc := resp.Header.Peek(http.HeaderContentEncoding)
-	if bytes.Equal(enc, contentEncodingGzip) {
-		w := responseBodyPool.Get()
-		body = fasthttp.AppendGzipBytes(w.B, body)
-		resp.SetBody(body)
-		responseBodyPool.Put(w)
+	u := newURLRewriter(r.RewriteBaseURL, baseURL, upstream)
+
+	pr, pw := io.Pipe()
 
-		return
+	go func() {
+		err := r.rewrite(pw, body, enc, cr, u)
+
+		if c, ok := body.(io.Closer); ok {
+			_ = c.Close()
+		}
+
+		_ = pw.CloseWithError(err)
+	}()
+
+	return pr
+}
+
+func (r *BodyRewriter) rewrite(w io.Writer, body io.Reader, enc encoding, cr *contentRewriter, u *urlRewriter) error {
+	src, err := newDecoder(enc, body)
+	if err != nil {
+		return err
 	}
+	defer src.Close()
 
-	if bytes.Equal(enc, contentEncodingDeflate) {
-		w := responseBodyPool.Get()
-		body = fasthttp.AppendDeflateBytes(w.B, body)
-		resp.SetBody(body)
-		responseBodyPool.Put(w)
+	out, err := newEncoder(enc, w)
+	if err != nil {
+		return err
+	}
 
-		return
+	bw := bufio.NewWriterSize(out, 32<<10)
+
+	// Replacements are applied in order they were added before the upstream URLs are rewritten
+	var in io.Reader = src
+	if len(r.replaceRules) > 0 {
+		in = newReplaceReader(src, r.replaceRules)
 	}
 
-	if bytes.Equal(enc, contentEncodingBr) {
-		w := responseBodyPool.Get()
-		body = fasthttp.AppendBrotliBytes(w.B, body)
-		resp.SetBody(body)
-		responseBodyPool.Put(w)
+	var (
+		dst       io.Writer = bw
+		replacers []*replaceWriter
+	)
 
-		return
+	if cr.fn == nil && cr.builtin == nil && u.enabled {
+		dst, replacers = newReplaceWriters(bw, u.textPairs())
 	}
 
-	resp.SetBody(body)
-}
+	switch {
+	case cr.fn != nil:
+		err = cr.fn(dst, in, u.URL)
+	case cr.builtin != nil:
+		err = cr.builtin(dst, in, u)
+	default:
+		_, err = io.Copy(dst, in)
+	}
 
-func trimScheme(url []byte) []byte {
-	i := bytes.IndexByte(url, ':')
-	if i == -1 {
-		return url
+	if err != nil {
+		return err
 	}
 
-	return url[i+1:]
+	if err := flushReplaceWriters(replacers); err != nil {
+		return err
+	}
+
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	return out.Close()
 }
 
-// Enabled checks if the rewriter is enabled.
-func (r *BodyRewriter) Enabled() bool {
-	return len(r.replaceRules) > 0 || r.RewriteBaseURL
+// urlRewriter rewrites upstream URLs to the proxy URLs.
+type urlRewriter struct {
+	enabled    bool
+	from, to   []byte
+	fromNoProt []byte
+	toNoProt   []byte
 }
 
-// RewriteResponse rewrites response body.
-func (r *BodyRewriter) RewriteResponse(baseURL, upstream []byte, resp *fasthttp.Response) {
-	if !r.Enabled() {
-		return
+func newURLRewriter(enabled bool, baseURL, upstream []byte) *urlRewriter {
+	from := bytes.TrimRight(upstream, "/")
+	to := bytes.TrimRight(baseURL, "/")
+
+	return &urlRewriter{
+		enabled:    enabled && len(from) > 0,
+		from:       from,
+		to:         to,
+		fromNoProt: trimScheme(from),
+		toNoProt:   trimScheme(to),
 	}
+}
 
-	ct := resp.Header.ContentType()
-	isRewritable := false
+// hasURLPrefix checks if the URL starts with the prefix followed by path, query or fragment.
+func hasURLPrefix(u, prefix []byte) bool {
+	if !bytes.HasPrefix(u, prefix) {
+		return false
+	}
 
-	for _, ctb := range r.contentTypes {
-		if bytes.HasPrefix(ct, ctb) {
-			isRewritable = true
+	return len(u) == len(prefix) || bytes.IndexByte([]byte("/?#"), u[len(prefix)]) != -1
+}
 
-			break
-		}
+// URL rewrites absolute or scheme relative upstream URL to the proxy URL.
+func (r *urlRewriter) URL(u []byte) []byte {
+	if !r.enabled {
+		return u
 	}
 
-	if !isRewritable {
-		return
+	if hasURLPrefix(u, r.from) {
+		return append(append(make([]byte, 0, len(r.to)+len(u)-len(r.from)), r.to...), u[len(r.from):]...)
 	}
 
-	body := getDecodedBody(resp)
-	if len(body) == 0 {
-		return
+	if bytes.HasPrefix(u, []byte("//")) && hasURLPrefix(u, r.fromNoProt) {
+		return append(append(make([]byte, 0, len(r.toNoProt)+len(u)-len(r.fromNoProt)), r.toNoProt...), u[len(r.fromNoProt):]...)
 	}
 
-	for _, v := range r.replaceRules {
-		body = bytes.ReplaceAll(body, v.from, v.to)
+	return u
+}
+
+// textPairs returns replacements of upstream URLs anywhere in the text.
+func (r *urlRewriter) textPairs() []*replacePair {
+	return []*replacePair{
+		{r.from, r.to},
+		{r.fromNoProt, r.toNoProt},
+	}
+}
+
+// Text replaces upstream URLs anywhere in the text including URLs with escaped slashes.
+func (r *urlRewriter) Text(s []byte) []byte {
+	if !r.enabled {
+		return s
 	}
 
-	if r.RewriteBaseURL {
-		baseURL = bytes.TrimRight(baseURL, "/")
-		upstream = bytes.TrimRight(upstream, "/")
-		body = bytes.ReplaceAll(body, upstream, baseURL)
-		body = bytes.ReplaceAll(body, trimScheme(upstream), trimScheme(baseURL))
+	for _, p := range r.textPairs() {
+		if bytes.Contains(s, p.from) {
+			s = bytes.ReplaceAll(s, p.from, p.to)
+		}
+
+		from := bytes.ReplaceAll(p.from, []byte("/"), []byte(`\/`))
+		if bytes.Contains(s, from) {
+			s = bytes.ReplaceAll(s, from, bytes.ReplaceAll(p.to, []byte("/"), []byte(`\/`)))
+		}
 	}
 
-	setEncodedBody(resp, body)
+	return s
 }
@@ -0,0 +1,258 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/andybalholm/brotli"
+	"github.com/go-quicktest/qt"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	testUpstream = "http://upstream:8080"
+	testBaseURL  = "https://example.com/app"
+)
+
+func rewrite(t *testing.T, r *BodyRewriter, contentType, encoding string, body io.Reader) (string, bool) {
+	t.Helper()
+
+	var h fasthttp.ResponseHeader
+
+	h.SetContentType(contentType)
+
+	if len(encoding) > 0 {
+		h.SetContentEncoding(encoding)
+	}
+
+	rc := r.Rewrite([]byte(testBaseURL), []byte(testUpstream), &h, body)
+	if rc == nil {
+		return "", false
+	}
+	defer rc.Close()
+
+	b, err := io.ReadAll(rc)
+	qt.Assert(t, qt.IsNil(err))
+
+	return string(b), true
+}
+
+func TestRewriteHTML(t *testing.T) {
+	tests := []struct {
+		name, body, expected string
+	}{
+		{
+			name:     "href",
+			body:     `<a class="x" href="http://upstream:8080/page?a=1">http://upstream:8080/page</a>`,
+			expected: `<a class="x" href="https://example.com/app/page?a=1">http://upstream:8080/page</a>`,
+		},
+		{
+			name:     "unquoted and scheme relative",
+			body:     `<img src=//upstream:8080/img.png alt='http://upstream:8080'>`,
+			expected: `<img src=//example.com/app/img.png alt='http://upstream:8080'>`,
+		},
+		{
+			name:     "form action",
+			body:     `<FORM ACTION = " http://upstream:8080 " method=post></FORM>`,
+			expected: `<FORM ACTION = " https://example.com/app " method=post></FORM>`,
+		},
+		{
+			name:     "srcset",
+			body:     `<img srcset="http://upstream:8080/a.png 1x, http://upstream:8080/b.png 2x">`,
+			expected: `<img srcset="https://example.com/app/a.png 1x, https://example.com/app/b.png 2x">`,
+		},
+		{
+			name:     "style attribute",
+			body:     `<div style="background: url('http://upstream:8080/bg.png')"></div>`,
+			expected: `<div style="background: url('https://example.com/app/bg.png')"></div>`,
+		},
+		{
+			name:     "style element",
+			body:     `<style>body { background: URL(http://upstream:8080/bg.png) } a < b</style><a href="http://upstream:8080/">`,
+			expected: `<style>body { background: URL(https://example.com/app/bg.png) } a < b</style><a href="https://example.com/app/">`,
+		},
+		{
+			name:     "script element",
+			body:     `<script>var a = "http://upstream:8080/api", b = '//upstream:8080/x'; if (1 < 2) {}</script><a href="http://upstream:8080/">`,
+			expected: `<script>var a = "https://example.com/app/api", b = '//example.com/app/x'; if (1 < 2) {}</script><a href="https://example.com/app/">`,
+		},
+		{
+			name:     "meta content",
+			body:     `<meta http-equiv="refresh" content="0; url=http://upstream:8080/login"><meta name="x" value="http://upstream:8080">`,
+			expected: `<meta http-equiv="refresh" content="0; url=https://example.com/app/login"><meta name="x" value="http://upstream:8080">`,
+		},
+		{
+			name:     "comment",
+			body:     `<!-- <a href="http://upstream:8080/"> --><a href="http://upstream:8080/x">`,
+			expected: `<!-- <a href="http://upstream:8080/"> --><a href="https://example.com/app/x">`,
+		},
+		{
+			name:     "other host",
+			body:     `<a href="http://upstream:80801/">1 < 2 > 0</a>`,
+			expected: `<a href="http://upstream:80801/">1 < 2 > 0</a>`,
+		},
+		{
+			name:     "unterminated",
+			body:     `<a href="http://upstream:8080/`,
+			expected: `<a href="http://upstream:8080/`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, ok := rewrite(t, NewBodyRewriter(), "text/html; charset=utf-8", "", iotest.OneByteReader(bytes.NewBufferString(tt.body)))
+			qt.Assert(t, qt.IsTrue(ok))
+			qt.Check(t, qt.Equals(body, tt.expected))
+		})
+	}
+}
+
+func TestRewriteCSS(t *testing.T) {
+	body, ok := rewrite(t, NewBodyRewriter(), "text/css", "", bytes.NewBufferString(
+		`@font-face { src: url("http://upstream:8080/font.woff") } /* http://upstream:8080 */ a { b: url( 'http://upstream:8080/a.png' ) }`))
+	qt.Assert(t, qt.IsTrue(ok))
+	qt.Check(t, qt.Equals(body,
+		`@font-face { src: url("https://example.com/app/font.woff") } /* http://upstream:8080 */ a { b: url( 'https://example.com/app/a.png' ) }`))
+}
+
+func TestRewriteJSON(t *testing.T) {
+	body, ok := rewrite(t, NewBodyRewriter(), "application/json", "", iotest.OneByteReader(bytes.NewBufferString(
+		`{"http://upstream:8080/key": "http://upstream:8080/value", "list": ["http:\/\/upstream:8080\/a", 1, {"q": "say \"http://upstream:8080\""}]}`)))
+	qt.Assert(t, qt.IsTrue(ok))
+	qt.Check(t, qt.Equals(body,
+		`{"http://upstream:8080/key": "https://example.com/app/value", "list": ["https:\/\/example.com\/app\/a", 1, {"q": "say \"https://example.com/app\""}]}`))
+}
+
+func TestRewriteText(t *testing.T) {
+	r := NewBodyRewriter()
+	r.AddReplace([]byte("Hello"), []byte("Hi"))
+
+	body, ok := rewrite(t, r, "text/plain", "", iotest.OneByteReader(bytes.NewBufferString(
+		"Hello from http://upstream:8080/x and //upstream:8080/y. Hello!")))
+	qt.Assert(t, qt.IsTrue(ok))
+	qt.Check(t, qt.Equals(body, "Hi from https://example.com/app/x and //example.com/app/y. Hi!"))
+}
+
+func TestRewriteReplaceOrder(t *testing.T) {
+	r := NewBodyRewriter()
+	r.AddReplace([]byte("http://internal:9090"), []byte("http://upstream:8080"))
+	r.AddReplace([]byte("https://example.com/app"), []byte("https://wrong"))
+
+	body, ok := rewrite(t, r, "text/html", "", iotest.OneByteReader(bytes.NewBufferString(
+		`<a href="http://internal:9090/x">http://internal:9090</a>`)))
+	qt.Assert(t, qt.IsTrue(ok))
+	qt.Check(t, qt.Equals(body, `<a href="https://example.com/app/x">http://upstream:8080</a>`))
+}
+
+func TestRewriteNotRewritable(t *testing.T) {
+	_, ok := rewrite(t, NewBodyRewriter(), "image/png", "", bytes.NewBufferString("http://upstream:8080"))
+	qt.Check(t, qt.IsFalse(ok))
+
+	_, ok = rewrite(t, NewBodyRewriter(), "text/html", "compress", bytes.NewBufferString("http://upstream:8080"))
+	qt.Check(t, qt.IsFalse(ok))
+
+	r := NewBodyRewriter()
+	r.RewriteBaseURL = false
+
+	_, ok = rewrite(t, r, "text/html", "", bytes.NewBufferString("http://upstream:8080"))
+	qt.Check(t, qt.IsFalse(ok))
+}
+
+func TestRewriteCustom(t *testing.T) {
+	r := NewBodyRewriter()
+	r.RewriteBaseURL = false
+	r.Register("text/html", func(dst io.Writer, src io.Reader, url func(u []byte) []byte) error {
+		b, err := io.ReadAll(src)
+		if err != nil {
+			return err
+		}
+
+		_, err = dst.Write(bytes.ToUpper(url(b)))
+
+		return err
+	})
+
+	body, ok := rewrite(t, r, "text/html", "", bytes.NewBufferString("<p>"))
+	qt.Assert(t, qt.IsTrue(ok))
+	qt.Check(t, qt.Equals(body, "<P>"))
+}
+
+func TestRewriteEncoding(t *testing.T) {
+	const (
+		src      = `<a href="http://upstream:8080/page">`
+		expected = `<a href="https://example.com/app/page">`
+	)
+
+	tests := []struct {
+		encoding string
+		encode   func(w io.Writer) io.WriteCloser
+		decode   func(r io.Reader) io.Reader
+	}{
+		{
+			encoding: "gzip",
+			encode:   func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+			decode: func(r io.Reader) io.Reader {
+				gr, err := gzip.NewReader(r)
+				qt.Assert(t, qt.IsNil(err))
+
+				return gr
+			},
+		},
+		{
+			encoding: "br",
+			encode:   func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+			decode:   func(r io.Reader) io.Reader { return brotli.NewReader(r) },
+		},
+		{
+			encoding: "zstd",
+			encode: func(w io.Writer) io.WriteCloser {
+				zw, err := zstd.NewWriter(w)
+				qt.Assert(t, qt.IsNil(err))
+
+				return zw
+			},
+			decode: func(r io.Reader) io.Reader {
+				zr, err := zstd.NewReader(r)
+				qt.Assert(t, qt.IsNil(err))
+
+				return zr
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			w := tt.encode(&buf)
+			_, err := w.Write([]byte(src))
+			qt.Assert(t, qt.IsNil(err))
+			qt.Assert(t, qt.IsNil(w.Close()))
+
+			body, ok := rewrite(t, NewBodyRewriter(), "text/html", tt.encoding, &buf)
+			qt.Assert(t, qt.IsTrue(ok))
+
+			b, err := io.ReadAll(tt.decode(bytes.NewBufferString(body)))
+			qt.Assert(t, qt.IsNil(err))
+			qt.Check(t, qt.Equals(string(b), expected))
+		})
+	}
+}
+
+func TestReplaceWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := newReplaceWriter(&buf, []byte("abc"), []byte("X"))
+
+	for _, c := range []byte("aabcab abcabc ab") {
+		_, err := w.Write([]byte{c})
+		qt.Assert(t, qt.IsNil(err))
+	}
+
+	qt.Assert(t, qt.IsNil(w.Flush()))
+	qt.Check(t, qt.Equals(buf.String(), "aXab XX ab"))
+}
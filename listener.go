@@ -0,0 +1,242 @@
+package azugo
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"azugo.io/azugo/config"
+)
+
+// Environment variables set by systemd for socket activated services.
+const (
+	envListenPID     = "LISTEN_PID"
+	envListenFDs     = "LISTEN_FDS"
+	envListenFDNames = "LISTEN_FDNAMES"
+
+	// listenFDsStart is the first file descriptor passed by systemd.
+	listenFDsStart = 3
+)
+
+// inheritedListeners are the sockets passed by systemd socket activation.
+type inheritedListeners struct {
+	listeners []net.Listener
+	names     []string
+	used      []bool
+}
+
+// systemdListeners returns listeners for the sockets passed by systemd socket activation
+// or nil if the process was not socket activated. Environment variables are unset so
+// that the sockets are not inherited by child processes.
+func systemdListeners() (*inheritedListeners, error) {
+	pid, err := strconv.Atoi(os.Getenv(envListenPID))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil //nolint:nilnil
+	}
+
+	n, err := strconv.Atoi(os.Getenv(envListenFDs))
+	if err != nil || n <= 0 {
+		return nil, nil //nolint:nilnil
+	}
+
+	names := strings.Split(os.Getenv(envListenFDNames), ":")
+
+	_ = os.Unsetenv(envListenPID)
+	_ = os.Unsetenv(envListenFDs)
+	_ = os.Unsetenv(envListenFDNames)
+
+	l := &inheritedListeners{
+		listeners: make([]net.Listener, 0, n),
+		names:     make([]string, 0, n),
+		used:      make([]bool, n),
+	}
+
+	for i := range n {
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+
+		f := os.NewFile(uintptr(listenFDsStart+i), name)
+
+		ln, err := net.FileListener(f)
+		_ = f.Close()
+
+		if err != nil {
+			l.Close()
+
+			return nil, fmt.Errorf("inherited socket %d is not a listener: %w", listenFDsStart+i, err)
+		}
+
+		l.listeners = append(l.listeners, ln)
+		l.names = append(l.names, name)
+	}
+
+	return l, nil
+}
+
+// take returns the listener with the given name or the first unused unnamed listener.
+// Sockets without a name in the socket unit are named "unknown" by systemd.
+// Returns nil if there are no listeners left.
+func (l *inheritedListeners) take(name string) net.Listener {
+	if l == nil {
+		return nil
+	}
+
+	idx := -1
+
+	for i, n := range l.names {
+		if !l.used[i] && n == name {
+			idx = i
+
+			break
+		}
+	}
+
+	if idx == -1 {
+		for i, n := range l.names {
+			if !l.used[i] && (n == "" || n == "unknown") {
+				idx = i
+
+				break
+			}
+		}
+	}
+
+	if idx == -1 {
+		return nil
+	}
+
+	l.used[idx] = true
+
+	return l.listeners[idx]
+}
+
+// Close closes the listeners that have not been used.
+func (l *inheritedListeners) Close() {
+	if l == nil {
+		return
+	}
+
+	for i, ln := range l.listeners {
+		if !l.used[i] {
+			_ = ln.Close()
+		}
+	}
+}
+
+// listenUnix listens on the unix domain socket setting its file mode and ownership.
+// Stale socket file left by the previous process is removed and the socket file
+// is removed when the listener is closed.
+func listenUnix(path string, sock config.ServerSocket) (net.Listener, error) {
+	mode, err := sock.FileMode()
+	if err != nil {
+		return nil, err
+	}
+
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+
+		// Socket that accepts connections is still in use
+		if conn, err := net.Dial("unix", path); err == nil {
+			_ = conn.Close()
+
+			return nil, fmt.Errorf("socket %s is already in use", path)
+		}
+
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if mode == 0 && len(sock.SocketOwner) == 0 && len(sock.SocketGroup) == 0 {
+		return net.Listen("unix", path)
+	}
+
+	ln, defaultMode, err := listenUnixRestricted(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode == 0 {
+		mode = defaultMode
+	}
+
+	if err := setSocketOwner(path, mode, sock); err != nil {
+		_ = ln.Close()
+
+		return nil, err
+	}
+
+	return ln, nil
+}
+
+// setSocketOwner changes the socket ownership and then sets its file mode.
+func setSocketOwner(path string, mode os.FileMode, sock config.ServerSocket) error {
+	uid, gid := -1, -1
+
+	if len(sock.SocketOwner) > 0 {
+		id, err := lookupID(sock.SocketOwner, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+
+			return u.Uid, nil
+		})
+		if err != nil {
+			return fmt.Errorf("invalid socket owner %q: %w", sock.SocketOwner, err)
+		}
+
+		uid = id
+	}
+
+	if len(sock.SocketGroup) > 0 {
+		id, err := lookupID(sock.SocketGroup, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+
+			return g.Gid, nil
+		})
+		if err != nil {
+			return fmt.Errorf("invalid socket group %q: %w", sock.SocketGroup, err)
+		}
+
+		gid = id
+	}
+
+	if uid != -1 || gid != -1 {
+		if err := os.Lchown(path, uid, gid); err != nil {
+			return err
+		}
+	}
+
+	return os.Chmod(path, mode)
+}
+
+// lookupID returns the numeric ID or looks up the ID by name.
+func lookupID(v string, lookup func(name string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(v); err == nil {
+		return id, nil
+	}
+
+	s, err := lookup(v)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, errors.New("not a numeric ID")
+	}
+
+	return id, nil
+}
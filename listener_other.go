@@ -0,0 +1,16 @@
+//go:build !unix
+
+package azugo
+
+import (
+	"net"
+	"os"
+)
+
+// listenUnixRestricted listens on the unix domain socket. File mode and ownership
+// of the socket are not enforced by the operating system.
+func listenUnixRestricted(path string) (net.Listener, os.FileMode, error) {
+	ln, err := net.Listen("unix", path)
+
+	return ln, 0o777, err
+}
@@ -0,0 +1,96 @@
+package azugo
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"azugo.io/azugo/config"
+	"github.com/go-quicktest/qt"
+)
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.sock")
+
+	ln, err := listenUnix(path, config.ServerSocket{SocketMode: "0660"})
+	qt.Assert(t, qt.IsNil(err))
+
+	fi, err := os.Stat(path)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(fi.Mode().Perm(), os.FileMode(0o660)))
+
+	// Socket in use is not replaced
+	_, err = listenUnix(path, config.ServerSocket{})
+	qt.Check(t, qt.ErrorMatches(err, "socket .* is already in use"))
+
+	// Stale socket file is removed
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	qt.Assert(t, qt.IsNil(ln.Close()))
+
+	ln, err = listenUnix(path, config.ServerSocket{})
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.IsNil(ln.Close()))
+
+	// Socket file is removed when the listener is closed
+	_, err = os.Lstat(path)
+	qt.Check(t, qt.ErrorIs(err, os.ErrNotExist))
+}
+
+func TestListenUnixOwner(t *testing.T) {
+	dir := t.TempDir()
+
+	ln, err := listenUnix(filepath.Join(dir, "default.sock"), config.ServerSocket{})
+	qt.Assert(t, qt.IsNil(err))
+
+	defer ln.Close()
+
+	// Socket created with restricted permissions gets the default mode after the owner is set
+	ln, err = listenUnix(filepath.Join(dir, "owner.sock"), config.ServerSocket{SocketOwner: strconv.Itoa(os.Getuid())})
+	qt.Assert(t, qt.IsNil(err))
+
+	defer ln.Close()
+
+	def, err := os.Stat(filepath.Join(dir, "default.sock"))
+	qt.Assert(t, qt.IsNil(err))
+
+	fi, err := os.Stat(filepath.Join(dir, "owner.sock"))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(fi.Mode().Perm(), def.Mode().Perm()))
+}
+
+func TestListenUnixNotSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.sock")
+	qt.Assert(t, qt.IsNil(os.WriteFile(path, nil, 0o600)))
+
+	_, err := listenUnix(path, config.ServerSocket{})
+	qt.Check(t, qt.ErrorMatches(err, ".* exists and is not a socket"))
+}
+
+func TestInheritedListenersTake(t *testing.T) {
+	l := &inheritedListeners{
+		listeners: []net.Listener{&net.TCPListener{}, &net.TCPListener{}, &net.TCPListener{}},
+		names:     []string{"unknown", "https", "http"},
+		used:      make([]bool, 3),
+	}
+
+	qt.Check(t, qt.Equals(l.take("https"), l.listeners[1]))
+	qt.Check(t, qt.Equals(l.take("metrics"), l.listeners[0]))
+	qt.Check(t, qt.Equals(l.take("http"), l.listeners[2]))
+	qt.Check(t, qt.IsNil(l.take("http")))
+
+	// Named sockets are not taken by other servers
+	l = &inheritedListeners{
+		listeners: []net.Listener{&net.TCPListener{}, &net.TCPListener{}},
+		names:     []string{"management", ""},
+		used:      make([]bool, 2),
+	}
+
+	qt.Check(t, qt.Equals(l.take("http"), l.listeners[1]))
+	qt.Check(t, qt.IsNil(l.take("https")))
+	qt.Check(t, qt.Equals(l.take("management"), l.listeners[0]))
+
+	var none *inheritedListeners
+	qt.Check(t, qt.IsNil(none.take("http")))
+}
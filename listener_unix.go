@@ -0,0 +1,27 @@
+//go:build unix
+
+package azugo
+
+import (
+	"net"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// umaskMu serializes umask changes as umask is shared by the whole process.
+var umaskMu sync.Mutex
+
+// listenUnixRestricted listens on the unix domain socket that is created without
+// any permissions so that no one can connect to it before its mode and ownership
+// are set. Returns the file mode the socket would be created with by default.
+func listenUnixRestricted(path string) (net.Listener, os.FileMode, error) {
+	umaskMu.Lock()
+	defer umaskMu.Unlock()
+
+	mask := syscall.Umask(0o777)
+	ln, err := net.Listen("unix", path)
+	syscall.Umask(mask)
+
+	return ln, os.FileMode(0o777 &^ mask), err
+}
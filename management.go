@@ -0,0 +1,63 @@
+package azugo
+
+import (
+	"net"
+
+	"azugo.io/azugo/config"
+
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/pprofhandler"
+	"go.uber.org/zap"
+)
+
+// Management returns the router of the management server. The management server
+// is started together with the application when it is enabled in the server
+// configuration. Routes registered on it are not served by the public server and
+// middlewares of the public router are not applied.
+func (a *App) Management() RouterHandler {
+	return a.management
+}
+
+// IsManagement returns true if the request is served by the management server.
+func (c *Context) IsManagement() bool {
+	return c.mux == c.app.management
+}
+
+// PprofHandler serves runtime profiling data under /debug/pprof/ path.
+//
+//	app.Management().Any("/debug/pprof/{path:*}", azugo.PprofHandler)
+func PprofHandler(ctx *Context) {
+	ctx.SkipRequestLog()
+	ctx.SkipMetrics()
+
+	pprofhandler.PprofHandler(ctx.Context())
+}
+
+// newManagementServer returns the management server.
+func (a *App) newManagementServer() *fasthttp.Server {
+	conf := a.Config().Server
+
+	return &fasthttp.Server{
+		NoDefaultServerHeader:        true,
+		Handler:                      a.management.Handler,
+		Logger:                       zap.NewStdLog(a.Log().Named("management")),
+		DisablePreParseMultipartForm: true,
+		ReadTimeout:                  conf.ReadTimeout,
+		IdleTimeout:                  conf.IdleTimeout,
+		// Write timeout is not set as profiles are written for the requested duration
+	}
+}
+
+// serveManagement serves the management server on the listener.
+func (a *App) serveManagement(server *fasthttp.Server, ln net.Listener, conf *config.ServerManagement) {
+	ln, err := a.listen(ln, "http", conf.Address, conf.Port, "/", conf.ServerSocket)
+	if err != nil {
+		a.Log().Error("failed to start management server", zap.Error(err))
+
+		return
+	}
+
+	if err := server.Serve(ln); err != nil {
+		a.Log().Error("failed to start management server", zap.Error(err))
+	}
+}
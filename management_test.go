@@ -0,0 +1,83 @@
+package azugo
+
+import (
+	"net"
+	"testing"
+
+	"azugo.io/core/http"
+	"github.com/go-quicktest/qt"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+// testManagementGet serves management router and requests the path.
+func testManagementGet(t *testing.T, a *TestApp, path string) (int, string) {
+	t.Helper()
+
+	ln := fasthttputil.NewInmemoryListener()
+	server := &fasthttp.Server{Handler: a.Management().Handler}
+
+	go func() {
+		_ = server.Serve(ln)
+	}()
+	defer func() { _ = server.Shutdown() }()
+
+	c := &fasthttp.Client{
+		Dial: func(_ string) (net.Conn, error) {
+			return ln.Dial()
+		},
+	}
+
+	status, body, err := c.Get(nil, "http://management"+path)
+	qt.Assert(t, qt.IsNil(err))
+
+	return status, string(body)
+}
+
+func TestManagement(t *testing.T) {
+	a := NewTestApp()
+
+	a.Get("/public", func(ctx *Context) {
+		ctx.Text("public")
+	})
+
+	a.Management().Get("/admin", func(ctx *Context) {
+		if ctx.IsManagement() {
+			ctx.Text("management")
+		}
+	})
+
+	a.Management().Any("/debug/pprof/{path:*}", PprofHandler)
+
+	a.Start(t)
+	defer a.Stop()
+
+	status, body := testManagementGet(t, a, "/admin")
+	qt.Check(t, qt.Equals(status, http.StatusOK))
+	qt.Check(t, qt.Equals(body, "management"))
+
+	status, _ = testManagementGet(t, a, "/public")
+	qt.Check(t, qt.Equals(status, http.StatusNotFound))
+
+	status, body = testManagementGet(t, a, "/debug/pprof/cmdline")
+	qt.Check(t, qt.Equals(status, http.StatusOK))
+	qt.Check(t, qt.Not(qt.Equals(body, "")))
+
+	resp, err := a.TestClient().Get("/admin")
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusNotFound))
+	fasthttp.ReleaseResponse(resp)
+}
+
+func TestManagementApplyConfig(t *testing.T) {
+	a := NewTestApp()
+	a.Config().Server.Path = "/api"
+	a.Config().Proxy.Address = []string{"10.0.0.1"}
+	a.ApplyConfig()
+
+	// Management router trusts the same proxies but is not mounted on the base path
+	qt.Check(t, qt.IsTrue(a.management.RouterOptions.Proxy.IsTrusted(net.IPv4(10, 0, 0, 1))))
+	qt.Check(t, qt.IsFalse(a.management.RouterOptions.Proxy.IsTrusted(net.IPv4(127, 0, 0, 1))))
+	qt.Check(t, qt.Equals(a.management.BasePath(), ""))
+	qt.Check(t, qt.Equals(a.defaultMux.BasePath(), "/api"))
+}
@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"crypto/x509"
+
+	"azugo.io/azugo"
+	"azugo.io/azugo/token"
+	"azugo.io/azugo/user"
+)
+
+// ClientCertificateField is the client certificate field that is mapped to the user claim.
+type ClientCertificateField string
+
+const (
+	// CertSubjectCommonName is the subject common name.
+	CertSubjectCommonName ClientCertificateField = "subject.cn"
+	// CertSubjectOrganization is the subject organization.
+	CertSubjectOrganization ClientCertificateField = "subject.o"
+	// CertSubjectOrganizationalUnit is the subject organizational unit.
+	CertSubjectOrganizationalUnit ClientCertificateField = "subject.ou"
+	// CertIssuerCommonName is the issuer common name.
+	CertIssuerCommonName ClientCertificateField = "issuer.cn"
+	// CertSerialNumber is the certificate serial number in hexadecimal.
+	CertSerialNumber ClientCertificateField = "serial"
+	// CertDNSNames are the subject alternative name DNS names.
+	CertDNSNames ClientCertificateField = "san.dns"
+	// CertEmailAddresses are the subject alternative name email addresses.
+	CertEmailAddresses ClientCertificateField = "san.email"
+	// CertURIs are the subject alternative name URIs.
+	CertURIs ClientCertificateField = "san.uri"
+	// CertIPAddresses are the subject alternative name IP addresses.
+	CertIPAddresses ClientCertificateField = "san.ip"
+)
+
+func (f ClientCertificateField) values(cert *x509.Certificate) []string {
+	switch f {
+	case CertSubjectCommonName:
+		if len(cert.Subject.CommonName) > 0 {
+			return []string{cert.Subject.CommonName}
+		}
+	case CertSubjectOrganization:
+		return cert.Subject.Organization
+	case CertSubjectOrganizationalUnit:
+		return cert.Subject.OrganizationalUnit
+	case CertIssuerCommonName:
+		if len(cert.Issuer.CommonName) > 0 {
+			return []string{cert.Issuer.CommonName}
+		}
+	case CertSerialNumber:
+		return []string{cert.SerialNumber.Text(16)}
+	case CertDNSNames:
+		return cert.DNSNames
+	case CertEmailAddresses:
+		return cert.EmailAddresses
+	case CertURIs:
+		uris := make([]string, 0, len(cert.URIs))
+		for _, u := range cert.URIs {
+			uris = append(uris, u.String())
+		}
+
+		return uris
+	case CertIPAddresses:
+		ips := make([]string, 0, len(cert.IPAddresses))
+		for _, ip := range cert.IPAddresses {
+			ips = append(ips, ip.String())
+		}
+
+		return ips
+	}
+
+	return nil
+}
+
+type clientCertificateUser struct {
+	claims  map[string][]ClientCertificateField
+	options []user.Option
+}
+
+// ClientCertificateOption configures the client certificate user middleware.
+type ClientCertificateOption interface {
+	apply(m *clientCertificateUser)
+}
+
+// ClientCertificateClaims maps user claims to the client certificate fields replacing
+// the default mapping. Values of all fields mapped to the claim are combined.
+type ClientCertificateClaims map[string][]ClientCertificateField
+
+func (o ClientCertificateClaims) apply(m *clientCertificateUser) {
+	m.claims = o
+}
+
+// ClientCertificateUserOptions sets the options of the created user.
+type ClientCertificateUserOptions []user.Option
+
+func (o ClientCertificateUserOptions) apply(m *clientCertificateUser) {
+	m.options = o
+}
+
+// ClientCertificateUser sets the user from the verified client certificate claims.
+// By default the "sub" claim is mapped to the subject common name and the "email"
+// claim to the email addresses. Requests without a verified client certificate are
+// passed through unchanged.
+//
+// Scopes can be granted from the certificate by mapping the "scope" claim:
+//
+//	app.Use(middleware.ClientCertificateUser(middleware.ClientCertificateClaims{
+//	    "sub":   {middleware.CertSubjectCommonName},
+//	    "scope": {middleware.CertSubjectOrganizationalUnit},
+//	}))
+func ClientCertificateUser(opts ...ClientCertificateOption) azugo.RequestHandlerFunc {
+	m := &clientCertificateUser{
+		claims: map[string][]ClientCertificateField{
+			"sub":   {CertSubjectCommonName},
+			"email": {CertEmailAddresses},
+		},
+	}
+
+	for _, opt := range opts {
+		opt.apply(m)
+	}
+
+	return m.handler
+}
+
+// user returns the user with claims mapped from the certificate.
+func (m *clientCertificateUser) user(cert *x509.Certificate) *user.Basic {
+	claims := make(map[string]token.ClaimStrings, len(m.claims))
+
+	for name, fields := range m.claims {
+		var values token.ClaimStrings
+
+		for _, f := range fields {
+			values = append(values, f.values(cert)...)
+		}
+
+		if len(values) > 0 {
+			claims[name] = values
+		}
+	}
+
+	return user.New(claims, m.options...)
+}
+
+func (m *clientCertificateUser) handler(next azugo.RequestHandler) azugo.RequestHandler {
+	return func(ctx *azugo.Context) {
+		if certs := ctx.ClientCertificates(); len(certs) > 0 {
+			ctx.SetUser(m.user(certs[0]))
+		}
+
+		next(ctx)
+	}
+}
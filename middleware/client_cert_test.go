@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"azugo.io/azugo"
+
+	"github.com/go-quicktest/qt"
+	"github.com/valyala/fasthttp"
+)
+
+func newClientTestCert(t *testing.T, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, subject pkix.Name) (*x509.Certificate, tls.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	qt.Assert(t, qt.IsNil(err))
+
+	tmpl := &x509.Certificate{
+		SerialNumber:   big.NewInt(time.Now().UnixNano()),
+		Subject:        subject,
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		EmailAddresses: []string{subject.CommonName + "@example.com"},
+		IPAddresses:    []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	qt.Assert(t, qt.IsNil(err))
+
+	cert, err := x509.ParseCertificate(der)
+	qt.Assert(t, qt.IsNil(err))
+
+	return cert, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}
+}
+
+func TestClientCertificateUser(t *testing.T) {
+	ca, caTLS := newClientTestCert(t, nil, nil, pkix.Name{CommonName: "ca"})
+	_, serverTLS := newClientTestCert(t, ca, caTLS.PrivateKey.(*ecdsa.PrivateKey), pkix.Name{CommonName: "server"})
+	_, clientTLS := newClientTestCert(t, ca, caTLS.PrivateKey.(*ecdsa.PrivateKey), pkix.Name{
+		CommonName:         "billing",
+		OrganizationalUnit: []string{"orders:read", "invoices"},
+	})
+
+	a := azugo.NewTestApp()
+
+	a.Use(ClientCertificateUser(ClientCertificateClaims{
+		"sub":   {CertSubjectCommonName},
+		"email": {CertEmailAddresses},
+		"scope": {CertSubjectOrganizationalUnit},
+	}))
+
+	a.Get("/user", func(ctx *azugo.Context) {
+		u := ctx.User()
+		ctx.Text(u.ID() + " " + u.ClaimValue("email") + " " + strconv.FormatBool(u.HasScopeLevel("orders", "read")) +
+			" " + strconv.Itoa(len(ctx.ClientCertificates())))
+	})
+
+	a.Start(t)
+	defer a.Stop()
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	qt.Assert(t, qt.IsNil(err))
+
+	server := &fasthttp.Server{
+		Handler: a.Handler,
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{serverTLS},
+			ClientAuth:   tls.VerifyClientCertIfGiven,
+			ClientCAs:    clientCAs,
+			MinVersion:   tls.VersionTLS12,
+		},
+	}
+
+	go func() {
+		_ = server.ServeTLSEmbed(ln, nil, nil)
+	}()
+	defer func() { _ = server.Shutdown() }()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca)
+
+	get := func(certs ...tls.Certificate) string {
+		c := &fasthttp.Client{
+			TLSConfig: &tls.Config{
+				Certificates: certs,
+				RootCAs:      rootCAs,
+				MinVersion:   tls.VersionTLS12,
+			},
+		}
+
+		status, body, err := c.Get(nil, "https://"+ln.Addr().String()+"/user")
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.Equals(status, fasthttp.StatusOK))
+
+		return string(body)
+	}
+
+	qt.Check(t, qt.Equals(get(clientTLS), "billing billing@example.com true 2"))
+	qt.Check(t, qt.Equals(get(), "  false 0"))
+}
@@ -0,0 +1,441 @@
+package middleware
+
+import (
+	"fmt"
+	"iter"
+	"math"
+	"sync"
+	"time"
+
+	"azugo.io/azugo"
+	"azugo.io/azugo/config"
+
+	"azugo.io/core/http"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var concurrencyWaitBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Reasons of the shed requests used as metric label values.
+const (
+	concurrencyShedQueueFull    = "queue_full"
+	concurrencyShedQueueTimeout = "queue_timeout"
+	concurrencyShedEvicted      = "evicted"
+	concurrencyShedCanceled     = "canceled"
+)
+
+// Gradient strategy parameters.
+const (
+	concurrencyGradientSmoothing = 0.2
+	concurrencyGradientWindow    = 600
+)
+
+// ConcurrencyPriority is the priority class of the request. Requests with lower
+// priority are shed first when the server is overloaded.
+type ConcurrencyPriority int
+
+const (
+	// ConcurrencyPriorityLow is the priority of the requests that are shed first.
+	ConcurrencyPriorityLow ConcurrencyPriority = -1
+	// ConcurrencyPriorityNormal is the default priority of the requests.
+	ConcurrencyPriorityNormal ConcurrencyPriority = 0
+	// ConcurrencyPriorityHigh is the priority of the requests that are admitted
+	// from the queue first.
+	ConcurrencyPriorityHigh ConcurrencyPriority = 1
+	// ConcurrencyPriorityCritical requests are never queued or shed, ex. health
+	// checks, metrics and administration requests.
+	ConcurrencyPriorityCritical ConcurrencyPriority = 2
+)
+
+// String returns the priority name.
+func (p ConcurrencyPriority) String() string {
+	switch {
+	case p >= ConcurrencyPriorityCritical:
+		return "critical"
+	case p == ConcurrencyPriorityHigh:
+		return "high"
+	case p == ConcurrencyPriorityNormal:
+		return "normal"
+	default:
+		return "low"
+	}
+}
+
+// ConcurrencyError is returned by the Concurrency middleware when the request is
+// shed because the server is overloaded.
+type ConcurrencyError struct {
+	// RetryAfter is the duration after which the client should retry the request.
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface.
+func (*ConcurrencyError) Error() string {
+	return "server is overloaded"
+}
+
+// SafeError returns a message that can be safely returned to the client.
+func (*ConcurrencyError) SafeError() string {
+	return "server is overloaded"
+}
+
+// StatusCode returns the HTTP status code for the concurrency error.
+func (*ConcurrencyError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
+// ErrorHeaders returns the Retry-After response header to set on the response.
+func (e *ConcurrencyError) ErrorHeaders() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		if e.RetryAfter > 0 {
+			yield(http.HeaderRetryAfter, formatSeconds(e.RetryAfter))
+		}
+	}
+}
+
+// ConcurrencyOption configures the concurrency limit middleware.
+type ConcurrencyOption interface {
+	apply(opt *concurrencyLimiter)
+}
+
+// ConcurrencyName sets the limiter name used in the metric labels.
+// Defaults to "global".
+type ConcurrencyName string
+
+func (o ConcurrencyName) apply(opt *concurrencyLimiter) {
+	opt.name = string(o)
+}
+
+// ConcurrencyPriorityResolver allows to provide custom resolver of the request
+// priority, ex. by the authenticated user.
+type ConcurrencyPriorityResolver func(ctx *azugo.Context) ConcurrencyPriority
+
+func (o ConcurrencyPriorityResolver) apply(opt *concurrencyLimiter) {
+	opt.resolver = o
+}
+
+// ConcurrencyRoutePriority sets priorities of the routes by their router path.
+// Health check path "/healthz" and metrics path are critical by default.
+type ConcurrencyRoutePriority map[string]ConcurrencyPriority
+
+func (o ConcurrencyRoutePriority) apply(opt *concurrencyLimiter) {
+	for path, p := range o {
+		opt.routes[path] = p
+	}
+}
+
+// concurrencyWaiter is the request waiting in the queue.
+type concurrencyWaiter struct {
+	priority ConcurrencyPriority
+	ready    chan struct{}
+	admitted bool
+	reason   string
+}
+
+type concurrencyLimiter struct {
+	config   *config.Concurrency
+	name     string
+	resolver ConcurrencyPriorityResolver
+	routes   map[string]ConcurrencyPriority
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+	queue    []*concurrencyWaiter
+	// Long-term average latency of the gradient strategy
+	longLatency float64
+	samples     int
+}
+
+// Concurrency limits the number of requests processed at the same time and sheds
+// requests with 503 Service Unavailable response when the server is overloaded.
+//
+// Requests exceeding the limit wait in the queue ordered by their priority class.
+// When the queue is full the lowest priority request is shed. Critical requests
+// (management server, health checks and metrics) are never queued or shed.
+//
+// With the static strategy the limit is fixed. The aimd strategy increases the
+// limit while request latency stays below the threshold and decreases it
+// multiplicatively otherwise. The gradient strategy adjusts the limit by the
+// ratio of the long-term and current request latency.
+func Concurrency(c *config.Concurrency, opts ...ConcurrencyOption) azugo.RequestHandlerFunc {
+	if c == nil || !c.Enabled {
+		return func(next azugo.RequestHandler) azugo.RequestHandler {
+			return next
+		}
+	}
+
+	l := &concurrencyLimiter{
+		config: c,
+		name:   "global",
+		routes: map[string]ConcurrencyPriority{
+			"/healthz": ConcurrencyPriorityCritical,
+		},
+		limit: float64(c.Limit),
+	}
+
+	for _, opt := range opts {
+		opt.apply(l)
+	}
+
+	labels := fmt.Sprintf("{limiter=%q}", l.name)
+
+	// Gauges of the previous limiter with the same name are replaced
+	for _, name := range []string{"concurrency_limit", "concurrency_in_flight", "concurrency_queue_depth"} {
+		metrics.UnregisterMetric(name + labels)
+	}
+
+	metrics.GetOrCreateGauge("concurrency_limit"+labels, func() float64 {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		return math.Floor(l.limit)
+	})
+	metrics.GetOrCreateGauge("concurrency_in_flight"+labels, func() float64 {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		return float64(l.inflight)
+	})
+	metrics.GetOrCreateGauge("concurrency_queue_depth"+labels, func() float64 {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		return float64(len(l.queue))
+	})
+
+	return l.handler
+}
+
+func (l *concurrencyLimiter) priority(ctx *azugo.Context) ConcurrencyPriority {
+	if ctx.IsManagement() {
+		return ConcurrencyPriorityCritical
+	}
+
+	path := ctx.RouterPath()
+	if path == "" {
+		path = ctx.Path()
+	}
+
+	if p, ok := l.routes[path]; ok {
+		return p
+	}
+
+	if conf := ctx.App().Config().Metrics; conf != nil && conf.Enabled && conf.Path == path {
+		return ConcurrencyPriorityCritical
+	}
+
+	if l.resolver != nil {
+		return l.resolver(ctx)
+	}
+
+	return ConcurrencyPriorityNormal
+}
+
+func (l *concurrencyLimiter) handler(next azugo.RequestHandler) azugo.RequestHandler {
+	return func(ctx *azugo.Context) {
+		p := l.priority(ctx)
+
+		if reason := l.acquire(ctx.Done(), p); reason != "" {
+			metrics.GetOrCreateCounter(fmt.Sprintf("concurrency_shed_total{limiter=%q,priority=%q,reason=%q}",
+				l.name, p.String(), reason)).Inc()
+
+			ctx.Error(&ConcurrencyError{RetryAfter: l.config.RetryAfter})
+
+			return
+		}
+
+		start := time.Now()
+
+		defer func() {
+			l.release(p, time.Since(start))
+		}()
+
+		next(ctx)
+	}
+}
+
+// acquire waits for the in-flight slot and returns the reason if the request is shed.
+func (l *concurrencyLimiter) acquire(cancel <-chan struct{}, p ConcurrencyPriority) string {
+	l.mu.Lock()
+
+	if p >= ConcurrencyPriorityCritical || (l.inflight < l.currentLimit() && len(l.queue) == 0) {
+		l.inflight++
+		l.mu.Unlock()
+
+		return ""
+	}
+
+	if len(l.queue) >= l.config.QueueSize {
+		// Lowest priority request waiting the longest is evicted
+		i := l.lowest()
+		if i < 0 || l.queue[i].priority >= p {
+			l.mu.Unlock()
+
+			return concurrencyShedQueueFull
+		}
+
+		l.remove(i).done(false, concurrencyShedEvicted)
+	}
+
+	w := &concurrencyWaiter{
+		priority: p,
+		ready:    make(chan struct{}),
+	}
+	l.queue = append(l.queue, w)
+	l.mu.Unlock()
+
+	start := time.Now()
+
+	timer := time.NewTimer(l.config.QueueTimeout)
+	defer timer.Stop()
+
+	reason := ""
+
+	select {
+	case <-w.ready:
+	case <-timer.C:
+		reason = concurrencyShedQueueTimeout
+	case <-cancel:
+		reason = concurrencyShedCanceled
+	}
+
+	if len(reason) > 0 {
+		l.mu.Lock()
+		if i := l.index(w); i >= 0 {
+			l.remove(i).done(false, reason)
+		}
+		l.mu.Unlock()
+
+		<-w.ready
+	}
+
+	metrics.GetOrCreatePrometheusHistogramExt(fmt.Sprintf("concurrency_queue_wait_seconds{limiter=%q}", l.name), concurrencyWaitBuckets).
+		Update(time.Since(start).Seconds())
+
+	if !w.admitted {
+		return w.reason
+	}
+
+	return ""
+}
+
+// release frees the in-flight slot, adjusts the limit and admits waiting requests.
+func (l *concurrencyLimiter) release(p ConcurrencyPriority, latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inflight--
+
+	// Critical requests bypass the limit and are not used to adjust it
+	if p < ConcurrencyPriorityCritical {
+		l.adjust(latency)
+	}
+
+	for len(l.queue) > 0 && l.inflight < l.currentLimit() {
+		l.inflight++
+		l.remove(l.highest()).done(true, "")
+	}
+}
+
+// adjust updates the limit by the latency of the completed request.
+func (l *concurrencyLimiter) adjust(latency time.Duration) {
+	c := l.config
+
+	switch c.Strategy {
+	case "aimd":
+		if latency > c.LatencyThreshold {
+			l.limit *= c.BackoffRatio
+		} else if float64(l.inflight+1)*2 >= l.limit {
+			// Limit is increased only when it is being utilized
+			l.limit++
+		}
+	case "gradient":
+		sample := latency.Seconds()
+		if sample <= 0 {
+			return
+		}
+
+		if l.samples < concurrencyGradientWindow {
+			l.samples++
+		}
+
+		if l.longLatency == 0 {
+			l.longLatency = sample
+		} else {
+			l.longLatency += (sample - l.longLatency) / float64(l.samples)
+		}
+
+		// Recover faster after the latency has improved
+		if l.longLatency > sample*2 {
+			l.longLatency *= 0.95
+		}
+
+		gradient := max(0.5, min(1.0, l.longLatency/sample))
+		limit := l.limit*gradient + math.Sqrt(l.limit)
+
+		// Limit is increased only when it is being utilized
+		if limit > l.limit && float64(l.inflight+1)*2 < l.limit {
+			return
+		}
+
+		l.limit = l.limit*(1-concurrencyGradientSmoothing) + limit*concurrencyGradientSmoothing
+	default:
+		return
+	}
+
+	l.limit = max(float64(c.MinLimit), min(float64(c.MaxLimit), l.limit))
+}
+
+func (l *concurrencyLimiter) currentLimit() int {
+	return int(l.limit)
+}
+
+// highest returns the index of the highest priority request waiting the longest.
+func (l *concurrencyLimiter) highest() int {
+	idx := 0
+
+	for i, w := range l.queue {
+		if w.priority > l.queue[idx].priority {
+			idx = i
+		}
+	}
+
+	return idx
+}
+
+// lowest returns the index of the lowest priority request waiting the longest.
+func (l *concurrencyLimiter) lowest() int {
+	idx := -1
+
+	for i, w := range l.queue {
+		if idx < 0 || w.priority < l.queue[idx].priority {
+			idx = i
+		}
+	}
+
+	return idx
+}
+
+func (l *concurrencyLimiter) index(w *concurrencyWaiter) int {
+	for i, q := range l.queue {
+		if q == w {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (l *concurrencyLimiter) remove(i int) *concurrencyWaiter {
+	w := l.queue[i]
+	l.queue = append(l.queue[:i], l.queue[i+1:]...)
+
+	return w
+}
+
+// done completes the wait of the request.
+func (w *concurrencyWaiter) done(admitted bool, reason string) {
+	w.admitted = admitted
+	w.reason = reason
+	close(w.ready)
+}
@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"azugo.io/azugo"
+	"azugo.io/azugo/config"
+
+	"azugo.io/core/http"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/go-quicktest/qt"
+	"github.com/valyala/fasthttp"
+)
+
+func testConcurrencyConfig() *config.Concurrency {
+	return &config.Concurrency{
+		Enabled:          true,
+		Strategy:         "static",
+		Limit:            1,
+		MinLimit:         1,
+		MaxLimit:         10,
+		QueueTimeout:     5 * time.Second,
+		LatencyThreshold: 100 * time.Millisecond,
+		BackoffRatio:     0.5,
+		RetryAfter:       2 * time.Second,
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	c := testConcurrencyConfig()
+	c.QueueSize = 1
+
+	a := azugo.NewTestApp()
+
+	a.Use(Concurrency(c))
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+
+	a.Get("/slow", func(ctx *azugo.Context) {
+		started <- struct{}{}
+		<-unblock
+		ctx.Text("slow")
+	})
+
+	a.Get("/fast", func(ctx *azugo.Context) {
+		ctx.Text("fast")
+	})
+
+	a.Get("/healthz", func(ctx *azugo.Context) {
+		ctx.Text("ok")
+	})
+
+	a.Start(t)
+	defer a.Stop()
+
+	get := func(path string, status chan<- int) {
+		resp, err := a.TestClient().Get(path)
+		qt.Check(t, qt.IsNil(err))
+		status <- resp.StatusCode()
+		fasthttp.ReleaseResponse(resp)
+	}
+
+	slow := make(chan int, 1)
+
+	go get("/slow", slow)
+	<-started
+
+	// Queued until the slow request completes
+	queued := make(chan int, 1)
+
+	go get("/fast", queued)
+
+	depth := metrics.GetOrCreateGauge(`concurrency_queue_depth{limiter="global"}`, nil)
+
+	for deadline := time.Now().Add(5 * time.Second); depth.Get() == 0 && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Queue is full
+	resp, err := a.TestClient().Get("/fast")
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusServiceUnavailable))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek(http.HeaderRetryAfter)), "2"))
+	fasthttp.ReleaseResponse(resp)
+
+	// Health checks are never shed
+	resp, err = a.TestClient().Get("/healthz")
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+	fasthttp.ReleaseResponse(resp)
+
+	close(unblock)
+
+	qt.Check(t, qt.Equals(<-slow, http.StatusOK))
+	qt.Check(t, qt.Equals(<-queued, http.StatusOK))
+}
+
+func TestConcurrencyPriority(t *testing.T) {
+	c := testConcurrencyConfig()
+	c.QueueSize = 1
+
+	l := &concurrencyLimiter{config: c, name: "test", limit: 1}
+
+	queued := func() int {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		return len(l.queue)
+	}
+
+	qt.Assert(t, qt.Equals(l.acquire(nil, ConcurrencyPriorityNormal), ""))
+
+	low := make(chan string, 1)
+
+	go func() {
+		low <- l.acquire(nil, ConcurrencyPriorityLow)
+	}()
+
+	for deadline := time.Now().Add(5 * time.Second); queued() == 0 && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	high := make(chan string, 1)
+
+	go func() {
+		high <- l.acquire(nil, ConcurrencyPriorityHigh)
+	}()
+
+	// Low priority request is evicted by the high priority request
+	qt.Check(t, qt.Equals(<-low, concurrencyShedEvicted))
+
+	// Queue is full and normal priority request does not evict high priority one
+	qt.Check(t, qt.Equals(l.acquire(nil, ConcurrencyPriorityNormal), concurrencyShedQueueFull))
+
+	// Critical requests bypass the limit
+	qt.Check(t, qt.Equals(l.acquire(nil, ConcurrencyPriorityCritical), ""))
+
+	l.release(ConcurrencyPriorityCritical, 0)
+	l.release(ConcurrencyPriorityNormal, 0)
+
+	qt.Check(t, qt.Equals(<-high, ""))
+}
+
+func TestConcurrencyAIMD(t *testing.T) {
+	c := testConcurrencyConfig()
+	c.Strategy = "aimd"
+	c.Limit = 8
+
+	l := &concurrencyLimiter{config: c, limit: 8, inflight: 4}
+
+	l.adjust(10 * time.Millisecond)
+	qt.Check(t, qt.Equals(l.currentLimit(), 9))
+
+	l.adjust(200 * time.Millisecond)
+	qt.Check(t, qt.Equals(l.currentLimit(), 4))
+
+	for range 10 {
+		l.adjust(time.Second)
+	}
+
+	qt.Check(t, qt.Equals(l.currentLimit(), c.MinLimit))
+}
+
+func TestConcurrencyGradient(t *testing.T) {
+	c := testConcurrencyConfig()
+	c.Strategy = "gradient"
+	c.Limit = 8
+	c.MaxLimit = 100
+
+	l := &concurrencyLimiter{config: c, limit: 8, inflight: 8}
+
+	for range 50 {
+		l.adjust(10 * time.Millisecond)
+	}
+
+	grown := l.currentLimit()
+	qt.Check(t, qt.IsTrue(grown > 8), qt.Commentf("limit %d", grown))
+
+	for range 50 {
+		l.adjust(100 * time.Millisecond)
+	}
+
+	qt.Check(t, qt.IsTrue(l.currentLimit() < grown), qt.Commentf("limit %d", l.currentLimit()))
+}
@@ -66,7 +66,7 @@ func (p *metricsHandler) Handler(h azugo.RequestHandler) azugo.RequestHandler {
 		if strings.EqualFold(ctx.Path(), p.metricsPath) {
 			if p.isTrusted(ctx) {
 				ctx.SkipRequestLog()
-				p.serveMetrics(ctx)
+				serveMetrics(ctx)
 			} else {
 				h(ctx)
 			}
@@ -111,13 +111,31 @@ func (p *metricsHandler) Handler(h azugo.RequestHandler) azugo.RequestHandler {
 		labels := fmt.Sprintf(`{code=%q,method=%q,path=%q}`, strconv.Itoa(status), ctx.Method(), path)
 		metrics.GetOrCreateCounter(p.metricName("requests_total") + labels).Inc()
 		metrics.GetOrCreatePrometheusHistogramExt(p.metricName("request_duration_seconds")+labels, requestDurationBuckets).Update(elapsed)
+		metrics.GetOrCreateCounter(p.metricName("requests_protocol_total") + fmt.Sprintf(`{protocol=%q}`, ctx.Protocol())).Inc()
 
 		p.reqSize.Update(float64(computeApproximateRequestSize(ctx)))
 		p.respSize.Update(respSize)
 	}
 }
 
-func (p *metricsHandler) serveMetrics(ctx *azugo.Context) {
+// MetricsHandler returns handler that serves application metrics without trusted
+// source checks. It is intended for the management router, where the Metrics
+// middleware path should be set to empty so that metrics are not served publicly.
+//
+//	app.Use(middleware.Metrics(""))
+//	app.Management().Get("/metrics", middleware.MetricsHandler())
+func MetricsHandler() azugo.RequestHandler {
+	metrics.ExposeMetadata(true)
+
+	return func(ctx *azugo.Context) {
+		ctx.SkipRequestLog()
+		ctx.SkipMetrics()
+
+		serveMetrics(ctx)
+	}
+}
+
+func serveMetrics(ctx *azugo.Context) {
 	accept := ctx.Header.Get(http.HeaderAccept)
 	w := ctx.Response().BodyWriter()
 
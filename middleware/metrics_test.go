@@ -64,8 +64,10 @@ func TestMetricsHandler(t *testing.T) {
 	qt.Assert(t, qt.IsNil(err))
 	qt.Assert(t, qt.Equals(resp.StatusCode(), http.StatusOK))
 
-	i := strings.Index(string(resp.Body()), "requests_total")
+	body := string(resp.Body())
 	fasthttp.ReleaseResponse(resp)
 
-	qt.Check(t, qt.IsTrue(i > -1), qt.Commentf("metrics handler not returning expected metrics"))
+	qt.Check(t, qt.IsTrue(strings.Contains(body, "requests_total")), qt.Commentf("metrics handler not returning expected metrics"))
+	qt.Check(t, qt.IsTrue(strings.Contains(body, `subsystem_requests_total{code="200",method="GET",path="/test"}`)))
+	qt.Check(t, qt.IsTrue(strings.Contains(body, `subsystem_requests_protocol_total{protocol="HTTP/1.1"}`)))
 }
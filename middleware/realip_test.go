@@ -2,6 +2,8 @@ package middleware
 
 import (
 	"fmt"
+	"net"
+	"path/filepath"
 	"testing"
 
 	"azugo.io/azugo"
@@ -137,3 +139,58 @@ func TestRealIPMiddlewareMultipleHeaderLines(t *testing.T) {
 	qt.Assert(t, qt.IsNil(err))
 	defer fasthttp.ReleaseResponse(resp)
 }
+
+func TestRealIPMiddlewareUnixSocket(t *testing.T) {
+	a := azugo.NewTestApp()
+	defer a.Stop()
+
+	a.RouterOptions().Proxy.Clear()
+	a.RouterOptions().Proxy.TrustedHeaders = []string{http.HeaderXForwardedFor}
+	a.RouterOptions().Proxy.ForwardLimit = 1
+	a.Use(RealIP)
+
+	a.Get("/", func(ctx *azugo.Context) {
+		ctx.Text(ctx.IP().String())
+	})
+
+	a.Start(t)
+	defer a.Stop()
+
+	socket := filepath.Join(t.TempDir(), "app.sock")
+
+	ln, err := net.Listen("unix", socket)
+	qt.Assert(t, qt.IsNil(err))
+
+	server := &fasthttp.Server{Handler: a.Handler}
+
+	go func() {
+		_ = server.Serve(ln)
+	}()
+	defer func() {
+		_ = server.Shutdown()
+	}()
+
+	c := &fasthttp.Client{
+		Dial: func(string) (net.Conn, error) {
+			return net.Dial("unix", socket)
+		},
+	}
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	req.SetRequestURI("http://localhost/")
+	req.Header.Set(http.HeaderXForwardedFor, "1.1.1.1")
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	// Peers connected over unix domain socket are not trusted by default
+	qt.Assert(t, qt.IsNil(c.Do(req, resp)))
+	qt.Check(t, qt.Not(qt.Equals(string(resp.Body()), "1.1.1.1")))
+
+	a.RouterOptions().Proxy.TrustUnixSocket = true
+
+	qt.Assert(t, qt.IsNil(c.Do(req, resp)))
+	qt.Check(t, qt.Equals(string(resp.Body()), "1.1.1.1"))
+}
@@ -99,7 +99,7 @@ func RequestLogger(next azugo.RequestHandler) azugo.RequestHandler {
 		}
 		// HTTP protocol
 		_ = msg.WriteByte(' ')
-		_, _ = msg.Write(ctx.Response().Header.Protocol())
+		_, _ = msg.WriteString(ctx.Protocol())
 		_ = msg.WriteByte('"')
 
 		// Status Code
@@ -0,0 +1,422 @@
+package azugo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"io"
+	"math/rand/v2"
+	"net/url"
+	"strings"
+	"time"
+
+	"azugo.io/azugo/internal/proxy"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+)
+
+// MirrorOption is a traffic mirroring option.
+type MirrorOption interface {
+	apply(opts *mirrorOptions)
+}
+
+type mirrorOptions struct {
+	Concurrency      int
+	QueueSize        int
+	Timeout          time.Duration
+	MaxBodySize      int
+	CompareResponses bool
+}
+
+// MirrorConcurrency sets the maximum number of mirrored requests sent to the shadow
+// upstream concurrently. Defaults to 8.
+type MirrorConcurrency int
+
+func (o MirrorConcurrency) apply(opts *mirrorOptions) {
+	opts.Concurrency = int(o)
+}
+
+// MirrorQueueSize sets the number of mirrored requests waiting to be sent.
+// Requests are dropped when the queue is full. Defaults to 100.
+type MirrorQueueSize int
+
+func (o MirrorQueueSize) apply(opts *mirrorOptions) {
+	opts.QueueSize = int(o)
+}
+
+// MirrorTimeout sets the timeout of the mirrored request. Defaults to 10 seconds.
+type MirrorTimeout time.Duration
+
+func (o MirrorTimeout) apply(opts *mirrorOptions) {
+	opts.Timeout = time.Duration(o)
+}
+
+// MirrorMaxBodySize sets the maximum size of request body that is mirrored.
+// Requests with larger or unknown size streamed bodies are not mirrored. Defaults to 1 MiB.
+type MirrorMaxBodySize int
+
+func (o MirrorMaxBodySize) apply(opts *mirrorOptions) {
+	opts.MaxBodySize = int(o)
+}
+
+// MirrorCompareResponses logs differences in status code and body hash
+// between the primary and the shadow upstream responses.
+type MirrorCompareResponses bool
+
+func (o MirrorCompareResponses) apply(opts *mirrorOptions) {
+	opts.CompareResponses = bool(o)
+}
+
+// mirror replays requests to the shadow upstream in background discarding the responses.
+type mirror struct {
+	app     *App
+	target  *ProxyTarget
+	sample  float64
+	options mirrorOptions
+	client  *fasthttp.Client
+	queue   chan *mirrorRequest
+	name    string
+}
+
+// mirrorRequest is the request waiting to be replayed to the shadow upstream.
+type mirrorRequest struct {
+	mirror *mirror
+	req    *fasthttp.Request
+	status int
+	hash   uint64
+	hashed bool
+	// streamed is set when the request body is streamed and must be captured
+	// while it is read by the primary handler.
+	streamed bool
+	body     *mirrorRequestBody
+}
+
+func newMirror(a *App, u *url.URL, samplePercent float64, options ...MirrorOption) *mirror {
+	opt := mirrorOptions{
+		Concurrency: 8,
+		QueueSize:   100,
+		Timeout:     10 * time.Second,
+		MaxBodySize: 1 << 20,
+	}
+
+	for _, option := range options {
+		option.apply(&opt)
+	}
+
+	opt.Concurrency = max(opt.Concurrency, 1)
+	opt.QueueSize = max(opt.QueueSize, 0)
+
+	m := &mirror{
+		app:     a,
+		target:  newProxyTarget(u, 1),
+		sample:  min(max(samplePercent, 0), 100),
+		options: opt,
+		client: &fasthttp.Client{
+			NoDefaultUserAgentHeader: true,
+			DisablePathNormalizing:   true,
+			MaxConnsPerHost:          opt.Concurrency,
+		},
+		queue: make(chan *mirrorRequest, opt.QueueSize),
+		name:  strings.TrimRight(u.String(), "/"),
+	}
+
+	for range opt.Concurrency {
+		a.runTask(m.run)
+	}
+
+	return m
+}
+
+// sampled reports whether the request should be mirrored.
+func (m *mirror) sampled() bool {
+	//nolint:gosec
+	return m.sample >= 100 || m.sample > 0 && rand.Float64()*100 < m.sample
+}
+
+// capture copies the request to be mirrored with the given escaped path with query string
+// relative to the shadow upstream URL. Returns nil if the request is not sampled or can not
+// be mirrored.
+func (m *mirror) capture(src *fasthttp.Request, uri []byte) *mirrorRequest {
+	if !m.sampled() || src.Header.ConnectionUpgrade() {
+		return nil
+	}
+
+	// Streamed body is not read here so that it is not buffered for the primary handler
+	streamed := src.IsBodyStream()
+	if streamed {
+		n := src.Header.ContentLength()
+		if n < 0 || n > m.options.MaxBodySize {
+			m.count("skipped")
+
+			return nil
+		}
+	}
+
+	req := fasthttp.AcquireRequest()
+	src.CopyTo(req)
+	proxy.StripHeaders(&req.Header)
+
+	buf := make([]byte, 0, len(m.target.path)+len(uri))
+	req.SetRequestURIBytes(append(append(buf, m.target.path...), uri...))
+	req.URI().DisablePathNormalizing = true
+	req.URI().SetSchemeBytes(m.target.scheme)
+	req.SetHostBytes(m.target.host)
+
+	return &mirrorRequest{mirror: m, req: req, streamed: streamed}
+}
+
+// mirrorRequestBody captures the streamed request body while it is sent to the primary upstream.
+type mirrorRequestBody struct {
+	io.Reader
+
+	buf bytes.Buffer
+	eof bool
+}
+
+func (b *mirrorRequestBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	_, _ = b.buf.Write(p[:n])
+
+	if err == io.EOF {
+		b.eof = true
+	}
+
+	return n, err
+}
+
+// teeRequestBody captures the streamed request body for the mirrored requests as it is read.
+func teeRequestBody(req *fasthttp.Request, requests []*mirrorRequest) {
+	if len(requests) == 0 || !req.IsBodyStream() {
+		return
+	}
+
+	b := &mirrorRequestBody{Reader: req.BodyStream()}
+
+	for _, r := range requests {
+		r.body = b
+	}
+
+	req.SetBodyStream(b, req.Header.ContentLength())
+}
+
+// enqueue queues the request to be sent with the primary response status code and
+// body hash to compare to. Request is dropped if the queue is full.
+func (r *mirrorRequest) enqueue(status int, h hash.Hash64) {
+	// Streamed body that was not fully read can not be mirrored
+	if r.streamed {
+		if r.body == nil || !r.body.eof {
+			r.mirror.count("skipped")
+			fasthttp.ReleaseRequest(r.req)
+
+			return
+		}
+
+		r.req.SetBody(r.body.buf.Bytes())
+	}
+
+	r.status = status
+
+	if h != nil && r.mirror.options.CompareResponses {
+		r.hash, r.hashed = h.Sum64(), true
+	}
+
+	select {
+	case r.mirror.queue <- r:
+	default:
+		r.mirror.drop(r)
+	}
+}
+
+func (m *mirror) count(result string) {
+	metrics.GetOrCreateCounter(fmt.Sprintf("mirror_requests_total{mirror=%q,result=%q}", m.name, result)).Inc()
+}
+
+// run sends the queued requests until the application is stopped. Requests left
+// in the queue are dropped when the application is stopped.
+func (m *mirror) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			m.drain()
+
+			return
+		case r := <-m.queue:
+			// Request is not sent if the application is stopped at the same time
+			if ctx.Err() != nil {
+				m.drop(r)
+
+				continue
+			}
+
+			m.send(r)
+		}
+	}
+}
+
+// drain drops the queued requests.
+func (m *mirror) drain() {
+	for {
+		select {
+		case r := <-m.queue:
+			m.drop(r)
+		default:
+			return
+		}
+	}
+}
+
+func (m *mirror) drop(r *mirrorRequest) {
+	m.count("dropped")
+	fasthttp.ReleaseRequest(r.req)
+}
+
+func (m *mirror) send(r *mirrorRequest) {
+	defer fasthttp.ReleaseRequest(r.req)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	if err := m.client.DoTimeout(r.req, resp, m.options.Timeout); err != nil {
+		m.count("failed")
+		m.app.Log().Debug("mirror request failed", zap.String("mirror", m.name), zap.Error(err))
+
+		return
+	}
+
+	m.count("sent")
+
+	if !m.options.CompareResponses {
+		return
+	}
+
+	fields := make([]zap.Field, 0, 6)
+
+	if resp.StatusCode() != r.status {
+		fields = append(fields, zap.Int("status", r.status), zap.Int("mirror.status", resp.StatusCode()))
+	}
+
+	if r.hashed {
+		h := fnv.New64a()
+		_, _ = h.Write(resp.Body())
+
+		if sum := h.Sum64(); sum != r.hash {
+			fields = append(fields, zap.Uint64("body.hash", r.hash), zap.Uint64("mirror.body.hash", sum))
+		}
+	}
+
+	if len(fields) == 0 {
+		return
+	}
+
+	metrics.GetOrCreateCounter(fmt.Sprintf("mirror_differences_total{mirror=%q}", m.name)).Inc()
+	m.app.Log().Info("mirror response differs", append(fields,
+		zap.String("mirror", m.name),
+		zap.ByteString("method", r.req.Header.Method()),
+		zap.ByteString("path", r.req.URI().PathOriginal()),
+	)...)
+}
+
+// mirrorBody is the response body stream that hashes the body streamed to the client
+// and queues the mirrored requests once the body has been read.
+type mirrorBody struct {
+	io.Reader
+
+	requests []*mirrorRequest
+	status   int
+	hash     hash.Hash64
+	eof      bool
+}
+
+func (b *mirrorBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	_, _ = b.hash.Write(p[:n])
+
+	if err == io.EOF {
+		b.eof = true
+	}
+
+	return n, err
+}
+
+func (b *mirrorBody) Close() error {
+	var err error
+	if c, ok := b.Reader.(io.Closer); ok {
+		err = c.Close()
+	}
+
+	h := b.hash
+	if !b.eof {
+		h = nil
+	}
+
+	for _, r := range b.requests {
+		r.enqueue(b.status, h)
+	}
+
+	return err
+}
+
+// Mirror returns middleware that asynchronously replays sampled requests to the shadow
+// upstream discarding its responses. Sample percent is the percentage of requests to mirror.
+//
+// Request path and query string are appended to the shadow upstream URL path. Streamed
+// request bodies are mirrored only if the handler reads them into memory. Streamed
+// response bodies are not compared.
+func (a *App) Mirror(u *url.URL, samplePercent float64, options ...MirrorOption) RequestHandlerFunc {
+	m := newMirror(a, u, samplePercent, options...)
+
+	return func(next RequestHandler) RequestHandler {
+		return func(ctx *Context) {
+			r := m.capture(ctx.Request(), ctx.Request().RequestURI())
+			if r == nil {
+				next(ctx)
+
+				return
+			}
+
+			next(ctx)
+
+			// Streamed body can be mirrored only if the handler has read it into memory
+			// as body copied as stream is not kept
+			if req := ctx.Request(); r.streamed && !req.IsBodyStream() {
+				if body := req.Body(); len(body) == req.Header.ContentLength() {
+					r.req.SetBody(body)
+					r.streamed = false
+				}
+			}
+
+			resp := ctx.Response()
+			if resp.IsBodyStream() {
+				r.enqueue(resp.StatusCode(), nil)
+
+				return
+			}
+
+			h := fnv.New64a()
+			_, _ = h.Write(resp.Body())
+			r.enqueue(resp.StatusCode(), h)
+		}
+	}
+}
+
+type proxyMirrorOption struct {
+	url     *url.URL
+	sample  float64
+	options []MirrorOption
+}
+
+func (o *proxyMirrorOption) apply(opts *proxyOptions) {
+	opts.Mirrors = append(opts.Mirrors, o)
+}
+
+// ProxyMirror asynchronously replays sampled proxied requests to the shadow upstream
+// discarding its responses. Sample percent is the percentage of requests to mirror.
+//
+// Shadow upstream receives the same request as the primary upstream.
+func ProxyMirror(u *url.URL, samplePercent float64, options ...MirrorOption) ProxyOption {
+	return &proxyMirrorOption{u, samplePercent, options}
+}
@@ -0,0 +1,253 @@
+package azugo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"azugo.io/core/http"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/go-quicktest/qt"
+	"github.com/valyala/fasthttp"
+)
+
+type mirroredRequest struct {
+	method, uri, body string
+}
+
+func testShadow(t *testing.T, status int, body string) (*url.URL, <-chan mirroredRequest) {
+	t.Helper()
+
+	ch := make(chan mirroredRequest, 10)
+
+	u := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		ch <- mirroredRequest{string(ctx.Method()), string(ctx.RequestURI()), string(ctx.PostBody())}
+
+		ctx.SetStatusCode(status)
+		ctx.SetBodyString(body)
+	})
+
+	return u, ch
+}
+
+func waitCounter(t *testing.T, name string, value uint64) {
+	t.Helper()
+
+	c := metrics.GetOrCreateCounter(name)
+	for deadline := time.Now().Add(5 * time.Second); c.Get() < value && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	qt.Check(t, qt.Equals(c.Get(), value))
+}
+
+func TestMirror(t *testing.T) {
+	shadow, ch := testShadow(t, http.StatusOK, "shadow")
+	u := &url.URL{Scheme: shadow.Scheme, Host: shadow.Host, Path: "/shadow"}
+
+	a := NewTestApp()
+	a.Use(a.Mirror(u, 100, MirrorCompareResponses(true)))
+	a.Start(t)
+	defer a.Stop()
+
+	a.Post("/echo", func(ctx *Context) {
+		ctx.Raw(ctx.Body.Bytes())
+	})
+
+	resp, err := a.TestClient().Post("/echo", []byte("data"), a.TestClient().WithQuery(map[string]any{"a": 1}))
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(resp.Body()), "data"))
+
+	select {
+	case r := <-ch:
+		qt.Check(t, qt.Equals(r, mirroredRequest{fasthttp.MethodPost, "/shadow/echo?a=1", "data"}))
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not mirrored")
+	}
+
+	waitCounter(t, fmt.Sprintf("mirror_differences_total{mirror=%q}", u.String()), 1)
+}
+
+func TestMirrorQueueFull(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	u := testUpstream(t, func(_ *fasthttp.RequestCtx) {
+		<-release
+	})
+
+	a := NewTestApp()
+	a.Use(a.Mirror(u, 100, MirrorConcurrency(1), MirrorQueueSize(0)))
+	a.Start(t)
+	defer a.Stop()
+
+	a.Get("/", func(ctx *Context) {
+		ctx.Text("ok")
+	})
+
+	for range 3 {
+		resp, err := a.TestClient().Get("/")
+		qt.Assert(t, qt.IsNil(err))
+		qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+		fasthttp.ReleaseResponse(resp)
+	}
+
+	c := metrics.GetOrCreateCounter(fmt.Sprintf("mirror_requests_total{mirror=%q,result=%q}", u.String(), "dropped"))
+	qt.Check(t, qt.IsTrue(c.Get() >= 2))
+}
+
+func TestMirrorDrain(t *testing.T) {
+	m := &mirror{
+		queue: make(chan *mirrorRequest, 2),
+		name:  "http://drain",
+	}
+
+	for range 2 {
+		m.queue <- &mirrorRequest{req: fasthttp.AcquireRequest(), mirror: m}
+	}
+
+	dropped := metrics.GetOrCreateCounter(fmt.Sprintf("mirror_requests_total{mirror=%q,result=%q}", "http://drain", "dropped"))
+	n := dropped.Get()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Queued requests are dropped when the application is stopped
+	m.run(ctx)
+
+	qt.Check(t, qt.HasLen(m.queue, 0))
+	qt.Check(t, qt.Equals(dropped.Get()-n, uint64(2)))
+}
+
+func TestProxyMirror(t *testing.T) {
+	u := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString("primary")
+	})
+	shadow, ch := testShadow(t, http.StatusOK, "primary")
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Proxy("/api", ProxyUpstream(u), ProxyMirror(shadow, 100, MirrorCompareResponses(true)))
+
+	resp, err := a.TestClient().Put("/api/users", []byte("data"))
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(resp.Body()), "primary"))
+
+	select {
+	case r := <-ch:
+		qt.Check(t, qt.Equals(r, mirroredRequest{fasthttp.MethodPut, "/users", "data"}))
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not mirrored")
+	}
+
+	waitCounter(t, fmt.Sprintf("mirror_requests_total{mirror=%q,result=%q}", shadow.String(), "sent"), 1)
+	qt.Check(t, qt.Equals(metrics.GetOrCreateCounter(fmt.Sprintf("mirror_differences_total{mirror=%q}", shadow.String())).Get(), uint64(0)))
+}
+
+func testStreamUpstream(t *testing.T, ch chan<- string) *url.URL {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	qt.Assert(t, qt.IsNil(err))
+
+	server := &fasthttp.Server{
+		Handler: func(ctx *fasthttp.RequestCtx) {
+			ch <- string(ctx.Request.Header.Peek(http.HeaderProxyAuthorization)) + ":" + strconv.Itoa(len(ctx.PostBody()))
+		},
+		StreamRequestBody: true,
+	}
+
+	go func() {
+		_ = server.Serve(ln)
+	}()
+
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+
+	return &url.URL{Scheme: "http", Host: ln.Addr().String()}
+}
+
+func TestMirrorStreamedBody(t *testing.T) {
+	ch := make(chan string, 10)
+	shadow := testStreamUpstream(t, ch)
+
+	a := NewTestApp()
+	a.Use(a.Mirror(shadow, 100, MirrorMaxBodySize(8<<20)))
+	a.Start(t)
+	defer a.Stop()
+
+	a.Post("/bytes", func(ctx *Context) {
+		ctx.Text(strconv.Itoa(len(ctx.Body.Bytes())))
+	})
+
+	a.Post("/stream", func(ctx *Context) {
+		_, err := ctx.Body.WriteTo(io.Discard)
+		if err != nil {
+			ctx.Error(err)
+
+			return
+		}
+
+		ctx.Text("ok")
+	})
+
+	body := make([]byte, fasthttp.DefaultMaxRequestBodySize+1024)
+
+	resp, err := a.TestClient().Post("/bytes", body, a.TestClient().WithHeader(http.HeaderProxyAuthorization, "secret"))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(resp.Body()), strconv.Itoa(len(body))))
+	fasthttp.ReleaseResponse(resp)
+
+	select {
+	case r := <-ch:
+		qt.Check(t, qt.Equals(r, ":"+strconv.Itoa(len(body))))
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not mirrored")
+	}
+
+	resp, err = a.TestClient().Post("/stream", body)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+	fasthttp.ReleaseResponse(resp)
+
+	waitCounter(t, fmt.Sprintf("mirror_requests_total{mirror=%q,result=%q}", shadow.String(), "skipped"), 1)
+}
+
+func TestProxyMirrorStreamedBody(t *testing.T) {
+	primary := make(chan string, 10)
+	u := testStreamUpstream(t, primary)
+
+	ch := make(chan string, 10)
+	shadow := testStreamUpstream(t, ch)
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Proxy("/api", ProxyUpstream(u), ProxyMirror(shadow, 100, MirrorMaxBodySize(8<<20)))
+
+	body := make([]byte, fasthttp.DefaultMaxRequestBodySize+1024)
+
+	resp, err := a.TestClient().Put("/api/users", body)
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+	qt.Check(t, qt.Equals(<-primary, ":"+strconv.Itoa(len(body))))
+
+	select {
+	case r := <-ch:
+		qt.Check(t, qt.Equals(r, ":"+strconv.Itoa(len(body))))
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not mirrored")
+	}
+}
@@ -27,6 +27,7 @@ type mux struct {
 	treeMutable        bool
 	customMethodsIndex map[http.Method]int
 	registeredPaths    map[http.Method][]string
+	proxies            map[string]*Proxy
 	// Router middlewares
 	middlewares []RequestHandlerFunc
 	// Priority middlewares run before (outer to) the regular middlewares.
@@ -51,6 +52,7 @@ func newMux(app *App) *mux {
 		trees:              make([]*radix.Tree, 11),
 		customMethodsIndex: make(map[http.Method]int),
 		registeredPaths:    make(map[http.Method][]string),
+		proxies:            make(map[string]*Proxy),
 		middlewares:        make([]RequestHandlerFunc, 0, 10),
 
 		RouterOptions: &RouterOptions{
@@ -120,6 +122,16 @@ func (m *mux) Routes() map[http.Method][]string {
 	return m.registeredPaths
 }
 
+// ProxyUpstreams returns the current upstreams of all registered proxies by proxy path.
+func (m *mux) ProxyUpstreams() map[string][]*ProxyTarget {
+	upstreams := make(map[string][]*ProxyTarget, len(m.proxies))
+	for path, p := range m.proxies {
+		upstreams[path] = p.Upstreams()
+	}
+
+	return upstreams
+}
+
 // Use appends a middleware to the router.
 // Middlewares will be executed in the order they were added.
 // It will be executed only for the routes that have been
@@ -583,6 +595,7 @@ func (m *mux) Trace(path string, handler RequestHandler) {
 // Proxy is helper to proxy requests to another host.
 func (m *mux) Proxy(path string, options ...ProxyOption) {
 	p := m.newUpstreamProxy(path, options...)
+	m.proxies[path] = p
 	m.Any(path, Handle(p))
 
 	if len(path) > 0 && path[len(path)-1] != '/' {
@@ -592,6 +605,11 @@ func (m *mux) Proxy(path string, options ...ProxyOption) {
 	m.Any(path+"{path:*}", Handle(p))
 }
 
+// Split splits traffic between variants proportionally to their weights.
+func (m *mux) Split(path string, options ...SplitOption) {
+	m.newSplit("", path, options...).register(path, m.Any)
+}
+
 // Any is a shortcut for all HTTP methods handler
 //
 // WARNING: Use only for routes where the request method is not important.
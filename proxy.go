@@ -19,6 +19,8 @@ type ProxyOptions struct {
 	TrustedNetworks []*net.IPNet
 	// TrustedHeaders represents headers that contain the client's real IP address and their preference.
 	TrustedHeaders []string
+	// TrustUnixSocket option sets to trust peers connected over unix domain socket.
+	TrustUnixSocket bool
 }
 
 var defaultProxyOptions = ProxyOptions{
@@ -31,6 +33,7 @@ var defaultProxyOptions = ProxyOptions{
 // Clear clears trusted proxy list.
 func (opts *ProxyOptions) Clear() {
 	opts.TrustAll = false
+	opts.TrustUnixSocket = false
 	opts.TrustedIPs = make([]net.IP, 0)
 	opts.TrustedNetworks = make([]*net.IPNet, 0)
 }
@@ -65,24 +68,23 @@ func (opts *ProxyOptions) Add(ipnet string) {
 	opts.TrustedIPs = append(opts.TrustedIPs, ipaddr)
 }
 
-// IsTrustedProxy checks whether the proxy that request is coming from can be trusted.
-func (c *Context) IsTrustedProxy() bool {
-	if c.RouterOptions().Proxy.TrustAll {
+// IsTrusted checks whether the proxy with the IP address can be trusted.
+func (opts *ProxyOptions) IsTrusted(ip net.IP) bool {
+	if opts.TrustAll {
 		return true
 	}
 
-	ip := c.IP()
 	if ip == nil {
 		return false
 	}
 
-	for _, tip := range c.RouterOptions().Proxy.TrustedIPs {
+	for _, tip := range opts.TrustedIPs {
 		if tip.Equal(ip) {
 			return true
 		}
 	}
 
-	for _, tnet := range c.RouterOptions().Proxy.TrustedNetworks {
+	for _, tnet := range opts.TrustedNetworks {
 		if tnet.Contains(ip) {
 			return true
 		}
@@ -90,3 +92,24 @@ func (c *Context) IsTrustedProxy() bool {
 
 	return false
 }
+
+// IsTrustedAddr checks whether the proxy with the network address can be trusted.
+func (opts *ProxyOptions) IsTrustedAddr(addr net.Addr) bool {
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		return opts.IsTrusted(addr.IP)
+	case *net.UnixAddr:
+		return opts.TrustAll || opts.TrustUnixSocket
+	default:
+		return opts.TrustAll
+	}
+}
+
+// IsTrustedProxy checks whether the proxy that request is coming from can be trusted.
+func (c *Context) IsTrustedProxy() bool {
+	if _, ok := c.context.RemoteAddr().(*net.UnixAddr); ok {
+		return c.RouterOptions().Proxy.IsTrustedAddr(c.context.RemoteAddr())
+	}
+
+	return c.RouterOptions().Proxy.IsTrusted(c.IP())
+}
@@ -0,0 +1,418 @@
+package azugo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PROXY protocol TLV types.
+//
+// ref: https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt
+const (
+	ProxyProtocolTLVALPN      byte = 0x01
+	ProxyProtocolTLVAuthority byte = 0x02
+	ProxyProtocolTLVCRC32C    byte = 0x03
+	ProxyProtocolTLVNoop      byte = 0x04
+	ProxyProtocolTLVUniqueID  byte = 0x05
+	ProxyProtocolTLVSSL       byte = 0x20
+	ProxyProtocolTLVNetNS     byte = 0x30
+	// ProxyProtocolTLVAWS is the AWS Network Load Balancer TLV type.
+	ProxyProtocolTLVAWS byte = 0xEA
+)
+
+const (
+	proxyProtocolSSLVersion   byte = 0x21
+	proxyProtocolSSLCN        byte = 0x22
+	proxyProtocolSSLCipher    byte = 0x23
+	proxyProtocolSSLSigAlg    byte = 0x24
+	proxyProtocolSSLKeyAlg    byte = 0x25
+	proxyProtocolAWSVPCEndpID byte = 0x01
+
+	// proxyProtocolV1MaxLength is the maximum length of the v1 header including CRLF.
+	proxyProtocolV1MaxLength = 107
+	// proxyProtocolHeaderTimeout is the time to wait for the header after the connection is accepted.
+	proxyProtocolHeaderTimeout = 10 * time.Second
+)
+
+var (
+	proxyProtocolV1Signature = []byte("PROXY ")
+	proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	errProxyProtocolInvalid = errors.New("invalid PROXY protocol header")
+)
+
+// ProxyProtocolTLV is the type-length-value entry of the PROXY protocol v2 header.
+type ProxyProtocolTLV struct {
+	Type  byte
+	Value []byte
+}
+
+// ProxyProtocolSSL is the TLS information of the client connection to the proxy.
+type ProxyProtocolSSL struct {
+	// Client is the bit field of the client connection flags.
+	Client byte
+	// Verified reports whether the client certificate has been verified.
+	Verified bool
+	// Version is the TLS version, ex. "TLSv1.3".
+	Version string
+	// CommonName is the client certificate subject common name.
+	CommonName string
+	// Cipher is the cipher used by the connection.
+	Cipher string
+	// SignatureAlgorithm is the server certificate signature algorithm.
+	SignatureAlgorithm string
+	// KeyAlgorithm is the server certificate key algorithm.
+	KeyAlgorithm string
+}
+
+// ProxyProtocolHeader is the PROXY protocol header sent by the load balancer.
+type ProxyProtocolHeader struct {
+	// Version of the PROXY protocol.
+	Version int
+	// Local reports whether the connection was established by the proxy itself,
+	// ex. for health checks. Addresses are not set in such case.
+	Local bool
+	// Source is the original client address.
+	Source net.Addr
+	// Destination is the original destination address.
+	Destination net.Addr
+	// TLVs are the additional v2 header entries.
+	TLVs []ProxyProtocolTLV
+}
+
+// TLV returns the value of the first entry with the type.
+func (h *ProxyProtocolHeader) TLV(typ byte) ([]byte, bool) {
+	if h == nil {
+		return nil, false
+	}
+
+	for _, tlv := range h.TLVs {
+		if tlv.Type == typ {
+			return tlv.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// Authority returns the host name the client has requested using SNI.
+func (h *ProxyProtocolHeader) Authority() string {
+	v, _ := h.TLV(ProxyProtocolTLVAuthority)
+
+	return string(v)
+}
+
+// AWSVPCEndpointID returns the AWS VPC endpoint ID the connection was received through.
+func (h *ProxyProtocolHeader) AWSVPCEndpointID() string {
+	v, ok := h.TLV(ProxyProtocolTLVAWS)
+	if !ok || len(v) == 0 || v[0] != proxyProtocolAWSVPCEndpID {
+		return ""
+	}
+
+	return string(v[1:])
+}
+
+// SSL returns the TLS information of the client connection or nil if the client
+// has not connected using TLS.
+func (h *ProxyProtocolHeader) SSL() *ProxyProtocolSSL {
+	v, ok := h.TLV(ProxyProtocolTLVSSL)
+	if !ok || len(v) < 5 {
+		return nil
+	}
+
+	ssl := &ProxyProtocolSSL{
+		Client:   v[0],
+		Verified: binary.BigEndian.Uint32(v[1:5]) == 0,
+	}
+
+	tlvs, err := parseProxyProtocolTLVs(v[5:])
+	if err != nil {
+		return nil
+	}
+
+	for _, tlv := range tlvs {
+		switch tlv.Type {
+		case proxyProtocolSSLVersion:
+			ssl.Version = string(tlv.Value)
+		case proxyProtocolSSLCN:
+			ssl.CommonName = string(tlv.Value)
+		case proxyProtocolSSLCipher:
+			ssl.Cipher = string(tlv.Value)
+		case proxyProtocolSSLSigAlg:
+			ssl.SignatureAlgorithm = string(tlv.Value)
+		case proxyProtocolSSLKeyAlg:
+			ssl.KeyAlgorithm = string(tlv.Value)
+		}
+	}
+
+	return ssl
+}
+
+// ProxyProtocol returns the PROXY protocol header of the connection or nil if
+// the connection has not been received through PROXY protocol enabled listener.
+func (c *Context) ProxyProtocol() *ProxyProtocolHeader {
+	conn := c.context.Conn()
+
+	for conn != nil {
+		if pc, ok := conn.(*proxyProtocolConn); ok {
+			pc.init()
+
+			return pc.header
+		}
+
+		// Unwrap TLS and cleartext HTTP/2 connections
+		nc, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			break
+		}
+
+		conn = nc.NetConn()
+	}
+
+	return nil
+}
+
+// proxyProtocolListener reads PROXY protocol header from connections of trusted proxies.
+type proxyProtocolListener struct {
+	net.Listener
+
+	opts *ProxyOptions
+}
+
+// newProxyProtocolListener returns listener that accepts PROXY protocol v1 and v2 headers
+// from trusted proxies. Connections from trusted proxies without the header, ex. health
+// checks, are served as direct connections.
+func newProxyProtocolListener(ln net.Listener, opts *ProxyOptions) net.Listener {
+	return &proxyProtocolListener{
+		Listener: ln,
+		opts:     opts,
+	}
+}
+
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	if !l.opts.IsTrustedAddr(conn.RemoteAddr()) {
+		return conn, nil
+	}
+
+	return &proxyProtocolConn{
+		Conn:   conn,
+		reader: bufio.NewReaderSize(conn, 256),
+	}, nil
+}
+
+// proxyProtocolConn reads the PROXY protocol header on the first use.
+type proxyProtocolConn struct {
+	net.Conn
+
+	reader *bufio.Reader
+	once   sync.Once
+	header *ProxyProtocolHeader
+	err    error
+}
+
+func (c *proxyProtocolConn) init() {
+	c.once.Do(func() {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(proxyProtocolHeaderTimeout))
+
+		c.header, c.err = readProxyProtocolHeader(c.reader)
+
+		_ = c.Conn.SetReadDeadline(time.Time{})
+	})
+}
+
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	c.init()
+
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the original client address from the PROXY protocol header.
+// It blocks until the header is read or the header read timeout is reached.
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.init()
+
+	if c.header != nil && c.header.Source != nil {
+		return c.header.Source
+	}
+
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyProtocolHeader reads v1 or v2 PROXY protocol header. Returns nil header
+// without error if the connection does not start with the PROXY protocol signature.
+func readProxyProtocolHeader(r *bufio.Reader) (*ProxyProtocolHeader, error) {
+	switch {
+	case hasProxyProtocolSignature(r, proxyProtocolV1Signature):
+		return readProxyProtocolV1(r)
+	case hasProxyProtocolSignature(r, proxyProtocolV2Signature):
+		return readProxyProtocolV2(r)
+	}
+
+	return nil, nil
+}
+
+// hasProxyProtocolSignature reports whether the buffered data starts with the signature.
+// Data is peeked only while it matches the signature so that short requests of direct
+// connections do not block.
+func hasProxyProtocolSignature(r *bufio.Reader, sig []byte) bool {
+	for i := 1; i <= len(sig); i++ {
+		b, err := r.Peek(i)
+		if err != nil || b[i-1] != sig[i-1] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func readProxyProtocolV1(r *bufio.Reader) (*ProxyProtocolHeader, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil || len(line) > proxyProtocolV1MaxLength || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errProxyProtocolInvalid
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+
+	h := &ProxyProtocolHeader{Version: 1}
+
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		h.Local = true
+
+		return h, nil
+	}
+
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errProxyProtocolInvalid
+	}
+
+	src, err := parseProxyProtocolV1Addr(fields[1], fields[2], fields[4])
+	if err != nil {
+		return nil, err
+	}
+
+	dst, err := parseProxyProtocolV1Addr(fields[1], fields[3], fields[5])
+	if err != nil {
+		return nil, err
+	}
+
+	h.Source, h.Destination = src, dst
+
+	return h, nil
+}
+
+func parseProxyProtocolV1Addr(proto, ip, port string) (*net.TCPAddr, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil || (proto == "TCP4") != (addr.To4() != nil) {
+		return nil, fmt.Errorf("%w: invalid address %q", errProxyProtocolInvalid, ip)
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid port %q", errProxyProtocolInvalid, port)
+	}
+
+	return &net.TCPAddr{IP: addr, Port: int(p)}, nil
+}
+
+func readProxyProtocolV2(r *bufio.Reader) (*ProxyProtocolHeader, error) {
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, errProxyProtocolInvalid
+	}
+
+	if hdr[12]>>4 != 2 {
+		return nil, fmt.Errorf("%w: unsupported version %d", errProxyProtocolInvalid, hdr[12]>>4)
+	}
+
+	h := &ProxyProtocolHeader{Version: 2}
+
+	switch hdr[12] & 0x0F {
+	case 0x00:
+		h.Local = true
+	case 0x01:
+	default:
+		return nil, fmt.Errorf("%w: unsupported command", errProxyProtocolInvalid)
+	}
+
+	data := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, errProxyProtocolInvalid
+	}
+
+	var addrLen int
+
+	switch hdr[13] >> 4 {
+	case 0x1:
+		addrLen = 12
+	case 0x2:
+		addrLen = 36
+	case 0x3:
+		addrLen = 216
+	}
+
+	if len(data) < addrLen {
+		return nil, errProxyProtocolInvalid
+	}
+
+	// Addresses are ignored for the LOCAL command and unsupported families
+	if !h.Local && hdr[13]&0x0F == 0x1 {
+		switch hdr[13] >> 4 {
+		case 0x1:
+			h.Source = &net.TCPAddr{IP: net.IP(data[0:4]), Port: int(binary.BigEndian.Uint16(data[8:10]))}
+			h.Destination = &net.TCPAddr{IP: net.IP(data[4:8]), Port: int(binary.BigEndian.Uint16(data[10:12]))}
+		case 0x2:
+			h.Source = &net.TCPAddr{IP: net.IP(data[0:16]), Port: int(binary.BigEndian.Uint16(data[32:34]))}
+			h.Destination = &net.TCPAddr{IP: net.IP(data[16:32]), Port: int(binary.BigEndian.Uint16(data[34:36]))}
+		}
+	}
+
+	tlvs, err := parseProxyProtocolTLVs(data[addrLen:])
+	if err != nil {
+		return nil, err
+	}
+
+	h.TLVs = tlvs
+
+	return h, nil
+}
+
+func parseProxyProtocolTLVs(data []byte) ([]ProxyProtocolTLV, error) {
+	var tlvs []ProxyProtocolTLV
+
+	for len(data) > 0 {
+		if len(data) < 3 {
+			return nil, fmt.Errorf("%w: truncated TLV", errProxyProtocolInvalid)
+		}
+
+		l := int(binary.BigEndian.Uint16(data[1:3]))
+		if len(data) < 3+l {
+			return nil, fmt.Errorf("%w: truncated TLV", errProxyProtocolInvalid)
+		}
+
+		if data[0] != ProxyProtocolTLVNoop {
+			tlvs = append(tlvs, ProxyProtocolTLV{Type: data[0], Value: data[3 : 3+l]})
+		}
+
+		data = data[3+l:]
+	}
+
+	return tlvs, nil
+}
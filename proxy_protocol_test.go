@@ -0,0 +1,182 @@
+package azugo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+	"github.com/valyala/fasthttp"
+)
+
+func proxyProtocolV2Header(src, dst *net.TCPAddr, tlvs ...ProxyProtocolTLV) []byte {
+	var data bytes.Buffer
+
+	_, _ = data.Write(src.IP.To4())
+	_, _ = data.Write(dst.IP.To4())
+	_ = binary.Write(&data, binary.BigEndian, uint16(src.Port))
+	_ = binary.Write(&data, binary.BigEndian, uint16(dst.Port))
+
+	for _, tlv := range tlvs {
+		_ = data.WriteByte(tlv.Type)
+		_ = binary.Write(&data, binary.BigEndian, uint16(len(tlv.Value)))
+		_, _ = data.Write(tlv.Value)
+	}
+
+	hdr := append([]byte{}, proxyProtocolV2Signature...)
+	hdr = append(hdr, 0x21, 0x11)
+	hdr = binary.BigEndian.AppendUint16(hdr, uint16(data.Len()))
+
+	return append(hdr, data.Bytes()...)
+}
+
+func TestProxyProtocolV1(t *testing.T) {
+	tests := []struct {
+		name, header, source string
+		local                bool
+		err                  string
+	}{
+		{"tcp4", "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n", "192.168.0.1:56324", false, ""},
+		{"tcp6", "PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n", "[2001:db8::1]:56324", false, ""},
+		{"unknown", "PROXY UNKNOWN\r\n", "", true, ""},
+		{"invalid address", "PROXY TCP4 2001:db8::1 192.168.0.11 56324 443\r\n", "", false, "invalid PROXY protocol header: invalid address.*"},
+		{"invalid port", "PROXY TCP4 192.168.0.1 192.168.0.11 65536 443\r\n", "", false, "invalid PROXY protocol header: invalid port.*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.header + "GET / HTTP/1.1\r\n"))
+
+			h, err := readProxyProtocolHeader(r)
+			if len(tt.err) > 0 {
+				qt.Check(t, qt.ErrorMatches(err, tt.err))
+
+				return
+			}
+
+			qt.Assert(t, qt.IsNil(err))
+			qt.Check(t, qt.Equals(h.Version, 1))
+			qt.Check(t, qt.Equals(h.Local, tt.local))
+
+			if len(tt.source) > 0 {
+				qt.Check(t, qt.Equals(h.Source.String(), tt.source))
+			}
+
+			rest, _ := io.ReadAll(r)
+			qt.Check(t, qt.Equals(string(rest), "GET / HTTP/1.1\r\n"))
+		})
+	}
+}
+
+func TestProxyProtocolMissing(t *testing.T) {
+	for _, data := range []string{"GET / HTTP/1.1\r\n", "PUT / HTTP/1.1\r\n", "PROX", "\r\n\r\n"} {
+		r := bufio.NewReader(strings.NewReader(data))
+
+		h, err := readProxyProtocolHeader(r)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Check(t, qt.IsNil(h))
+
+		rest, _ := io.ReadAll(r)
+		qt.Check(t, qt.Equals(string(rest), data))
+	}
+}
+
+func TestProxyProtocolV2(t *testing.T) {
+	ssl := []byte{0x01, 0, 0, 0, 0}
+	ssl = append(ssl, proxyProtocolSSLVersion, 0, 7)
+	ssl = append(ssl, "TLSv1.3"...)
+	ssl = append(ssl, proxyProtocolSSLCN, 0, 6)
+	ssl = append(ssl, "client"...)
+
+	hdr := proxyProtocolV2Header(
+		&net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 40000},
+		&net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 443},
+		ProxyProtocolTLV{Type: ProxyProtocolTLVAuthority, Value: []byte("example.com")},
+		ProxyProtocolTLV{Type: ProxyProtocolTLVSSL, Value: ssl},
+		ProxyProtocolTLV{Type: ProxyProtocolTLVAWS, Value: append([]byte{proxyProtocolAWSVPCEndpID}, "vpce-08d2bf15fac5001c9"...)},
+	)
+
+	h, err := readProxyProtocolHeader(bufio.NewReader(bytes.NewReader(hdr)))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(h.Version, 2))
+	qt.Check(t, qt.Equals(h.Source.String(), "10.0.0.1:40000"))
+	qt.Check(t, qt.Equals(h.Destination.String(), "10.0.0.2:443"))
+	qt.Check(t, qt.Equals(h.Authority(), "example.com"))
+	qt.Check(t, qt.Equals(h.AWSVPCEndpointID(), "vpce-08d2bf15fac5001c9"))
+	qt.Check(t, qt.DeepEquals(h.SSL(), &ProxyProtocolSSL{
+		Client:     0x01,
+		Verified:   true,
+		Version:    "TLSv1.3",
+		CommonName: "client",
+	}))
+
+	// Truncated TLV
+	hdr[15]--
+
+	_, err = readProxyProtocolHeader(bufio.NewReader(bytes.NewReader(hdr)))
+	qt.Check(t, qt.ErrorMatches(err, "invalid PROXY protocol header: truncated TLV"))
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	a := NewTestApp()
+
+	a.Get("/ip", func(ctx *Context) {
+		ctx.Text(ctx.IP().String() + " " + ctx.ProxyProtocol().AWSVPCEndpointID())
+	})
+
+	a.Start(t)
+	defer a.Stop()
+
+	serve := func(opts *ProxyOptions) string {
+		ln, err := net.Listen("tcp4", "127.0.0.1:0")
+		qt.Assert(t, qt.IsNil(err))
+
+		server := &fasthttp.Server{
+			Handler: a.Handler,
+		}
+
+		go func() {
+			_ = server.Serve(newProxyProtocolListener(ln, opts))
+		}()
+
+		t.Cleanup(func() { _ = server.Shutdown() })
+
+		return ln.Addr().String()
+	}
+
+	request := func(addr string, header []byte) string {
+		conn, err := net.Dial("tcp4", addr)
+		qt.Assert(t, qt.IsNil(err))
+
+		defer conn.Close()
+
+		_, err = conn.Write(append(header, "GET /ip HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"...))
+		qt.Assert(t, qt.IsNil(err))
+
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseResponse(resp)
+
+		qt.Assert(t, qt.IsNil(resp.Read(bufio.NewReader(conn))))
+
+		return string(resp.Body())
+	}
+
+	addr := serve(&ProxyOptions{TrustedIPs: []net.IP{net.IPv4(127, 0, 0, 1)}})
+
+	qt.Check(t, qt.Equals(request(addr, []byte("PROXY TCP4 203.0.113.7 127.0.0.1 5000 80\r\n")), "203.0.113.7 "))
+	qt.Check(t, qt.Equals(request(addr, proxyProtocolV2Header(
+		&net.TCPAddr{IP: net.IPv4(203, 0, 113, 8), Port: 5000},
+		&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 80},
+		ProxyProtocolTLV{Type: ProxyProtocolTLVAWS, Value: append([]byte{proxyProtocolAWSVPCEndpID}, "vpce-1"...)},
+	)), "203.0.113.8 vpce-1"))
+
+	// Trusted proxy can connect without the header
+	qt.Check(t, qt.Equals(request(addr, nil), "127.0.0.1 "))
+
+	// Header is not accepted from untrusted proxies
+	qt.Check(t, qt.Equals(request(serve(&ProxyOptions{}), nil), "127.0.0.1 "))
+}
@@ -3,6 +3,7 @@ package azugo
 import (
 	"bytes"
 	"context"
+	"crypto/x509"
 	"net"
 	"strings"
 	"time"
@@ -254,6 +255,22 @@ func (c *Context) IsTLS() bool {
 	return c.context.IsTLS()
 }
 
+// ClientCertificates returns the verified client certificate chain starting with
+// the client certificate or nil if the client has not provided a certificate or
+// it has not been verified.
+//
+// Certificates are never verified in the "request" client authentication mode so
+// nil is always returned. Unverified certificates provided by the client are available
+// from the TLS connection state PeerCertificates but must not be trusted.
+func (c *Context) ClientCertificates() []*x509.Certificate {
+	state := c.context.TLSConnectionState()
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return nil
+	}
+
+	return state.VerifiedChains[0]
+}
+
 // Host returns requested host.
 //
 // If the request comes from trusted proxy it will use X-Forwarded-Host header.
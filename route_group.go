@@ -113,6 +113,7 @@ func (g *RouteGroup) Trace(path string, handler RequestHandler) {
 // Proxy is helper to proxy requests to another host.
 func (g *RouteGroup) Proxy(path string, options ...ProxyOption) {
 	p := g.mux.newUpstreamProxy(path, options...)
+	g.mux.proxies[g.prefix+path] = p
 	handler := g.chain(Handle(p))
 
 	g.Any(path, handler)
@@ -124,6 +125,11 @@ func (g *RouteGroup) Proxy(path string, options ...ProxyOption) {
 	g.Any(path+"{path:*}", handler)
 }
 
+// Split splits traffic between variants proportionally to their weights.
+func (g *RouteGroup) Split(path string, options ...SplitOption) {
+	g.mux.newSplit(g.prefix, path, options...).register(path, g.Any)
+}
+
 // Any is a shortcut for all HTTP methods handler
 //
 // WARNING: Use only for routes where the request method is not important.
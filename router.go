@@ -92,6 +92,13 @@ type Router interface {
 	Any(path string, handler RequestHandler)
 }
 
+// Splitter is implemented by the application and route groups to split traffic
+// between variants.
+type Splitter interface {
+	// Split splits traffic between variants proportionally to their weights.
+	Split(path string, options ...SplitOption)
+}
+
 // RouterHandler is the interface for registering and serving routes.
 type RouterHandler interface {
 	Router
@@ -192,6 +199,7 @@ func (r *RouterOptions) ApplyConfig(conf *config.Configuration) {
 	r.Proxy.Clear()
 	r.Proxy.TrustedHeaders = conf.Proxy.TrustedHeaders
 	r.Proxy.ForwardLimit = conf.Proxy.Limit
+	r.Proxy.TrustUnixSocket = conf.Proxy.TrustUnixSocket
 
 	for _, p := range conf.Proxy.Address {
 		r.Proxy.Add(p)
@@ -238,6 +246,11 @@ func (a *App) Routes() map[http.Method][]string {
 	return a.defaultMux.Routes()
 }
 
+// ProxyUpstreams returns the current upstreams of all registered proxies by proxy path.
+func (a *App) ProxyUpstreams() map[string][]*ProxyTarget {
+	return a.defaultMux.ProxyUpstreams()
+}
+
 // Use appends a middleware to the router.
 // Middlewares will be executed in the order they were added.
 // It will be executed only for the routes that have been
@@ -305,6 +318,7 @@ func (a *App) Trace(path string, handler RequestHandler) {
 // Proxy is helper to proxy requests to another host.
 func (a *App) Proxy(path string, options ...ProxyOption) {
 	p := a.defaultMux.newUpstreamProxy(path, options...)
+	a.defaultMux.proxies[path] = p
 	a.Any(path, Handle(p))
 
 	if len(path) > 0 && path[len(path)-1] != '/' {
@@ -314,6 +328,16 @@ func (a *App) Proxy(path string, options ...ProxyOption) {
 	a.Any(path+"{path:*}", Handle(p))
 }
 
+// Split splits traffic between handlers or proxy upstream groups proportionally to
+// their weights, ex. to gradually roll out a new version:
+//
+//	app.Split("/api", azugo.Variant{Weight: 95, Handler: v1}, azugo.Variant{Weight: 5, Handler: v2})
+//
+// Selected variant name is returned in the X-Variant response header.
+func (a *App) Split(path string, options ...SplitOption) {
+	a.defaultMux.newSplit("", path, options...).register(path, a.Any)
+}
+
 // Any is a shortcut for all HTTP methods handler
 //
 // WARNING: Use only for routes where the request method is not important.
@@ -2,16 +2,23 @@
 package server
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net"
 	"os"
+	"time"
 
 	"azugo.io/core/http"
 	"github.com/spf13/cobra"
+	"github.com/valyala/fasthttp"
 	"go.uber.org/zap"
 )
 
+const healthTimeout = 10 * time.Second
+
 // HealthCommand returns a cobra command that checks whether the HTTP server is responding.
 // The healthzPath argument sets the health check endpoint path (e.g. "/healthz").
+// When the management server is enabled its health check endpoint is checked instead.
 //
 //	cli.Register(server.HealthCommand("/healthz", server.Options{Configuration: &myConf}))
 func HealthCommand(healthzPath string, opt Options) *cobra.Command {
@@ -33,22 +40,40 @@ func HealthCommand(healthzPath string, opt Options) *cobra.Command {
 			client := a.HTTPClient()
 
 			scheme := "http"
+			path := healthzPath
 			addr := conf.HTTP.Address
 			port := conf.HTTP.Port
+			socket := conf.HTTP.UnixSocket()
 
 			if !conf.HTTP.Enabled {
 				scheme = "https"
 				addr = conf.HTTPS.Address
 				port = conf.HTTPS.Port
+				socket = conf.HTTPS.UnixSocket()
 				client = client.WithOptions(&http.TLSConfig{InsecureSkipVerify: true})
 			}
 
-			if addr == "" || addr == "0.0.0.0" {
-				addr = "localhost"
+			// Health check endpoint is served by the management server when it is enabled
+			if m := conf.Management; m != nil && m.Enabled {
+				scheme = "http"
+				addr = m.Address
+				port = m.Port
+				socket = m.UnixSocket()
+				client = a.HTTPClient()
+				path = managementHealthzPath
 			}
 
-			url := fmt.Sprintf("%s://%s:%d%s", scheme, addr, port, healthzPath)
-			if _, err = client.Get(url); err != nil {
+			if len(socket) > 0 {
+				err = unixSocketHealth(socket, scheme+"://localhost"+path)
+			} else {
+				if addr == "" || addr == "0.0.0.0" {
+					addr = "localhost"
+				}
+
+				_, err = client.Get(fmt.Sprintf("%s://%s:%d%s", scheme, addr, port, path))
+			}
+
+			if err != nil {
 				a.Log().Error("server health check failed", zap.Error(err))
 				os.Exit(1)
 
@@ -59,3 +84,33 @@ func HealthCommand(healthzPath string, opt Options) *cobra.Command {
 		},
 	}
 }
+
+// unixSocketHealth checks the health endpoint of the server listening on the unix domain socket.
+func unixSocketHealth(socket, url string) error {
+	client := &fasthttp.Client{
+		Dial: func(_ string) (net.Conn, error) {
+			return net.DialTimeout("unix", socket, healthTimeout)
+		},
+		TLSConfig: &tls.Config{
+			InsecureSkipVerify: true, //nolint:gosec
+		},
+	}
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.SetRequestURI(url)
+
+	if err := client.DoTimeout(req, resp, healthTimeout); err != nil {
+		return err
+	}
+
+	if resp.StatusCode() != fasthttp.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode())
+	}
+
+	return nil
+}
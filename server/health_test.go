@@ -0,0 +1,95 @@
+package server
+
+import (
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"azugo.io/azugo"
+	"azugo.io/azugo/config"
+	"github.com/go-quicktest/qt"
+	"github.com/spf13/cobra"
+	"github.com/valyala/fasthttp"
+)
+
+func TestUnixSocketHealth(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "app.sock")
+
+	ln, err := net.Listen("unix", socket)
+	qt.Assert(t, qt.IsNil(err))
+
+	s := &fasthttp.Server{
+		Handler: func(ctx *fasthttp.RequestCtx) {
+			if string(ctx.Path()) != "/healthz" {
+				ctx.SetStatusCode(fasthttp.StatusNotFound)
+			}
+		},
+	}
+
+	go func() { _ = s.Serve(ln) }()
+	defer func() { _ = s.Shutdown() }()
+
+	qt.Check(t, qt.IsNil(unixSocketHealth(socket, "http://localhost/healthz")))
+	qt.Check(t, qt.ErrorMatches(unixSocketHealth(socket, "http://localhost/missing"), "unexpected status code 404"))
+}
+
+func TestHealthProxyProtocol(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	qt.Assert(t, qt.IsNil(err))
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	qt.Assert(t, qt.IsNil(ln.Close()))
+
+	tests := []struct {
+		name, url, network, addr string
+	}{
+		{"tcp", "http://127.0.0.1:" + strconv.Itoa(port), "tcp4", "127.0.0.1:" + strconv.Itoa(port)},
+		{"unix", "http+unix://" + filepath.Join(t.TempDir(), "app.sock"), "unix", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SERVER_URLS", tt.url)
+			t.Setenv("SERVER_HTTP_PROXY_PROTOCOL", "true")
+
+			a, err := New(&cobra.Command{Use: "test"}, Options{
+				AppName:       "Azugo TestApp",
+				Configuration: config.New(),
+			})
+			qt.Assert(t, qt.IsNil(err))
+			qt.Assert(t, qt.IsTrue(a.Config().Server.HTTP.ProxyProtocol))
+
+			a.Get("/healthz", func(ctx *azugo.Context) {
+				ctx.Text("ok")
+			})
+
+			go func() { _ = a.Start() }()
+			defer a.Stop()
+
+			addr := tt.addr
+			if len(addr) == 0 {
+				addr = a.Config().Server.HTTP.UnixSocket()
+			}
+
+			// Wait for the server to start listening
+			for range 50 {
+				if conn, err := net.Dial(tt.network, addr); err == nil {
+					_ = conn.Close()
+
+					break
+				}
+
+				time.Sleep(100 * time.Millisecond)
+			}
+
+			// Health probe does not send PROXY protocol header
+			cmd := HealthCommand("/healthz", Options{
+				AppName:       "Azugo TestApp",
+				Configuration: config.New(),
+			})
+			qt.Check(t, qt.IsNil(cmd.RunE(cmd, nil)))
+		})
+	}
+}
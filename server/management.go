@@ -0,0 +1,81 @@
+package server
+
+import (
+	"azugo.io/azugo"
+	"azugo.io/azugo/healthz"
+	"azugo.io/azugo/middleware"
+)
+
+// managementHealthzPath is the path of the health check endpoint on the management server.
+const managementHealthzPath = "/healthz"
+
+type healthChecksOpt struct {
+	checks []healthz.CheckFunc
+}
+
+func (o *healthChecksOpt) apply(opt *options) {
+	opt.healthChecks = append(opt.healthChecks, o.checks...)
+}
+
+// HealthChecks adds checks to the health check endpoint of the management server.
+func HealthChecks(checks ...healthz.CheckFunc) Option {
+	return &healthChecksOpt{checks: checks}
+}
+
+// managementUpstream is the proxy upstream state returned by the admin endpoint.
+type managementUpstream struct {
+	URL         string `json:"url"`
+	Weight      int    `json:"weight"`
+	Healthy     bool   `json:"healthy"`
+	Outstanding int64  `json:"outstanding"`
+}
+
+// registerManagementRoutes mounts metrics, health check, profiling and
+// administration endpoints on the management router.
+func registerManagementRoutes(a *azugo.App, opt *options) {
+	m := a.Management()
+	conf := a.Config()
+
+	if conf.Metrics.Enabled {
+		m.Get(conf.Metrics.Path, middleware.MetricsHandler())
+	}
+
+	m.Get(managementHealthzPath, healthz.Handler(opt.healthChecks...))
+
+	if conf.Server.Management.Pprof {
+		m.Any("/debug/pprof/{path:*}", azugo.PprofHandler)
+	}
+
+	if !conf.Server.Management.Admin {
+		return
+	}
+
+	admin := m.Group("/admin")
+
+	admin.Get("/routes", func(ctx *azugo.Context) {
+		ctx.JSON(a.Routes())
+	})
+
+	admin.Get("/upstreams", func(ctx *azugo.Context) {
+		proxies := a.ProxyUpstreams()
+
+		resp := make(map[string][]managementUpstream, len(proxies))
+
+		for path, targets := range proxies {
+			upstreams := make([]managementUpstream, 0, len(targets))
+
+			for _, t := range targets {
+				upstreams = append(upstreams, managementUpstream{
+					URL:         t.URL().String(),
+					Weight:      t.Weight(),
+					Healthy:     t.Healthy(),
+					Outstanding: t.Outstanding(),
+				})
+			}
+
+			resp[path] = upstreams
+		}
+
+		ctx.JSON(resp)
+	})
+}
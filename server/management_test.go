@@ -0,0 +1,110 @@
+package server
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"azugo.io/azugo"
+	"azugo.io/azugo/config"
+	"azugo.io/azugo/healthz"
+
+	"azugo.io/core/http"
+	"github.com/go-quicktest/qt"
+	"github.com/spf13/cobra"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func TestManagementRoutes(t *testing.T) {
+	t.Setenv("SERVER_MANAGEMENT_ENABLED", "true")
+	t.Setenv("SERVER_MANAGEMENT_ADMIN", "true")
+
+	a, err := New(&cobra.Command{Use: "test"}, Options{
+		AppName:       "Azugo TestApp",
+		Configuration: config.New(),
+	}, HealthChecks(func(_ *azugo.Context) *healthz.Response {
+		return &healthz.Response{Status: healthz.Warn, Description: "degraded"}
+	}))
+	qt.Assert(t, qt.IsNil(err))
+
+	ta := azugo.NewTestApp(a)
+	ta.Start(t)
+	defer ta.Stop()
+
+	ln := fasthttputil.NewInmemoryListener()
+	server := &fasthttp.Server{Handler: a.Management().Handler}
+
+	go func() {
+		_ = server.Serve(ln)
+	}()
+	defer func() { _ = server.Shutdown() }()
+
+	c := &fasthttp.Client{
+		Dial: func(_ string) (net.Conn, error) {
+			return ln.Dial()
+		},
+	}
+
+	get := func(path string) (int, string) {
+		status, body, err := c.Get(nil, "http://management"+path)
+		qt.Assert(t, qt.IsNil(err))
+
+		return status, string(body)
+	}
+
+	status, body := get("/metrics")
+	qt.Check(t, qt.Equals(status, http.StatusOK))
+	qt.Check(t, qt.IsTrue(strings.Contains(body, "go_goroutines")))
+
+	status, body = get("/healthz")
+	qt.Check(t, qt.Equals(status, http.StatusOK))
+	qt.Check(t, qt.Equals(body, `{"status":"warn","description":"degraded"}`))
+
+	status, _ = get("/admin/routes")
+	qt.Check(t, qt.Equals(status, http.StatusOK))
+
+	status, _ = get("/debug/pprof/cmdline")
+	qt.Check(t, qt.Equals(status, http.StatusNotFound))
+
+	// Metrics are not served by the public server
+	resp, err := ta.TestClient().Get("/metrics")
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusNotFound))
+	fasthttp.ReleaseResponse(resp)
+}
+
+func TestManagementAdminDisabled(t *testing.T) {
+	t.Setenv("SERVER_MANAGEMENT_ENABLED", "true")
+
+	a, err := New(&cobra.Command{Use: "test"}, Options{
+		AppName:       "Azugo TestApp",
+		Configuration: config.New(),
+	})
+	qt.Assert(t, qt.IsNil(err))
+
+	// Management server listens only on the loopback interface by default
+	qt.Check(t, qt.Equals(a.Config().Server.Management.Address, "127.0.0.1"))
+
+	ln := fasthttputil.NewInmemoryListener()
+	server := &fasthttp.Server{Handler: a.Management().Handler}
+
+	go func() {
+		_ = server.Serve(ln)
+	}()
+	defer func() { _ = server.Shutdown() }()
+
+	c := &fasthttp.Client{
+		Dial: func(_ string) (net.Conn, error) {
+			return ln.Dial()
+		},
+	}
+
+	status, _, err := c.Get(nil, "http://management/healthz")
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(status, http.StatusOK))
+
+	status, _, err = c.Get(nil, "http://management/admin/routes")
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(status, http.StatusNotFound))
+}
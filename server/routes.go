@@ -0,0 +1,203 @@
+package server
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+
+	"azugo.io/azugo"
+	"azugo.io/azugo/config"
+)
+
+// registerProxyRoutes registers proxy routes declared in the configuration.
+func registerProxyRoutes(a *azugo.App, routes *config.Routes) error {
+	if routes == nil {
+		return nil
+	}
+
+	for _, r := range routes.Proxy {
+		opts, err := proxyRouteOptions(r)
+		if err != nil {
+			return fmt.Errorf("invalid proxy route %s: %w", r.Path, err)
+		}
+
+		a.Proxy(r.Path, opts...)
+	}
+
+	return nil
+}
+
+// proxyRouteOptions converts proxy route configuration to proxy options.
+func proxyRouteOptions(r *config.ProxyRoute) ([]azugo.ProxyOption, error) {
+	opts := make([]azugo.ProxyOption, 0, len(r.Upstreams)+8)
+
+	for _, u := range r.Upstreams {
+		upstream, err := url.Parse(u.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		weight := 1
+		if u.Weight != nil {
+			weight = *u.Weight
+		}
+
+		opts = append(opts, azugo.ProxyUpstreamWeight(weight, upstream))
+	}
+
+	balancer, err := proxyBalancer(r.Balancer, r.HashKey)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append(opts, azugo.ProxyUpstreamBalancer(balancer))
+
+	if r.Retry != nil {
+		opts = append(opts, azugo.ProxyRetry{
+			Attempts:      r.Retry.Attempts,
+			StatusCodes:   r.Retry.StatusCodes,
+			NonIdempotent: r.Retry.NonIdempotent,
+			TryTimeout:    r.Retry.TryTimeout,
+			Timeout:       r.Timeout,
+			Budget:        r.Retry.Budget,
+			BudgetBurst:   r.Retry.BudgetBurst,
+			MaxBodySize:   r.Retry.MaxBodySize,
+		})
+	} else if r.Timeout > 0 {
+		// Single attempt with the overall deadline
+		opts = append(opts, azugo.ProxyRetry{
+			Attempts: 1,
+			Timeout:  r.Timeout,
+		})
+	}
+
+	if r.HealthCheck != nil {
+		opts = append(opts, azugo.ProxyHealthCheck{
+			Path:     r.HealthCheck.Path,
+			Status:   r.HealthCheck.Status,
+			Interval: r.HealthCheck.Interval,
+			Timeout:  r.HealthCheck.Timeout,
+		})
+	}
+
+	if len(r.Host) > 0 {
+		opts = append(opts, azugo.ProxyUpstreamHost(r.Host))
+	}
+
+	if r.KeepPrefix {
+		opts = append(opts, azugo.ProxyKeepPrefix(true))
+	}
+
+	for _, rw := range r.PathRewrite {
+		opts = append(opts, azugo.ProxyPathRewrite(rw.Pattern, rw.Replacement))
+	}
+
+	if h := r.RequestHeaders; h != nil {
+		if len(h.Remove) > 0 {
+			opts = append(opts, azugo.ProxyRequestHeaderRemove(h.Remove...))
+		}
+
+		// Headers are modified in a stable order as map iteration order is random
+		for _, k := range slices.Sorted(maps.Keys(h.Set)) {
+			opts = append(opts, azugo.ProxyRequestHeaderSet(k, h.Set[k]))
+		}
+
+		for _, k := range slices.Sorted(maps.Keys(h.Add)) {
+			opts = append(opts, azugo.ProxyRequestHeaderAdd(k, h.Add[k]))
+		}
+	}
+
+	if h := r.ResponseHeaders; h != nil {
+		if len(h.Remove) > 0 {
+			opts = append(opts, azugo.ProxyResponseHeaderRemove(h.Remove...))
+		}
+
+		for _, k := range slices.Sorted(maps.Keys(h.Set)) {
+			opts = append(opts, azugo.ProxyResponseHeaderSet(k, h.Set[k]))
+		}
+
+		for _, k := range slices.Sorted(maps.Keys(h.Add)) {
+			opts = append(opts, azugo.ProxyResponseHeaderAdd(k, h.Add[k]))
+		}
+	}
+
+	for _, b := range r.BodyReplace {
+		opts = append(opts, azugo.ProxyUpstreamBodyReplaceText(b.From, b.To))
+	}
+
+	if r.BodyReplaceURL != nil {
+		opts = append(opts, azugo.ProxyUpstreamBodyReplaceURL(*r.BodyReplaceURL))
+	}
+
+	if t := r.TLS; t != nil {
+		suites, err := t.TLSCipherSuites()
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts,
+			azugo.ProxyUpstreamInsecureSkipVerify(t.InsecureSkipVerify),
+			azugo.ProxyUpstreamTLSMinVersion(t.TLSMinVersion()),
+			azugo.ProxyUpstreamTLSCipherSuites(suites...),
+		)
+
+		if len(t.CAFile) > 0 {
+			opts = append(opts, azugo.ProxyUpstreamRootCA(t.CAFile))
+		}
+
+		if len(t.CertFile) > 0 {
+			opts = append(opts, azugo.ProxyUpstreamClientCert(t.CertFile, t.KeyFile))
+		}
+
+		if len(t.ServerName) > 0 {
+			opts = append(opts, azugo.ProxyUpstreamServerName(t.ServerName))
+		}
+	}
+
+	return opts, nil
+}
+
+// proxyBalancer returns the load balancer by its configuration name.
+func proxyBalancer(name, hashKey string) (azugo.ProxyBalancer, error) {
+	switch name {
+	case "", "round-robin":
+		return azugo.ProxyRoundRobin(), nil
+	case "weighted-round-robin":
+		return azugo.ProxyWeightedRoundRobin(), nil
+	case "least-outstanding":
+		return azugo.ProxyLeastOutstanding(), nil
+	case "random-two-choices":
+		return azugo.ProxyRandomTwoChoices(), nil
+	case "consistent-hash":
+		key, err := proxyHashKey(hashKey)
+		if err != nil {
+			return nil, err
+		}
+
+		return azugo.ProxyConsistentHash(key), nil
+	default:
+		return nil, fmt.Errorf("unsupported proxy balancer %q", name)
+	}
+}
+
+// proxyHashKey returns the consistent hash key by its configuration value.
+func proxyHashKey(key string) (azugo.ProxyHashKey, error) {
+	if name, ok := strings.CutPrefix(key, "header:"); ok && len(name) > 0 {
+		return azugo.ProxyHashKeyHeader(name), nil
+	}
+
+	if name, ok := strings.CutPrefix(key, "cookie:"); ok && len(name) > 0 {
+		return azugo.ProxyHashKeyCookie(name), nil
+	}
+
+	switch key {
+	case "client-ip":
+		return azugo.ProxyHashKeyClientIP(), nil
+	case "user-id":
+		return azugo.ProxyHashKeyUserID(), nil
+	default:
+		return nil, fmt.Errorf("unsupported proxy hash key %q", key)
+	}
+}
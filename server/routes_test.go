@@ -0,0 +1,207 @@
+package server
+
+import (
+	"net"
+	"testing"
+
+	"azugo.io/azugo"
+	"azugo.io/azugo/config"
+	"azugo.io/core/http"
+	"azugo.io/core/validation"
+	"github.com/go-quicktest/qt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/valyala/fasthttp"
+)
+
+func TestProxyRoutesFromConfig(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	qt.Assert(t, qt.IsNil(err))
+
+	upstream := &fasthttp.Server{
+		Handler: func(ctx *fasthttp.RequestCtx) {
+			ctx.Response.Header.Set("X-Internal", "secret")
+			if string(ctx.Path()) == "/link" {
+				ctx.SetContentType("text/plain")
+				ctx.SetBodyString("http://" + ln.Addr().String() + "/link")
+
+				return
+			}
+
+			if string(ctx.Path()) == "/internal/headers" {
+				ctx.SetBody(ctx.Request.Header.RawHeaders())
+
+				return
+			}
+
+			ctx.SetBodyString(string(ctx.Path()) + " " + string(ctx.Request.Header.Peek("X-Route")))
+		},
+	}
+
+	go func() {
+		_ = upstream.Serve(ln)
+	}()
+
+	defer func() {
+		_ = upstream.Shutdown()
+	}()
+
+	conf := config.New()
+	conf.Routes = &config.Routes{
+		Proxy: []*config.ProxyRoute{
+			{
+				Path:      "/api",
+				Upstreams: []*config.ProxyUpstream{{URL: "http://" + ln.Addr().String()}},
+				Balancer:  "consistent-hash",
+				HashKey:   "header:X-User",
+				PathRewrite: []*config.ProxyPathRewrite{
+					{Pattern: `^/v1(/.*)$`, Replacement: "/internal$1"},
+				},
+				RequestHeaders: &config.ProxyHeaders{
+					Set: map[string]string{"X-Route": "api", "X-A": "1", "X-B": "2", "X-C": "3", "X-D": "4"},
+					Add: map[string]string{"X-E": "5", "X-F": "6", "X-G": "7"},
+				},
+				ResponseHeaders: &config.ProxyHeaders{Remove: []string{"X-Internal"}},
+			},
+			{
+				Path:           "/raw",
+				Upstreams:      []*config.ProxyUpstream{{URL: "http://" + ln.Addr().String()}},
+				BodyReplaceURL: new(bool),
+			},
+		},
+	}
+
+	a, err := New(&cobra.Command{Use: "test"}, Options{
+		AppName:       "Azugo TestApp",
+		Configuration: conf,
+	})
+	qt.Assert(t, qt.IsNil(err))
+
+	ta := azugo.NewTestApp(a)
+	ta.Start(t)
+	defer ta.Stop()
+
+	resp, err := ta.TestClient().Get("/api/v1/users")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+	qt.Check(t, qt.Equals(string(resp.Body()), "/internal/users api"))
+	qt.Check(t, qt.HasLen(resp.Header.Peek("X-Internal"), 0))
+
+	// Headers are set in the order of their names
+	resp, err = ta.TestClient().Get("/api/v1/headers")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Matches(string(resp.Body()), `(?s).*X-A: 1.*X-B: 2.*X-C: 3.*X-D: 4.*X-Route: api.*X-E: 5.*X-F: 6.*X-G: 7.*`))
+
+	// Upstream URL in the response body is replaced unless disabled
+	resp, err = ta.TestClient().Get("/api/link")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Not(qt.Equals(string(resp.Body()), "http://"+ln.Addr().String()+"/link")))
+
+	resp, err = ta.TestClient().Get("/raw/link")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(resp.Body()), "http://"+ln.Addr().String()+"/link"))
+}
+
+func TestProxyRoutesBind(t *testing.T) {
+	t.Setenv("ROUTES_PROXY", `[{"path": "/api", "upstreams": [{"url": "http://localhost:8080"}], "keep_prefix": true}]`)
+
+	v := viper.New()
+
+	routes := &config.Routes{}
+	routes.Bind("routes", v)
+
+	qt.Assert(t, qt.IsNil(v.UnmarshalKey("routes", routes)))
+	qt.Assert(t, qt.HasLen(routes.Proxy, 1))
+	qt.Check(t, qt.Equals(routes.Proxy[0].Path, "/api"))
+	qt.Check(t, qt.Equals(routes.Proxy[0].Upstreams[0].URL, "http://localhost:8080"))
+	qt.Check(t, qt.IsTrue(routes.Proxy[0].KeepPrefix))
+	qt.Check(t, qt.IsNil(routes.Validate(validation.New())))
+
+	t.Setenv("ROUTES_PROXY", "not json")
+
+	v = viper.New()
+	routes = &config.Routes{}
+	routes.Bind("routes", v)
+
+	qt.Check(t, qt.IsNotNil(v.UnmarshalKey("routes", routes)))
+}
+
+func TestProxyRoutesValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		route *config.ProxyRoute
+		valid bool
+	}{
+		{
+			name: "valid",
+			route: &config.ProxyRoute{
+				Path:      "/api",
+				Upstreams: []*config.ProxyUpstream{{URL: "http://localhost:8080"}},
+			},
+			valid: true,
+		},
+		{
+			name: "no upstreams",
+			route: &config.ProxyRoute{
+				Path: "/api",
+			},
+		},
+		{
+			name: "invalid path",
+			route: &config.ProxyRoute{
+				Path:      "api",
+				Upstreams: []*config.ProxyUpstream{{URL: "http://localhost:8080"}},
+			},
+		},
+		{
+			name: "missing hash key",
+			route: &config.ProxyRoute{
+				Path:      "/api",
+				Upstreams: []*config.ProxyUpstream{{URL: "http://localhost:8080"}},
+				Balancer:  "consistent-hash",
+			},
+		},
+		{
+			name: "invalid hash key",
+			route: &config.ProxyRoute{
+				Path:      "/api",
+				Upstreams: []*config.ProxyUpstream{{URL: "http://localhost:8080"}},
+				Balancer:  "consistent-hash",
+				HashKey:   "query:id",
+			},
+		},
+		{
+			name: "invalid path rewrite",
+			route: &config.ProxyRoute{
+				Path:        "/api",
+				Upstreams:   []*config.ProxyUpstream{{URL: "http://localhost:8080"}},
+				PathRewrite: []*config.ProxyPathRewrite{{Pattern: "(", Replacement: "/"}},
+			},
+		},
+		{
+			name: "invalid cipher suite",
+			route: &config.ProxyRoute{
+				Path:      "/api",
+				Upstreams: []*config.ProxyUpstream{{URL: "https://localhost:8443"}},
+				TLS:       &config.ProxyTLS{CipherSuites: []string{"TLS_NONE"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routes := &config.Routes{Proxy: []*config.ProxyRoute{tt.route}}
+
+			err := routes.Validate(validation.New())
+			if tt.valid {
+				qt.Check(t, qt.IsNil(err))
+			} else {
+				qt.Check(t, qt.IsNotNil(err))
+			}
+		})
+	}
+}
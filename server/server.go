@@ -6,6 +6,7 @@ import (
 
 	"azugo.io/azugo"
 	"azugo.io/azugo/config"
+	"azugo.io/azugo/healthz"
 	"azugo.io/azugo/middleware"
 
 	"azugo.io/core/server"
@@ -28,6 +29,8 @@ type options struct {
 	appOpt               Options
 	disableAutoRateLimit bool
 	rateLimitOptions     []middleware.RateLimitOption
+	concurrencyOptions   []middleware.ConcurrencyOption
+	healthChecks         []healthz.CheckFunc
 }
 
 type disableAutoRateLimitOpt struct{}
@@ -56,6 +59,20 @@ func RateLimitOptions(opts ...middleware.RateLimitOption) Option {
 	return &rateLimitOptionsOpt{opts: opts}
 }
 
+type concurrencyOptionsOpt struct {
+	opts []middleware.ConcurrencyOption
+}
+
+func (o *concurrencyOptionsOpt) apply(opt *options) {
+	opt.concurrencyOptions = append(opt.concurrencyOptions, o.opts...)
+}
+
+// ConcurrencyOptions configures the automatic concurrency limit middleware with
+// additional options.
+func ConcurrencyOptions(opts ...middleware.ConcurrencyOption) Option {
+	return &concurrencyOptionsOpt{opts: opts}
+}
+
 // newApp creates a new Azugo app with configuration loaded but without any middlewares.
 func newApp(cmd *cobra.Command, opt Options) (*azugo.App, error) {
 	var conf *config.Configuration
@@ -104,16 +121,35 @@ func New(cmd *cobra.Command, opts ...Option) (*azugo.App, error) {
 	a.UsePriority(middleware.RealIP)
 	// Log requests
 	a.UsePriority(middleware.RequestLogger)
+	// Management server serves metrics, health check and admin endpoints
+	management := a.Config().Server.Management != nil && a.Config().Server.Management.Enabled
+	if management {
+		registerManagementRoutes(a, opt)
+	}
 	// Provide metrics
 	if a.Config().Metrics.Enabled {
-		a.Use(middleware.Metrics(a.Config().Metrics.Path))
+		path := a.Config().Metrics.Path
+		if management {
+			// Metrics are served only by the management server
+			path = ""
+		}
+
+		a.Use(middleware.Metrics(path))
 	}
 	// Support CORS headers
 	a.Use(middleware.CORS(&a.RouterOptions().CORS))
+	// Optional load shedding when the server is overloaded
+	if a.Config().Concurrency.Enabled {
+		a.Use(middleware.Concurrency(a.Config().Concurrency, opt.concurrencyOptions...))
+	}
 	// Optional global request rate limiting
 	if !opt.disableAutoRateLimit && a.Config().RateLimit.Enabled {
 		a.Use(middleware.RateLimit(a.Config().RateLimit, opt.rateLimitOptions...))
 	}
+	// Proxy routes declared in configuration
+	if err := registerProxyRoutes(a, a.Config().Routes); err != nil {
+		return nil, err
+	}
 
 	return a, nil
 }
@@ -0,0 +1,301 @@
+package azugo
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"azugo.io/azugo/config"
+
+	"azugo.io/core/cert"
+	"github.com/VictoriaMetrics/metrics"
+	"go.uber.org/zap"
+)
+
+// selfSignedCertificate is the name of the generated development certificate.
+const selfSignedCertificate = "self-signed"
+
+// serverCertificate is the loaded TLS certificate and the state of its files.
+type serverCertificate struct {
+	name   string
+	files  config.ServerCertificate
+	stamps []certificateFileStamp
+	cert   *tls.Certificate
+	metric string
+}
+
+type certificateFileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// serverCertificates holds the TLS certificates used by the HTTPS server. Certificates
+// are swapped atomically when the files change.
+type serverCertificates struct {
+	app   *App
+	certs atomic.Pointer[[]*serverCertificate]
+}
+
+// loadServerCertificates loads the configured certificates or generates the self-signed
+// development certificate if there are none.
+func (a *App) loadServerCertificates(conf *config.ServerTLS) (*serverCertificates, error) {
+	s := &serverCertificates{app: a}
+
+	files := conf.CertificateFiles()
+	certs := make([]*serverCertificate, 0, max(len(files), 1))
+
+	for _, f := range files {
+		c := &serverCertificate{
+			name:  f.CertificatePEMFile,
+			files: f,
+		}
+
+		if err := c.load(); err != nil {
+			return nil, err
+		}
+
+		certs = append(certs, c)
+	}
+
+	if len(certs) == 0 {
+		certData, keyData, err := cert.DevPEMFile("azugo", "localhost")
+		if err != nil {
+			return nil, fmt.Errorf("failed to load or generate self-signed TLS certificate: %w", err)
+		}
+
+		crt, err := tls.X509KeyPair(certData, keyData)
+		if err != nil {
+			return nil, err
+		}
+
+		certs = append(certs, &serverCertificate{
+			name: selfSignedCertificate,
+			cert: &crt,
+		})
+	}
+
+	for _, c := range certs {
+		c.updateMetric("")
+	}
+
+	s.certs.Store(&certs)
+
+	if conf.CertificateReloadInterval > 0 && len(files) > 0 {
+		a.runTaskOnce(func(ctx context.Context) {
+			s.watch(ctx, conf.CertificateReloadInterval)
+		})
+	}
+
+	return s, nil
+}
+
+// serverTLSConfig returns the HTTPS server TLS configuration.
+func serverTLSConfig(conf *config.ServerTLS, certs *serverCertificates) (*tls.Config, error) {
+	c := &tls.Config{
+		GetCertificate: certs.GetCertificate,
+		ClientAuth:     conf.ClientAuth.TLSClientAuth(),
+		MinVersion:     tls.VersionTLS12,
+	}
+
+	if len(conf.ClientCAFile) > 0 {
+		data, err := os.ReadFile(conf.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		c.ClientCAs = x509.NewCertPool()
+		if !c.ClientCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", conf.ClientCAFile)
+		}
+	}
+
+	return c, nil
+}
+
+// GetCertificate returns the certificate matching the SNI server name or
+// the default certificate if there is no match.
+func (s *serverCertificates) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certs := *s.certs.Load()
+
+	if len(certs) > 1 && len(hello.ServerName) > 0 {
+		for _, c := range certs {
+			if c.cert.Leaf.VerifyHostname(hello.ServerName) == nil {
+				return c.cert, nil
+			}
+		}
+	}
+
+	return certs[0].cert, nil
+}
+
+// Certificates returns the certificates in use.
+func (s *serverCertificates) Certificates() []*x509.Certificate {
+	certs := *s.certs.Load()
+
+	list := make([]*x509.Certificate, 0, len(certs))
+	for _, c := range certs {
+		list = append(list, c.cert.Leaf)
+	}
+
+	return list
+}
+
+func (s *serverCertificates) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.reload()
+		}
+	}
+}
+
+// reload reloads certificates which files have changed. Certificate that fails
+// to load is kept in use until the files are fixed.
+func (s *serverCertificates) reload() {
+	current := *s.certs.Load()
+
+	certs := make([]*serverCertificate, 0, len(current))
+	changed := false
+
+	for _, c := range current {
+		if c.name == selfSignedCertificate || !c.changed() {
+			certs = append(certs, c)
+
+			continue
+		}
+
+		n := &serverCertificate{
+			name:  c.name,
+			files: c.files,
+		}
+
+		if err := n.load(); err != nil {
+			s.app.Log().Warn("failed to reload TLS certificate", zap.String("certificate", c.name), zap.Error(err))
+			metrics.GetOrCreateCounter(fmt.Sprintf("tls_certificate_reloads_total{certificate=%q,result=%q}", c.name, "failed")).Inc()
+
+			// Do not retry until the files change again
+			c.stamps = n.stamps
+			certs = append(certs, c)
+
+			continue
+		}
+
+		n.updateMetric(c.metric)
+
+		s.app.Log().Info("TLS certificate reloaded",
+			zap.String("certificate", n.name),
+			zap.String("subject", n.cert.Leaf.Subject.String()),
+			zap.Time("expires", n.cert.Leaf.NotAfter))
+		metrics.GetOrCreateCounter(fmt.Sprintf("tls_certificate_reloads_total{certificate=%q,result=%q}", c.name, "success")).Inc()
+
+		certs = append(certs, n)
+		changed = true
+	}
+
+	if changed {
+		s.certs.Store(&certs)
+	}
+}
+
+// updateMetric sets the certificate expiry metric replacing the previous metric.
+func (c *serverCertificate) updateMetric(prev string) {
+	leaf := c.cert.Leaf
+
+	c.metric = fmt.Sprintf("tls_certificate_expiry_timestamp_seconds{certificate=%q,subject=%q,serial=%q}",
+		c.name, leaf.Subject.String(), leaf.SerialNumber.Text(16))
+
+	if len(prev) > 0 && prev != c.metric {
+		metrics.UnregisterMetric(prev)
+	}
+
+	metrics.GetOrCreateGauge(c.metric, nil).Set(float64(leaf.NotAfter.Unix()))
+}
+
+// stat returns the current state of the certificate files.
+func (c *serverCertificate) stat() ([]certificateFileStamp, error) {
+	paths := []string{c.files.CertificatePEMFile}
+	if len(c.files.KeyPEMFile) > 0 {
+		paths = append(paths, c.files.KeyPEMFile)
+	}
+
+	stamps := make([]certificateFileStamp, 0, len(paths))
+
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+
+		stamps = append(stamps, certificateFileStamp{size: fi.Size(), modTime: fi.ModTime()})
+	}
+
+	return stamps, nil
+}
+
+func (c *serverCertificate) changed() bool {
+	stamps, err := c.stat()
+	if err != nil {
+		// Files might be in the middle of being replaced
+		return false
+	}
+
+	for i, st := range stamps {
+		if i >= len(c.stamps) || !st.modTime.Equal(c.stamps[i].modTime) || st.size != c.stamps[i].size {
+			return true
+		}
+	}
+
+	return false
+}
+
+// load reads the certificate and the private key from the files.
+func (c *serverCertificate) load() error {
+	stamps, err := c.stat()
+	if err != nil {
+		return err
+	}
+
+	c.stamps = stamps
+
+	certData, keyData, err := cert.LoadPEMFromFile(c.files.CertificatePEMFile)
+	if err != nil {
+		return err
+	}
+
+	if len(c.files.KeyPEMFile) > 0 {
+		if _, keyData, err = cert.LoadPEMFromFile(c.files.KeyPEMFile); err != nil {
+			return err
+		}
+	}
+
+	if len(certData) == 0 {
+		return fmt.Errorf("no certificate found in %s", c.files.CertificatePEMFile)
+	}
+
+	if len(keyData) == 0 {
+		return fmt.Errorf("no private key found for %s", c.files.CertificatePEMFile)
+	}
+
+	crt, err := tls.X509KeyPair(certData, keyData)
+	if err != nil {
+		return fmt.Errorf("invalid certificate %s: %w", c.files.CertificatePEMFile, err)
+	}
+
+	if crt.Leaf == nil {
+		return errors.New("certificate chain is empty")
+	}
+
+	c.cert = &crt
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package azugo
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"azugo.io/azugo/config"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/go-quicktest/qt"
+)
+
+// writeServerCert writes self-signed certificate for the host name with the private key
+// to the single PEM file.
+func writeServerCert(t *testing.T, file, host string) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	qt.Assert(t, qt.IsNil(err))
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{host},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	qt.Assert(t, qt.IsNil(err))
+
+	cert, err := x509.ParseCertificate(der)
+	qt.Assert(t, qt.IsNil(err))
+
+	k, err := x509.MarshalECPrivateKey(key)
+	qt.Assert(t, qt.IsNil(err))
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: k})...)
+
+	qt.Assert(t, qt.IsNil(os.WriteFile(file, data, 0o600)))
+
+	return cert
+}
+
+func serverCertSerial(t *testing.T, s *serverCertificates, host string) string {
+	t.Helper()
+
+	c, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: host})
+	qt.Assert(t, qt.IsNil(err))
+
+	return c.Leaf.SerialNumber.String()
+}
+
+func TestServerCertificatesSNI(t *testing.T) {
+	dir := t.TempDir()
+
+	def := writeServerCert(t, filepath.Join(dir, "default.pem"), "default.local")
+	api := newTestCert(t, nil, "api")
+	apiCert, apiKey := api.writeFiles(t, dir, "api")
+
+	a := NewTestApp()
+
+	s, err := a.loadServerCertificates(&config.ServerTLS{
+		CertificatePEMFile: filepath.Join(dir, "default.pem"),
+		Certificates:       []config.ServerCertificate{{CertificatePEMFile: apiCert, KeyPEMFile: apiKey}},
+	})
+	qt.Assert(t, qt.IsNil(err))
+
+	qt.Check(t, qt.Equals(serverCertSerial(t, s, "upstream.local"), api.cert.SerialNumber.String()))
+	qt.Check(t, qt.Equals(serverCertSerial(t, s, "default.local"), def.SerialNumber.String()))
+	qt.Check(t, qt.Equals(serverCertSerial(t, s, "unknown.local"), def.SerialNumber.String()))
+	qt.Check(t, qt.Equals(serverCertSerial(t, s, ""), def.SerialNumber.String()))
+
+	qt.Check(t, qt.HasLen(s.Certificates(), 2))
+}
+
+func TestServerCertificatesReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "server.pem")
+	old := writeServerCert(t, file, "server.local")
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	s, err := a.loadServerCertificates(&config.ServerTLS{
+		CertificatePEMFile:        file,
+		CertificateReloadInterval: 10 * time.Millisecond,
+	})
+	qt.Assert(t, qt.IsNil(err))
+
+	qt.Check(t, qt.Equals(serverCertSerial(t, s, "server.local"), old.SerialNumber.String()))
+
+	renewed := writeServerCert(t, file, "server.local")
+
+	for deadline := time.Now().Add(5 * time.Second); serverCertSerial(t, s, "server.local") != renewed.SerialNumber.String() && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	qt.Check(t, qt.Equals(serverCertSerial(t, s, "server.local"), renewed.SerialNumber.String()))
+
+	expiry := metrics.GetOrCreateGauge(fmt.Sprintf("tls_certificate_expiry_timestamp_seconds{certificate=%q,subject=%q,serial=%q}",
+		file, renewed.Subject.String(), renewed.SerialNumber.Text(16)), nil)
+	qt.Check(t, qt.Equals(expiry.Get(), float64(renewed.NotAfter.Unix())))
+
+	// Invalid file keeps the current certificate
+	qt.Assert(t, qt.IsNil(os.WriteFile(file, []byte("invalid"), 0o600)))
+	time.Sleep(50 * time.Millisecond)
+
+	qt.Check(t, qt.Equals(serverCertSerial(t, s, "server.local"), renewed.SerialNumber.String()))
+}
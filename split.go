@@ -0,0 +1,279 @@
+package azugo
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+
+	"github.com/VictoriaMetrics/metrics"
+	"go.uber.org/zap"
+)
+
+// SplitOption is a traffic split option.
+type SplitOption interface {
+	apply(opts *splitOptions)
+}
+
+type splitOptions struct {
+	Variants       []Variant
+	Header         string
+	OverrideHeader string
+	OverrideCookie string
+	StickyKey      ProxyHashKey
+	StickyCookie   string
+	CookieOptions  []CookieOption
+}
+
+// Variant is the handler or the proxy upstream group that receives the share of
+// the split traffic proportional to its weight.
+type Variant struct {
+	// Name of the variant used in logs, metrics, response header and overrides.
+	// Defaults to "v" followed by the variant number starting from 1.
+	Name string
+	// Weight is the relative share of the traffic the variant receives.
+	// Variants with zero weight are selected only by overrides.
+	Weight int
+	// Handler handles requests of the variant.
+	Handler RequestHandler
+	// Proxy options to proxy requests of the variant when Handler is not set.
+	Proxy []ProxyOption
+}
+
+func (o Variant) apply(opts *splitOptions) {
+	if len(o.Name) == 0 {
+		o.Name = "v" + strconv.Itoa(len(opts.Variants)+1)
+	}
+
+	o.Weight = max(o.Weight, 0)
+
+	opts.Variants = append(opts.Variants, o)
+}
+
+// SplitHeader sets the response header the selected variant name is returned in.
+// Defaults to "X-Variant". Empty name disables the header.
+type SplitHeader string
+
+func (o SplitHeader) apply(opts *splitOptions) {
+	opts.Header = string(o)
+}
+
+// SplitOverrideHeader allows selecting the variant by its name in the request header.
+type SplitOverrideHeader string
+
+func (o SplitOverrideHeader) apply(opts *splitOptions) {
+	opts.OverrideHeader = string(o)
+}
+
+// SplitOverrideCookie allows selecting the variant by its name in the request cookie.
+type SplitOverrideCookie string
+
+func (o SplitOverrideCookie) apply(opts *splitOptions) {
+	opts.OverrideCookie = string(o)
+}
+
+type splitStickyKey struct {
+	key ProxyHashKey
+}
+
+func (o splitStickyKey) apply(opts *splitOptions) {
+	opts.StickyKey = o.key
+}
+
+// SplitSticky assigns the variant by the hash of the key so that requests with
+// the same key, ex. the same user ID, are handled by the same variant.
+// Requests with an empty key are assigned randomly.
+func SplitSticky(key ProxyHashKey) SplitOption {
+	return splitStickyKey{key}
+}
+
+type splitStickyCookie struct {
+	name string
+	opts []CookieOption
+}
+
+func (o splitStickyCookie) apply(opts *splitOptions) {
+	opts.StickyCookie = o.name
+	opts.CookieOptions = o.opts
+}
+
+// SplitStickyCookie remembers the assigned variant in the cookie so that the client
+// stays on the same variant.
+func SplitStickyCookie(name string, opts ...CookieOption) SplitOption {
+	return splitStickyCookie{name, opts}
+}
+
+// split selects the variant for each request.
+type split struct {
+	path     string
+	options  splitOptions
+	handlers []RequestHandler
+	total    int
+}
+
+// newSplit returns the traffic split for the path. Variant proxies are named and
+// registered with proxy upstreams by the prefixed path and the variant name,
+// ex. "/api#canary".
+func (m *mux) newSplit(prefix, path string, options ...SplitOption) *split {
+	s := &split{
+		path: path,
+		options: splitOptions{
+			Header: "X-Variant",
+		},
+	}
+
+	for _, option := range options {
+		option.apply(&s.options)
+	}
+
+	s.handlers = make([]RequestHandler, len(s.options.Variants))
+
+	for i, v := range s.options.Variants {
+		s.total += v.Weight
+
+		if v.Handler != nil {
+			s.handlers[i] = v.Handler
+
+			continue
+		}
+
+		name := prefix + path + "#" + v.Name
+		p := m.newUpstreamProxy(path, append(slices.Clip(v.Proxy), proxyName(name))...)
+		m.proxies[name] = p
+		s.handlers[i] = Handle(p)
+	}
+
+	return s
+}
+
+// register registers split handler for the path. Subpaths are also handled when
+// any variant proxies requests.
+func (s *split) register(path string, handle func(path string, handler RequestHandler)) {
+	handle(path, Handle(s))
+
+	if !s.proxied() {
+		return
+	}
+
+	if len(path) > 0 && path[len(path)-1] != '/' {
+		path += "/"
+	}
+
+	handle(path+"{path:*}", Handle(s))
+}
+
+// proxied reports whether any variant proxies requests.
+func (s *split) proxied() bool {
+	for _, v := range s.options.Variants {
+		if v.Handler == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// variant returns the index of the variant by its name or -1 if there is no such variant.
+func (s *split) variant(name string) int {
+	if len(name) == 0 {
+		return -1
+	}
+
+	for i, v := range s.options.Variants {
+		if v.Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// weighted returns the index of the variant for the point in [0, total).
+func (s *split) weighted(n int) int {
+	for i, v := range s.options.Variants {
+		if n < v.Weight {
+			return i
+		}
+
+		n -= v.Weight
+	}
+
+	return -1
+}
+
+// selectVariant returns the index of the variant to handle the request and
+// whether the variant has been newly assigned to the client.
+func (s *split) selectVariant(ctx *Context) (int, bool) {
+	o := &s.options
+
+	if len(o.OverrideHeader) > 0 {
+		if i := s.variant(ctx.Header.Get(o.OverrideHeader)); i != -1 {
+			return i, false
+		}
+	}
+
+	if len(o.OverrideCookie) > 0 {
+		if i := s.variant(ctx.Cookie.Get(o.OverrideCookie)); i != -1 {
+			return i, false
+		}
+	}
+
+	if s.total == 0 {
+		return -1, false
+	}
+
+	// Variant previously assigned to the client is kept while it receives traffic
+	if len(o.StickyCookie) > 0 {
+		if i := s.variant(ctx.Cookie.Get(o.StickyCookie)); i != -1 && o.Variants[i].Weight > 0 {
+			return i, false
+		}
+	}
+
+	var i int
+
+	if key := s.stickyKey(ctx); len(key) > 0 {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(s.path))
+		_, _ = h.Write([]byte(key))
+		i = s.weighted(int(h.Sum32() % uint32(s.total))) //nolint:gosec
+	} else {
+		i = s.weighted(rand.IntN(s.total)) //nolint:gosec
+	}
+
+	return i, len(o.StickyCookie) > 0
+}
+
+func (s *split) stickyKey(ctx *Context) string {
+	if s.options.StickyKey == nil {
+		return ""
+	}
+
+	return s.options.StickyKey(ctx)
+}
+
+// Handler handles the request with the selected variant.
+func (s *split) Handler(ctx *Context) {
+	i, assigned := s.selectVariant(ctx)
+	if i == -1 {
+		ctx.NotFound()
+
+		return
+	}
+
+	name := s.options.Variants[i].Name
+
+	_ = ctx.AddLogFields(zap.String("split.variant", name))
+	metrics.GetOrCreateCounter(fmt.Sprintf("split_requests_total{path=%q,variant=%q}", s.path, name)).Inc()
+
+	s.handlers[i](ctx)
+
+	// Set after the handler as proxy replaces response headers
+	if len(s.options.Header) > 0 {
+		ctx.Header.Set(s.options.Header, name)
+	}
+
+	if assigned {
+		ctx.Cookie.Set(s.options.StickyCookie, name, s.options.CookieOptions...)
+	}
+}
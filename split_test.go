@@ -0,0 +1,181 @@
+package azugo
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"azugo.io/core/http"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/go-quicktest/qt"
+	"github.com/valyala/fasthttp"
+)
+
+func variantHandler(name string) RequestHandler {
+	return func(ctx *Context) {
+		ctx.Text(name)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Split("/split", Variant{Weight: 100, Handler: variantHandler("stable")},
+		Variant{Name: "canary", Handler: variantHandler("canary")},
+		SplitOverrideHeader("X-Use-Variant"))
+
+	resp, err := a.TestClient().Get("/split")
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(resp.Body()), "stable"))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("X-Variant")), "v1"))
+	fasthttp.ReleaseResponse(resp)
+
+	resp, err = a.TestClient().Post("/split", nil, a.TestClient().WithHeader("X-Use-Variant", "canary"))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(resp.Body()), "canary"))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("X-Variant")), "canary"))
+	fasthttp.ReleaseResponse(resp)
+
+	qt.Check(t, qt.Equals(metrics.GetOrCreateCounter(fmt.Sprintf("split_requests_total{path=%q,variant=%q}", "/split", "canary")).Get(), 1))
+}
+
+func TestSplitStickyCookie(t *testing.T) {
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Split("/split", Variant{Weight: 50, Handler: variantHandler("v1")}, Variant{Weight: 50, Handler: variantHandler("v2")},
+		SplitStickyCookie("variant"))
+
+	c := a.TestClient()
+
+	resp, err := c.Get("/split")
+	qt.Assert(t, qt.IsNil(err))
+
+	first := string(resp.Body())
+	fasthttp.ReleaseResponse(resp)
+
+	qt.Check(t, qt.Equals(c.Cookies()["variant"], first))
+
+	for range 10 {
+		resp, err := c.Get("/split")
+		qt.Assert(t, qt.IsNil(err))
+		qt.Check(t, qt.Equals(string(resp.Body()), first))
+		fasthttp.ReleaseResponse(resp)
+	}
+}
+
+func TestSplitStickyKey(t *testing.T) {
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Split("/split", Variant{Weight: 50, Handler: variantHandler("v1")}, Variant{Weight: 50, Handler: variantHandler("v2")},
+		SplitSticky(ProxyHashKeyHeader("X-User")))
+
+	seen := make(map[string]bool)
+
+	for i := range 20 {
+		user := "user" + strconv.Itoa(i)
+
+		var variant string
+
+		for range 3 {
+			resp, err := a.TestClient().Get("/split", a.TestClient().WithHeader("X-User", user))
+			qt.Assert(t, qt.IsNil(err))
+
+			if len(variant) == 0 {
+				variant = string(resp.Body())
+			}
+
+			qt.Check(t, qt.Equals(string(resp.Body()), variant))
+			fasthttp.ReleaseResponse(resp)
+		}
+
+		seen[variant] = true
+	}
+
+	qt.Check(t, qt.HasLen(seen, 2))
+}
+
+func TestSplitProxy(t *testing.T) {
+	u1 := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString("v1 " + string(ctx.Path()))
+	})
+	u2 := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString("v2 " + string(ctx.Path()))
+	})
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Split("/api",
+		Variant{Name: "stable", Weight: 1, Proxy: []ProxyOption{ProxyUpstream(u1)}},
+		Variant{Name: "next", Proxy: []ProxyOption{ProxyUpstream(u2)}},
+		SplitOverrideCookie("variant"))
+
+	resp, err := a.TestClient().Get("/api/users")
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+	qt.Check(t, qt.Equals(string(resp.Body()), "v1 /users"))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("X-Variant")), "stable"))
+	fasthttp.ReleaseResponse(resp)
+
+	resp, err = a.TestClient().Get("/api/users", a.TestClient().WithCookie("variant", "next"))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(resp.Body()), "v2 /users"))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("X-Variant")), "next"))
+	fasthttp.ReleaseResponse(resp)
+}
+
+func TestSplitProxyUpstreams(t *testing.T) {
+	u := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString("ok")
+	})
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Split("/variants",
+		Variant{Name: "stable", Weight: 1, Proxy: []ProxyOption{ProxyUpstream(u)}},
+		Variant{Name: "next", Proxy: []ProxyOption{ProxyUpstream(u)}},
+		SplitOverrideHeader("X-Variant"))
+
+	// Variant proxies are listed separately
+	upstreams := a.ProxyUpstreams()
+	qt.Check(t, qt.HasLen(upstreams["/variants#stable"], 1))
+	qt.Check(t, qt.HasLen(upstreams["/variants#next"], 1))
+
+	resp, err := a.TestClient().Get("/variants/users", a.TestClient().WithHeader("X-Variant", "next"))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("X-Variant")), "next"))
+	fasthttp.ReleaseResponse(resp)
+
+	// Metrics of the same upstream are recorded per variant
+	requests := func(variant string) uint64 {
+		return metrics.GetOrCreateCounter(fmt.Sprintf("proxy_upstream_requests_total{proxy=%q,upstream=%q}", "/variants#"+variant, u.String())).Get()
+	}
+
+	qt.Check(t, qt.Equals(requests("next"), 1))
+	qt.Check(t, qt.Equals(requests("stable"), 0))
+}
+
+func TestSplitGroup(t *testing.T) {
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	g, ok := a.Group("/group").(Splitter)
+	qt.Assert(t, qt.IsTrue(ok))
+
+	g.Split("/split", Variant{Weight: 100, Handler: variantHandler("stable")})
+
+	resp, err := a.TestClient().Get("/group/split")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(resp.Body()), "stable"))
+}
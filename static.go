@@ -2,18 +2,21 @@ package azugo
 
 import (
 	"bytes"
+	"context"
 	"embed"
 	"fmt"
 	"io"
 	"io/fs"
 	"mime"
 	"net/url"
+	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"azugo.io/core/http"
-	"github.com/valyala/fasthttp"
 )
 
 type staticHandler struct {
@@ -26,11 +29,34 @@ type staticHandler struct {
 	// NotFoundPath is the path to use for unknown paths, ex. for SPA routing.
 	NotFoundPath string
 
-	fs         *embed.FS
-	gzip       bool
+	app        *App
+	fs         fs.FS
+	dynamic    bool
+	devProxy   *url.URL
+	encodings  []*staticEncoding
+	cacheRules []*staticCacheRule
 	mu         sync.RWMutex
-	altcontent map[string][]byte
-	extcache   map[string]string
+	altcontent map[string]*staticContent
+	// compressing holds cache keys of content being compressed in the background.
+	compressing sync.Map
+}
+
+// staticFile holds metadata of the file served by the static handler.
+type staticFile struct {
+	// Route path of the file.
+	path string
+	// File path in the FS.
+	file         string
+	contentType  string
+	etag         string
+	modTime      time.Time
+	cacheControl string
+}
+
+// staticContent is cached alternative content of the file.
+type staticContent struct {
+	data []byte
+	etag string
 }
 
 // StaticOption is an interface for static file serving options.
@@ -61,18 +87,7 @@ func (p StaticSPARouterPath) apply(h *staticHandler) {
 	h.NotFoundPath = string(p)
 }
 
-// StaticGzipContent enables pre-compressed gzip content that is served directly when the client accepts gzip encoding.
-func StaticGzipContent() StaticOption {
-	return staticGzipContent(true)
-}
-
-type staticGzipContent bool
-
-func (g staticGzipContent) apply(h *staticHandler) {
-	h.gzip = bool(g)
-}
-
-func (h *staticHandler) getContent(key string) ([]byte, bool) {
+func (h *staticHandler) getContent(key string) (*staticContent, bool) {
 	h.mu.RLock()
 	v, ok := h.altcontent[key]
 	h.mu.RUnlock()
@@ -80,173 +95,447 @@ func (h *staticHandler) getContent(key string) ([]byte, bool) {
 	return v, ok
 }
 
-func (h *staticHandler) setContent(key string, value []byte) {
+func (h *staticHandler) setContent(key string, value *staticContent) {
 	h.mu.Lock()
 	h.altcontent[key] = value
 	h.mu.Unlock()
 }
 
-func (h *staticHandler) replaceContent(file string, replacer *strings.Replacer) ([]byte, bool, error) {
+func (h *staticHandler) readFile(file string) ([]byte, error) {
 	s, err := h.fs.Open(file)
 	if err != nil {
-		return nil, false, err
+		return nil, err
 	}
 	defer s.Close() //nolint:errcheck
 
 	buf := new(bytes.Buffer)
 	if _, err := io.Copy(buf, s); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (h *staticHandler) replaceContent(file string, replacer *strings.Replacer) ([]byte, bool, error) {
+	buf, err := h.readFile(file)
+	if err != nil {
 		return nil, false, err
 	}
 
-	content := []byte(replacer.Replace(buf.String()))
-	if !bytes.Equal(content, buf.Bytes()) {
+	content := []byte(replacer.Replace(string(buf)))
+	if !bytes.Equal(content, buf) {
 		return content, true, nil
 	}
 
 	return content, false, nil
 }
 
-func (h *staticHandler) requestHandler(fpath, path string) RequestHandler {
+// newFile returns metadata for the file with the entity tag computed from the file content.
+func (h *staticHandler) newFile(fpath, name, file string) (*staticFile, error) {
+	st, err := fs.Stat(h.fs, file)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := h.readFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return &staticFile{
+		path:         fpath,
+		file:         file,
+		contentType:  mime.TypeByExtension(filepath.Ext(fpath)),
+		etag:         staticETag(content),
+		modTime:      st.ModTime(),
+		cacheControl: h.cacheControl(name),
+	}, nil
+}
+
+// statFile returns metadata for the file with the entity tag derived from the file size and modification time.
+func (h *staticHandler) statFile(fpath, name, file string) (*staticFile, bool) {
+	st, err := fs.Stat(h.fs, file)
+	if err != nil || !st.Mode().IsRegular() {
+		return nil, false
+	}
+
+	return &staticFile{
+		path:         fpath,
+		file:         file,
+		contentType:  mime.TypeByExtension(filepath.Ext(fpath)),
+		etag:         staticWeakETag(st.Size(), st.ModTime()),
+		modTime:      st.ModTime(),
+		cacheControl: h.cacheControl(name),
+	}, true
+}
+
+// resolve returns the file for the requested path or false if the path
+// is not valid or does not point to a regular file.
+func (h *staticHandler) resolve(base, name string) (*staticFile, bool) {
+	name = strings.TrimPrefix(name, "/")
+	if len(name) == 0 || !fs.ValidPath(name) {
+		return nil, false
+	}
+
+	file := name
+	if len(h.TrimPrefix) > 0 {
+		file = path.Join(h.TrimPrefix, name)
+	}
+
+	return h.statFile(base+name, name, file)
+}
+
+func (h *staticHandler) requestHandler(f *staticFile) RequestHandler {
+	return func(ctx *Context) {
+		h.serve(ctx, f)
+	}
+}
+
+// dynamicHandler resolves requested files at request time so that files
+// added or removed after startup are picked up.
+func (h *staticHandler) dynamicHandler(base, notFoundPath, notFoundFile string) RequestHandler {
 	return func(ctx *Context) {
-		ctx.Header.Set(http.HeaderContentType, h.extcache[fpath])
+		if f, ok := h.resolve(base, ctx.Params.String("path")); ok {
+			h.serve(ctx, f)
 
-		useGzip := h.gzip && ctx.Header.AcceptsEncoding("gzip")
-		if h.gzip {
-			ctx.Header.Set(http.HeaderVary, http.HeaderAcceptEncoding)
+			return
 		}
 
-		// Modify content on the fly and replace values in content
-		if h.ReplacerFunc != nil {
-			hash, replacer := h.ReplacerFunc(ctx)
-			if replacer != nil {
-				if len(hash) > 0 {
-					prefix := ""
-					if useGzip {
-						prefix = "gz:"
-					}
-					// Check non-hash-specific cache (content didn't change)
-					if content, ok := h.getContent(prefix + fpath); ok {
-						if useGzip {
-							ctx.Header.Set(http.HeaderContentEncoding, "gzip")
-						}
+		if len(notFoundFile) > 0 {
+			if f, ok := h.statFile(notFoundPath, strings.TrimPrefix(notFoundPath, "/"), notFoundFile); ok {
+				h.serve(ctx, f)
 
-						ctx.Raw(content)
+				return
+			}
+		}
 
-						return
-					}
-					// Check hash-specific cache
-					if content, ok := h.getContent(prefix + hash + fpath); ok {
-						if useGzip {
-							ctx.Header.Set(http.HeaderContentEncoding, "gzip")
-						}
+		ctx.NotFound()
+	}
+}
 
-						ctx.Raw(content)
+func (h *staticHandler) serve(ctx *Context, f *staticFile) {
+	ctx.Header.Set(http.HeaderContentType, f.contentType)
 
-						return
-					}
-				}
+	if len(f.cacheControl) > 0 {
+		ctx.Header.Set(http.HeaderCacheControl, f.cacheControl)
+	}
 
-				content, changed, err := h.replaceContent(path, replacer)
-				if err != nil {
-					ctx.Error(err)
+	if len(h.encodings) > 0 {
+		ctx.Header.Set(http.HeaderVary, http.HeaderAcceptEncoding)
+	}
 
-					return
-				}
+	encodings := h.acceptedEncodings(ctx)
 
-				if len(hash) > 0 {
-					cacheKey := fpath
-					if changed {
-						cacheKey = hash + fpath
-					}
+	// Modify content on the fly and replace values in content
+	if h.ReplacerFunc != nil {
+		if hash, replacer := h.ReplacerFunc(ctx); replacer != nil {
+			h.serveReplaced(ctx, f, hash, replacer, encodings)
 
-					h.setContent(cacheKey, content)
+			return
+		}
+	}
 
-					if h.gzip {
-						h.setContent("gz:"+cacheKey, fasthttp.AppendGzipBytesLevel(nil, content, fasthttp.CompressBestCompression))
-					}
+	// Serve compressed content if available and client accepts the encoding
+	for _, enc := range encodings {
+		if content, ok := h.getContent(enc.name + ":*" + f.path); ok {
+			h.write(ctx, content, enc.name, f.modTime)
 
-					if useGzip {
-						if gz, ok := h.getContent("gz:" + cacheKey); ok {
-							ctx.Header.Set(http.HeaderContentEncoding, "gzip")
-							ctx.Raw(gz)
+			return
+		}
+	}
 
-							return
-						}
-					}
-				}
+	// Files on disk are not compressed in advance
+	if h.dynamic && len(encodings) > 0 {
+		h.serveEncoded(ctx, f, encodings)
 
-				ctx.Raw(content)
+		return
+	}
 
-				return
-			}
-		}
+	if notModified(ctx, f.etag, f.modTime) {
+		return
+	}
 
-		// Serve pre-compressed content if available and client accepts gzip
-		if useGzip {
-			if content, ok := h.getContent("gz:*" + fpath); ok {
-				ctx.Header.Set(http.HeaderContentEncoding, "gzip")
-				ctx.Raw(content)
+	s, err := h.fs.Open(f.file)
+	if err != nil {
+		ctx.Error(err)
 
-				return
-			}
+		return
+	}
+
+	ctx.Stream(s)
+}
+
+// serveEncoded serves pre-compressed file if available or compresses content on the fly
+// using the encoding most preferred by the client.
+func (h *staticHandler) serveEncoded(ctx *Context, f *staticFile, encodings []*staticEncoding) {
+	enc := encodings[0]
+
+	if sf, ok := h.statFile(f.path, "", f.file+enc.ext); ok {
+		if notModified(ctx, staticEncodingETag(sf.etag, enc.name), sf.modTime) {
+			return
 		}
 
-		s, err := h.fs.Open(path)
+		s, err := h.fs.Open(sf.file)
 		if err != nil {
 			ctx.Error(err)
 
 			return
 		}
 
+		ctx.Header.Set(http.HeaderContentEncoding, enc.name)
 		ctx.Stream(s)
+
+		return
+	}
+
+	etag := staticEncodingETag(f.etag, enc.name)
+	if notModified(ctx, etag, f.modTime) {
+		return
 	}
+
+	content, err := h.readFile(f.file)
+	if err != nil {
+		ctx.Error(err)
+
+		return
+	}
+
+	h.write(ctx, &staticContent{data: enc.fast(content), etag: etag}, enc.name, f.modTime)
 }
 
-// StaticEmbedded serves files from an embedded filesystem at the given path.
-func (a *App) StaticEmbedded(path string, f *embed.FS, opts ...StaticOption) error {
-	h := &staticHandler{
-		fs:         f,
-		altcontent: make(map[string][]byte, 10),
-		extcache:   make(map[string]string, 10),
+func (h *staticHandler) serveReplaced(ctx *Context, f *staticFile, hash string, replacer *strings.Replacer, encodings []*staticEncoding) {
+	// Files on disk can change at any time so content is never cached
+	if h.dynamic {
+		hash = ""
 	}
-	for _, o := range opts {
-		o.apply(h)
+
+	var enc *staticEncoding
+
+	prefix, encoding := "", ""
+	if len(encodings) > 0 {
+		enc = encodings[0]
+		prefix, encoding = enc.name+":", enc.name
 	}
 
-	base := path
-	if !strings.HasPrefix(base, "/") {
-		base = "/" + base
+	if len(hash) > 0 {
+		// Check non-hash-specific cache (content didn't change)
+		if content, ok := h.getContent(prefix + f.path); ok {
+			h.write(ctx, content, encoding, time.Time{})
+
+			return
+		}
+		// Check hash-specific cache
+		if content, ok := h.getContent(prefix + hash + f.path); ok {
+			h.write(ctx, content, encoding, time.Time{})
+
+			return
+		}
 	}
 
-	if !strings.HasSuffix(base, "/") {
-		base += "/"
+	data, changed, err := h.replaceContent(f.file, replacer)
+	if err != nil {
+		ctx.Error(err)
+
+		return
+	}
+
+	content := &staticContent{data: data, etag: f.etag}
+	if changed {
+		content.etag = staticETag(data)
+	}
+
+	if len(hash) > 0 {
+		cacheKey := f.path
+		if changed {
+			cacheKey = hash + f.path
+		}
+
+		h.setContent(cacheKey, content)
+
+		// Cache content in all enabled encodings in the background
+		if len(h.encodings) > 0 {
+			if _, running := h.compressing.LoadOrStore(cacheKey, struct{}{}); !running {
+				h.app.runTaskOnce(func(context.Context) {
+					defer h.compressing.Delete(cacheKey)
+
+					for _, e := range h.encodings {
+						h.setContent(e.name+":"+cacheKey, &staticContent{
+							data: e.best(data),
+							etag: staticEncodingETag(content.etag, e.name),
+						})
+					}
+				})
+			}
+		}
+	}
+
+	// Compress content with the negotiated encoding until the cached content is available
+	if enc != nil {
+		h.write(ctx, &staticContent{
+			data: enc.fast(data),
+			etag: staticEncodingETag(content.etag, enc.name),
+		}, encoding, time.Time{})
+
+		return
+	}
+
+	h.write(ctx, content, "", time.Time{})
+}
+
+// write writes the content to the response unless the client already has the current version.
+func (h *staticHandler) write(ctx *Context, content *staticContent, encoding string, modTime time.Time) {
+	if notModified(ctx, content.etag, modTime) {
+		return
+	}
+
+	if len(encoding) > 0 {
+		ctx.Header.Set(http.HeaderContentEncoding, encoding)
+	}
+
+	ctx.Raw(content.data)
+}
+
+// compressJob describes content to compress and cache in the background.
+type compressJob struct {
+	file     *staticFile
+	encoding *staticEncoding
+	// source is the pre-compressed file in the FS, empty if the content has to be compressed.
+	source string
+}
+
+// compressJobs returns jobs for all enabled encodings of the file.
+func (h *staticHandler) compressJobs(jobs map[string]*compressJob, sf *staticFile) map[string]*compressJob {
+	if len(h.encodings) == 0 {
+		return jobs
+	}
+
+	// Skip files that are already compressed
+	for _, enc := range staticEncodings {
+		if strings.HasSuffix(sf.file, enc.ext) {
+			return jobs
+		}
+	}
+
+	if jobs == nil {
+		jobs = make(map[string]*compressJob)
 	}
 
-	var gzipJobs map[string]string
+	for _, enc := range h.encodings {
+		job := &compressJob{file: sf, encoding: enc}
+
+		// Use pre-compressed file if it exists in the FS
+		if st, err := fs.Stat(h.fs, sf.file+enc.ext); err == nil && st.Mode().IsRegular() {
+			job.source = sf.file + enc.ext
+		}
+
+		jobs[enc.name+":*"+sf.path] = job
+	}
+
+	return jobs
+}
+
+// isPrecompressed reports whether the file is a pre-compressed version of
+// another file in the FS in one of the enabled encodings.
+func (h *staticHandler) isPrecompressed(file string) bool {
+	for _, enc := range h.encodings {
+		base, ok := strings.CutSuffix(file, enc.ext)
+		if !ok || len(base) == 0 {
+			continue
+		}
+
+		if st, err := fs.Stat(h.fs, base); err == nil && st.Mode().IsRegular() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// runCompressJobs compresses and caches content until all jobs are done or the context is done.
+func (h *staticHandler) runCompressJobs(ctx context.Context, jobs map[string]*compressJob) {
+	for key, job := range jobs {
+		if ctx.Err() != nil {
+			return
+		}
+
+		var data []byte
+
+		if len(job.source) > 0 {
+			content, err := h.readFile(job.source)
+			if err != nil {
+				continue
+			}
+
+			data = content
+		} else {
+			content, err := h.readFile(job.file.file)
+			if err != nil {
+				continue
+			}
+
+			data = job.encoding.best(content)
+		}
+
+		h.setContent(key, &staticContent{
+			data: data,
+			etag: staticEncodingETag(job.file.etag, job.encoding.name),
+		})
+	}
+}
+
+// StaticEmbedded serves files from an embedded filesystem at the given path.
+func (a *App) StaticEmbedded(path string, f *embed.FS, opts ...StaticOption) error {
+	return a.StaticFS(path, f, opts...)
+}
+
+// StaticFS serves files from the filesystem at the given path.
+//
+// Files are discovered when the handler is registered, files added to the
+// filesystem later will not be served. Use StaticDir to serve files from
+// a directory on disk that can change at runtime.
+//
+// Entity tags are computed from the file content when the handler is registered.
+func (a *App) StaticFS(path string, f fs.FS, opts ...StaticOption) error {
+	h, err := newStaticHandler(f, opts...)
+	if err != nil {
+		return err
+	}
+
+	h.app = a
+
+	base := staticBasePath(path)
+
+	if h.devProxy != nil && a.Env().IsDevelopment() {
+		a.staticDevProxy(base, h)
+
+		return nil
+	}
+
+	var jobs map[string]*compressJob
 
 	if err := fs.WalkDir(f, ".", func(file string, d fs.DirEntry, err error) error {
 		if err != nil || d.IsDir() {
 			return err
 		}
 
-		fpath := base
-		if len(h.TrimPrefix) > 0 {
-			fpath += strings.TrimPrefix(file, h.TrimPrefix)
-		} else {
-			fpath += file
+		// Pre-compressed files are served in place of the original file
+		if h.isPrecompressed(file) {
+			return nil
 		}
 
-		h.extcache[fpath] = mime.TypeByExtension(filepath.Ext(fpath))
-
-		if h.gzip {
-			if gzipJobs == nil {
-				gzipJobs = make(map[string]string)
-			}
+		name := file
+		if len(h.TrimPrefix) > 0 {
+			name = strings.TrimPrefix(file, h.TrimPrefix)
+		}
 
-			gzipJobs["gz:*"+fpath] = file
+		sf, err := h.newFile(base+name, name, file)
+		if err != nil {
+			return err
 		}
 
-		a.Get(fpath, h.requestHandler(fpath, file))
+		jobs = h.compressJobs(jobs, sf)
+
+		a.Get(sf.path, h.requestHandler(sf))
 
 		return nil
 	}); err != nil {
@@ -254,54 +543,192 @@ func (a *App) StaticEmbedded(path string, f *embed.FS, opts ...StaticOption) err
 	}
 
 	if len(h.NotFoundPath) > 0 {
-		fpath := h.NotFoundPath
-		if !strings.HasPrefix(fpath, "/") {
-			fpath = "/" + fpath
+		fpath, file, err := h.notFoundFile()
+		if err != nil {
+			return err
 		}
 
-		file, err := url.JoinPath(h.TrimPrefix, strings.TrimPrefix(h.NotFoundPath, "/"))
+		sf, err := h.newFile(fpath, strings.TrimPrefix(fpath, "/"), file)
 		if err != nil {
 			return err
 		}
 
-		// Validate that the file exists.
-		ff, err := h.fs.Open(file)
+		jobs = h.compressJobs(jobs, sf)
+
+		a.Get(base+"{path:*}", h.requestHandler(sf))
+	}
+
+	if len(jobs) > 0 {
+		a.runTaskOnce(func(ctx context.Context) {
+			h.runCompressJobs(ctx, jobs)
+		})
+	}
+
+	return nil
+}
+
+// StaticDir serves files from the directory on disk at the given path.
+//
+// Files are resolved on every request so files added or changed after
+// startup are served without restarting the application. Requested paths
+// can not escape the directory, neither by path traversal nor by following
+// symbolic links. As content can change at any time replaced and compressed
+// content is never cached and entity tags are derived from the file size
+// and modification time. Pre-compressed files next to the original file are
+// served if available, otherwise content is compressed on the fly.
+func (a *App) StaticDir(path, dir string, opts ...StaticOption) error {
+	h, err := newStaticHandler(nil, opts...)
+	if err != nil {
+		return err
+	}
+
+	h.app = a
+
+	base := staticBasePath(path)
+
+	if h.devProxy != nil && a.Env().IsDevelopment() {
+		a.staticDevProxy(base, h)
+
+		return nil
+	}
+
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return fmt.Errorf("static directory: %w", err)
+	}
+
+	r := &staticRoot{dir: dir, root: root}
+
+	h.fs = r
+	h.dynamic = true
+
+	var notFoundPath, notFoundFile string
+
+	if len(h.NotFoundPath) > 0 {
+		notFoundPath, notFoundFile, err = h.notFoundFile()
 		if err != nil {
-			return fmt.Errorf("static SPA route handler file not found: %w", err)
+			r.Close()
+
+			return err
 		}
+	}
 
-		_ = ff.Close()
+	// Directory is closed when the application is stopped
+	a.runTask(func(ctx context.Context) {
+		<-ctx.Done()
+		r.Close()
+	})
 
-		h.extcache[fpath] = mime.TypeByExtension(filepath.Ext(fpath))
+	a.Get(base+"{path:*}", h.dynamicHandler(base, notFoundPath, notFoundFile))
 
-		if h.gzip {
-			if gzipJobs == nil {
-				gzipJobs = make(map[string]string)
-			}
+	return nil
+}
 
-			gzipJobs["gz:*"+fpath] = file
+// staticRoot is the filesystem of the directory on disk that is closed when
+// the application is stopped and opened again on the next access.
+type staticRoot struct {
+	dir  string
+	lock sync.Mutex
+	root *os.Root
+}
+
+func (r *staticRoot) fs() (fs.FS, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.root == nil {
+		root, err := os.OpenRoot(r.dir)
+		if err != nil {
+			return nil, err
 		}
 
-		a.Get(base+"{path:*}", h.requestHandler(fpath, file))
+		r.root = root
 	}
 
-	if len(gzipJobs) > 0 {
-		go func() {
-			for key, path := range gzipJobs {
-				fh, err := f.Open(path)
-				if err != nil {
-					continue
-				}
+	return r.root.FS(), nil
+}
 
-				var buf bytes.Buffer
+// Open implements fs.FS.
+func (r *staticRoot) Open(name string) (fs.File, error) {
+	fsys, err := r.fs()
+	if err != nil {
+		return nil, err
+	}
 
-				_, _ = io.Copy(&buf, fh)
-				_ = fh.Close()
+	return fsys.Open(name)
+}
 
-				h.setContent(key, fasthttp.AppendGzipBytesLevel(nil, buf.Bytes(), fasthttp.CompressBestCompression))
-			}
-		}()
+// Stat implements fs.StatFS.
+func (r *staticRoot) Stat(name string) (fs.FileInfo, error) {
+	fsys, err := r.fs()
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return fs.Stat(fsys, name)
+}
+
+// Close closes the directory.
+func (r *staticRoot) Close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.root != nil {
+		_ = r.root.Close()
+		r.root = nil
+	}
+}
+
+func newStaticHandler(f fs.FS, opts ...StaticOption) (*staticHandler, error) {
+	h := &staticHandler{
+		fs:         f,
+		altcontent: make(map[string]*staticContent, 10),
+	}
+	for _, o := range opts {
+		o.apply(h)
+	}
+
+	for _, r := range h.cacheRules {
+		if err := r.compile(); err != nil {
+			return nil, err
+		}
+	}
+
+	return h, nil
+}
+
+func staticBasePath(path string) string {
+	base := path
+	if !strings.HasPrefix(base, "/") {
+		base = "/" + base
+	}
+
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+
+	return base
+}
+
+// notFoundFile returns the route path and the file path in the FS for the SPA router path.
+func (h *staticHandler) notFoundFile() (string, string, error) {
+	fpath := h.NotFoundPath
+	if !strings.HasPrefix(fpath, "/") {
+		fpath = "/" + fpath
+	}
+
+	file, err := url.JoinPath(h.TrimPrefix, strings.TrimPrefix(h.NotFoundPath, "/"))
+	if err != nil {
+		return "", "", err
+	}
+
+	// Validate that the file exists.
+	ff, err := h.fs.Open(file)
+	if err != nil {
+		return "", "", fmt.Errorf("static SPA route handler file not found: %w", err)
+	}
+
+	_ = ff.Close()
+
+	return fpath, file, nil
 }
@@ -0,0 +1,144 @@
+package azugo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"azugo.io/core/http"
+	"github.com/valyala/fasthttp"
+)
+
+// Common Cache-Control header values for static content.
+const (
+	// StaticCacheImmutable caches content for a year without revalidation.
+	// Use only for files with content hash in the file name.
+	StaticCacheImmutable = "public, max-age=31536000, immutable"
+	// StaticCacheNoCache requires the client to revalidate content on every request.
+	StaticCacheNoCache = "no-cache"
+)
+
+type staticCacheRule struct {
+	pattern string
+	value   string
+	re      *regexp.Regexp
+}
+
+func (r *staticCacheRule) apply(h *staticHandler) {
+	h.cacheRules = append(h.cacheRules, r)
+}
+
+func (r *staticCacheRule) compile() error {
+	if r.re != nil {
+		return nil
+	}
+
+	re, err := regexp.Compile(r.pattern)
+	if err != nil {
+		return fmt.Errorf("invalid static cache control pattern %q: %w", r.pattern, err)
+	}
+
+	r.re = re
+
+	return nil
+}
+
+// StaticCacheControl sets the Cache-Control header value for files with path
+// matching the regular expression pattern. Path is matched without the leading
+// slash and relative to the path static content is served at.
+//
+// Rules are evaluated in the order they were added and the first matching rule wins.
+//
+//	app.StaticEmbedded("/", &dist,
+//	    azugo.StaticCacheControl(`^assets/.+\.[0-9a-f]{8,}\.(js|css)$`, azugo.StaticCacheImmutable),
+//	    azugo.StaticCacheControl(`^index\.html$`, azugo.StaticCacheNoCache),
+//	)
+func StaticCacheControl(pattern, value string) StaticOption {
+	return &staticCacheRule{
+		pattern: pattern,
+		value:   value,
+	}
+}
+
+// cacheControl returns the Cache-Control header value for the file.
+func (h *staticHandler) cacheControl(name string) string {
+	for _, r := range h.cacheRules {
+		if r.re.MatchString(name) {
+			return r.value
+		}
+	}
+
+	return ""
+}
+
+// staticETag returns strong entity tag computed from the content.
+func staticETag(content []byte) string {
+	sum := sha256.Sum256(content)
+
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// staticWeakETag returns weak entity tag derived from the file size and modification time.
+func staticWeakETag(size int64, modTime time.Time) string {
+	return `W/"` + strconv.FormatInt(size, 16) + "-" + strconv.FormatInt(modTime.UnixNano(), 16) + `"`
+}
+
+// staticEncodingETag returns entity tag for the content encoded with the given encoding
+// as each representation of the resource must have a different entity tag.
+func staticEncodingETag(etag, encoding string) string {
+	if len(etag) == 0 {
+		return ""
+	}
+
+	return etag[:len(etag)-1] + "-" + encoding + `"`
+}
+
+// staticETagMatch reports whether If-None-Match header value matches the entity tag
+// using weak comparison.
+func staticETagMatch(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+
+	for v := range strings.SplitSeq(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notModified sets validator headers to the response and reports whether the client
+// already has the current version of the content, in which case 304 Not Modified
+// status is returned to the client.
+func notModified(ctx *Context, etag string, modTime time.Time) bool {
+	if len(etag) > 0 {
+		ctx.Header.Set(http.HeaderETag, etag)
+	}
+
+	if !modTime.IsZero() {
+		ctx.Response().Header.SetLastModified(modTime)
+	}
+
+	if inm := ctx.Header.Get(http.HeaderIfNoneMatch); len(inm) > 0 {
+		if len(etag) == 0 || !staticETagMatch(inm, etag) {
+			return false
+		}
+	} else if ims := ctx.Header.Get(http.HeaderIfModifiedSince); len(ims) > 0 && !modTime.IsZero() {
+		t, err := fasthttp.ParseHTTPDate([]byte(ims))
+		if err != nil || modTime.Truncate(time.Second).After(t) {
+			return false
+		}
+	} else {
+		return false
+	}
+
+	ctx.StatusCode(http.StatusNotModified)
+	ctx.Response().ResetBody()
+
+	return true
+}
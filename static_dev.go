@@ -0,0 +1,64 @@
+package azugo
+
+import (
+	"net/url"
+	"strings"
+
+	"azugo.io/core/http"
+)
+
+type staticDevProxy struct {
+	url *url.URL
+}
+
+func (o *staticDevProxy) apply(h *staticHandler) {
+	h.devProxy = o.url
+}
+
+// StaticDevProxy proxies static content requests to the frontend development
+// server, ex. Vite or webpack dev server, instead of serving files when the
+// application runs in the development environment.
+//
+// Request path relative to the path static content is served at is appended
+// to the development server URL. WebSocket upgrade requests, used for hot
+// module replacement, are tunneled to the development server. Unknown paths
+// are served from the StaticSPARouterPath the same way as for static files.
+//
+//	app.StaticEmbedded("/", &dist,
+//	    azugo.StaticDirTrimPrefix("dist"),
+//	    azugo.StaticSPARouterPath("index.html"),
+//	    azugo.StaticDevProxy(devURL),
+//	)
+func StaticDevProxy(u *url.URL) StaticOption {
+	return &staticDevProxy{
+		url: u,
+	}
+}
+
+// staticDevProxy registers handler that proxies static content requests to the frontend development server.
+func (a *App) staticDevProxy(base string, h *staticHandler) {
+	p := a.defaultMux.newUpstreamProxy(base, ProxyUpstream(h.devProxy))
+	a.defaultMux.proxies[base] = p
+
+	a.Get(base+"{path:*}", h.devProxyHandler(p))
+}
+
+// devProxyHandler proxies requests to the frontend development server falling back
+// to the SPA router path if the development server does not have the requested content.
+func (h *staticHandler) devProxyHandler(p *Proxy) RequestHandler {
+	var notFoundPath string
+	if len(h.NotFoundPath) > 0 {
+		notFoundPath = "/" + strings.TrimPrefix(h.NotFoundPath, "/")
+	}
+
+	return func(ctx *Context) {
+		p.Handler(ctx)
+
+		if len(notFoundPath) == 0 || ctx.Context().Hijacked() || ctx.Response().StatusCode() != http.StatusNotFound {
+			return
+		}
+
+		ctx.Response().Reset()
+		p.handle(ctx, notFoundPath)
+	}
+}
@@ -0,0 +1,178 @@
+package azugo
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"azugo.io/core/http"
+	"github.com/valyala/fasthttp"
+)
+
+// staticEncoding is a content coding supported by the static handler.
+type staticEncoding struct {
+	// name is the content coding name used in Accept-Encoding and Content-Encoding headers.
+	name string
+	// ext is the file extension of pre-compressed files.
+	ext string
+	// best compresses content with the best compression level, used for cached content.
+	best func(src []byte) []byte
+	// fast compresses content with the default compression level, used for content compressed on the fly.
+	fast func(src []byte) []byte
+}
+
+// staticEncodings lists supported content codings in the server preference order.
+var staticEncodings = []*staticEncoding{
+	{
+		name: "br",
+		ext:  ".br",
+		best: func(src []byte) []byte {
+			return fasthttp.AppendBrotliBytesLevel(nil, src, fasthttp.CompressBrotliBestCompression)
+		},
+		fast: func(src []byte) []byte {
+			return fasthttp.AppendBrotliBytes(nil, src)
+		},
+	},
+	{
+		name: "zstd",
+		ext:  ".zst",
+		best: func(src []byte) []byte {
+			return fasthttp.AppendZstdBytesLevel(nil, src, fasthttp.CompressZstdBestCompression)
+		},
+		fast: func(src []byte) []byte {
+			return fasthttp.AppendZstdBytes(nil, src)
+		},
+	},
+	{
+		name: "gzip",
+		ext:  ".gz",
+		best: func(src []byte) []byte {
+			return fasthttp.AppendGzipBytesLevel(nil, src, fasthttp.CompressBestCompression)
+		},
+		fast: func(src []byte) []byte {
+			return fasthttp.AppendGzipBytes(nil, src)
+		},
+	},
+}
+
+type staticEncodingOption string
+
+func (o staticEncodingOption) apply(h *staticHandler) {
+	for _, e := range h.encodings {
+		if e.name == string(o) {
+			return
+		}
+	}
+
+	for _, e := range staticEncodings {
+		if e.name == string(o) {
+			h.encodings = append(h.encodings, e)
+		}
+	}
+
+	// Keep enabled encodings in the server preference order
+	slices.SortStableFunc(h.encodings, func(a, b *staticEncoding) int {
+		return cmp.Compare(slices.Index(staticEncodings, a), slices.Index(staticEncodings, b))
+	})
+}
+
+// StaticGzipContent enables gzip compressed content that is served directly when the client accepts gzip encoding.
+//
+// Pre-compressed files with .gz extension next to the original file are used if available,
+// otherwise content is compressed and cached when the handler is registered.
+func StaticGzipContent() StaticOption {
+	return staticEncodingOption("gzip")
+}
+
+// StaticBrotliContent enables brotli compressed content that is served directly when the client accepts br encoding.
+//
+// Pre-compressed files with .br extension next to the original file are used if available,
+// otherwise content is compressed and cached when the handler is registered.
+func StaticBrotliContent() StaticOption {
+	return staticEncodingOption("br")
+}
+
+// StaticZstdContent enables zstd compressed content that is served directly when the client accepts zstd encoding.
+//
+// Pre-compressed files with .zst extension next to the original file are used if available,
+// otherwise content is compressed and cached when the handler is registered.
+func StaticZstdContent() StaticOption {
+	return staticEncodingOption("zstd")
+}
+
+// acceptedEncodings returns enabled encodings accepted by the client ordered by
+// the client preference and then by the server preference.
+func (h *staticHandler) acceptedEncodings(ctx *Context) []*staticEncoding {
+	if len(h.encodings) == 0 {
+		return nil
+	}
+
+	header := ctx.Header.Get(http.HeaderAcceptEncoding)
+	if len(header) == 0 {
+		return nil
+	}
+
+	type accepted struct {
+		enc *staticEncoding
+		q   float64
+	}
+
+	list := make([]accepted, 0, len(h.encodings))
+
+	for _, e := range h.encodings {
+		if q := acceptEncodingQuality(header, e.name); q > 0 {
+			list = append(list, accepted{enc: e, q: q})
+		}
+	}
+
+	if len(list) == 0 {
+		return nil
+	}
+
+	slices.SortStableFunc(list, func(a, b accepted) int {
+		return cmp.Compare(b.q, a.q)
+	})
+
+	encodings := make([]*staticEncoding, len(list))
+	for i, a := range list {
+		encodings[i] = a.enc
+	}
+
+	return encodings
+}
+
+// acceptEncodingQuality returns the quality value for the content coding in
+// the Accept-Encoding header value. Zero is returned if the coding is not
+// acceptable.
+func acceptEncodingQuality(header, coding string) float64 {
+	wildcard := float64(0)
+
+	for part := range strings.SplitSeq(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.TrimSpace(name)
+
+		q := float64(1)
+
+		for param := range strings.SplitSeq(params, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(k), "q") {
+				continue
+			}
+
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				q = f
+			}
+		}
+
+		if strings.EqualFold(name, coding) {
+			return q
+		}
+
+		if name == "*" {
+			wildcard = q
+		}
+	}
+
+	return wildcard
+}
@@ -1,9 +1,18 @@
 package azugo
 
 import (
+	"bufio"
 	"embed"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"azugo.io/core/http"
 	"github.com/go-quicktest/qt"
@@ -62,3 +71,444 @@ func TestRouterStaticSPARouterInvalidPath(t *testing.T) {
 	err := a.StaticEmbedded("/", &testdata, StaticDirTrimPrefix("testdata/"), StaticSPARouterPath("index.htm"))
 	qt.Assert(t, qt.ErrorMatches(err, "static SPA route handler file not found: .*"))
 }
+
+func TestRouterStaticFS(t *testing.T) {
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	err := a.StaticFS("/assets", fstest.MapFS{
+		"dist/app.js": &fstest.MapFile{Data: []byte("console.log('app');")},
+	}, StaticDirTrimPrefix("dist/"))
+	qt.Assert(t, qt.IsNil(err))
+
+	resp, err := a.TestClient().Get("/assets/app.js")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+	qt.Check(t, qt.Equals(string(resp.Header.ContentType()), "text/javascript; charset=utf-8"))
+	qt.Check(t, qt.Equals(string(resp.Body()), "console.log('app');"))
+}
+
+func TestRouterStaticDir(t *testing.T) {
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	dir := t.TempDir()
+	qt.Assert(t, qt.IsNil(os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html></html>"), 0o600)))
+
+	err := a.StaticDir("/", dir)
+	qt.Assert(t, qt.IsNil(err))
+
+	// File created after the handler was registered
+	qt.Assert(t, qt.IsNil(os.MkdirAll(filepath.Join(dir, "js"), 0o700)))
+	qt.Assert(t, qt.IsNil(os.WriteFile(filepath.Join(dir, "js", "app.js"), []byte("console.log('app');"), 0o600)))
+
+	resp, err := a.TestClient().Get("/js/app.js")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+	qt.Check(t, qt.Equals(string(resp.Header.ContentType()), "text/javascript; charset=utf-8"))
+	qt.Check(t, qt.Equals(string(resp.Body()), "console.log('app');"))
+
+	resp, err = a.TestClient().Get("/js")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusNotFound))
+}
+
+func TestRouterStaticDirRestart(t *testing.T) {
+	dir := t.TempDir()
+	qt.Assert(t, qt.IsNil(os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html></html>"), 0o600)))
+
+	a := NewTestApp()
+
+	qt.Assert(t, qt.IsNil(a.StaticDir("/", dir)))
+
+	get := func() {
+		resp, err := a.TestClient().Get("/index.html")
+		qt.Assert(t, qt.IsNil(err))
+		qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+		qt.Check(t, qt.Equals(string(resp.Body()), "<html></html>"))
+		fasthttp.ReleaseResponse(resp)
+	}
+
+	a.Start(t)
+	get()
+	a.Stop()
+
+	// Directory is opened again after the application is restarted
+	a.Start(t)
+	defer a.Stop()
+
+	get()
+}
+
+func TestStaticRootClose(t *testing.T) {
+	dir := t.TempDir()
+	qt.Assert(t, qt.IsNil(os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html></html>"), 0o600)))
+
+	root, err := os.OpenRoot(dir)
+	qt.Assert(t, qt.IsNil(err))
+
+	r := &staticRoot{dir: dir, root: root}
+	r.Close()
+	qt.Check(t, qt.IsNil(r.root))
+
+	// Closed root is no longer usable
+	_, err = root.Stat("index.html")
+	qt.Check(t, qt.IsNotNil(err))
+
+	st, err := fs.Stat(r, "index.html")
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(st.Size(), int64(13)))
+	qt.Check(t, qt.IsNotNil(r.root))
+
+	r.Close()
+}
+
+func TestRouterStaticDirSymlinkEscape(t *testing.T) {
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	outside := t.TempDir()
+	qt.Assert(t, qt.IsNil(os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0o600)))
+
+	dir := t.TempDir()
+	qt.Assert(t, qt.IsNil(os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html></html>"), 0o600)))
+
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(dir, "secret.txt")); err != nil {
+		t.Skipf("symbolic links not supported: %v", err)
+	}
+
+	err := a.StaticDir("/", dir, StaticSPARouterPath("index.html"))
+	qt.Assert(t, qt.IsNil(err))
+
+	resp, err := a.TestClient().Get("/secret.txt")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+	qt.Check(t, qt.Equals(string(resp.Body()), "<html></html>"))
+
+	resp, err = a.TestClient().Get("/../" + filepath.Base(outside) + "/secret.txt")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(resp.Body()), "<html></html>"))
+}
+
+func TestRouterStaticETag(t *testing.T) {
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	err := a.StaticEmbedded("/", &testdata, StaticDirTrimPrefix("testdata/"))
+	qt.Assert(t, qt.IsNil(err))
+
+	resp, err := a.TestClient().Get("/index.html")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+
+	etag := string(resp.Header.Peek("ETag"))
+	qt.Assert(t, qt.Not(qt.Equals(etag, "")))
+
+	resp, err = a.TestClient().Get("/index.html", a.TestClient().WithHeader("If-None-Match", `"other", `+etag))
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusNotModified))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("ETag")), etag))
+	qt.Check(t, qt.HasLen(resp.Body(), 0))
+
+	resp, err = a.TestClient().Get("/index.html", a.TestClient().WithHeader("If-None-Match", `"other"`))
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+}
+
+func TestRouterStaticCacheControl(t *testing.T) {
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	err := a.StaticFS("/", fstest.MapFS{
+		"index.html":                &fstest.MapFile{Data: []byte("<html></html>")},
+		"assets/app.0123abcd.js":    &fstest.MapFile{Data: []byte("console.log('app');")},
+		"assets/config.js":          &fstest.MapFile{Data: []byte("var config = {};")},
+		"assets/style.4567ef89.css": &fstest.MapFile{Data: []byte("body {}")},
+	},
+		StaticCacheControl(`^assets/.+\.[0-9a-f]{8}\.(js|css)$`, StaticCacheImmutable),
+		StaticCacheControl(`^index\.html$`, StaticCacheNoCache),
+	)
+	qt.Assert(t, qt.IsNil(err))
+
+	for path, expected := range map[string]string{
+		"/index.html":                StaticCacheNoCache,
+		"/assets/app.0123abcd.js":    StaticCacheImmutable,
+		"/assets/style.4567ef89.css": StaticCacheImmutable,
+		"/assets/config.js":          "",
+	} {
+		resp, err := a.TestClient().Get(path)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+		qt.Check(t, qt.Equals(string(resp.Header.Peek("Cache-Control")), expected), qt.Commentf("path %s", path))
+		fasthttp.ReleaseResponse(resp)
+	}
+}
+
+func TestRouterStaticCacheControlInvalidPattern(t *testing.T) {
+	a := NewTestApp()
+
+	err := a.StaticEmbedded("/", &testdata, StaticCacheControl(`[`, StaticCacheNoCache))
+	qt.Assert(t, qt.ErrorMatches(err, "invalid static cache control pattern .*"))
+}
+
+func TestRouterStaticDirLastModified(t *testing.T) {
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "index.html")
+	qt.Assert(t, qt.IsNil(os.WriteFile(file, []byte("<html></html>"), 0o600)))
+
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	qt.Assert(t, qt.IsNil(os.Chtimes(file, modTime, modTime)))
+
+	err := a.StaticDir("/", dir)
+	qt.Assert(t, qt.IsNil(err))
+
+	resp, err := a.TestClient().Get("/index.html")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("Last-Modified")), "Tue, 02 Jan 2024 03:04:05 GMT"))
+
+	resp, err = a.TestClient().Get("/index.html", a.TestClient().WithHeader("If-Modified-Since", "Tue, 02 Jan 2024 03:04:05 GMT"))
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusNotModified))
+}
+
+func TestAcceptEncodingQuality(t *testing.T) {
+	tests := []struct {
+		header, coding string
+		q              float64
+	}{
+		{"gzip, br", "br", 1},
+		{"gzip;q=0.5, br;q=0.8", "gzip", 0.5},
+		{"gzip;q=0", "gzip", 0},
+		{"gzip", "br", 0},
+		{"*;q=0.1, gzip", "zstd", 0.1},
+		{"br;q=0, *", "br", 0},
+		{"GZIP ; Q=0.3", "gzip", 0.3},
+	}
+
+	for _, tt := range tests {
+		qt.Check(t, qt.Equals(acceptEncodingQuality(tt.header, tt.coding), tt.q), qt.Commentf("%s in %q", tt.coding, tt.header))
+	}
+}
+
+func TestRouterStaticDirPrecompressed(t *testing.T) {
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	dir := t.TempDir()
+	qt.Assert(t, qt.IsNil(os.WriteFile(filepath.Join(dir, "app.js"), []byte("console.log('app');"), 0o600)))
+	qt.Assert(t, qt.IsNil(os.WriteFile(filepath.Join(dir, "app.js.br"), fasthttp.AppendBrotliBytes(nil, []byte("console.log('br');")), 0o600)))
+
+	err := a.StaticDir("/", dir, StaticGzipContent(), StaticBrotliContent(), StaticZstdContent())
+	qt.Assert(t, qt.IsNil(err))
+
+	resp, err := a.TestClient().Get("/app.js", a.TestClient().WithHeader("Accept-Encoding", "gzip, br"))
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("Content-Encoding")), "br"))
+	qt.Check(t, qt.Equals(string(resp.Header.ContentType()), "text/javascript; charset=utf-8"))
+
+	body, err := resp.BodyUnbrotli()
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(body), "console.log('br');"))
+
+	resp, err = a.TestClient().Get("/app.js", a.TestClient().WithHeader("Accept-Encoding", "br;q=0.5, zstd;q=0.1, gzip"))
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("Content-Encoding")), "gzip"))
+
+	body, err = resp.BodyGunzip()
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(body), "console.log('app');"))
+}
+
+func TestRouterStaticFSPrecompressed(t *testing.T) {
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	err := a.StaticFS("/", fstest.MapFS{
+		"app.js":       &fstest.MapFile{Data: []byte("console.log('app');")},
+		"app.js.gz":    &fstest.MapFile{Data: fasthttp.AppendGzipBytes(nil, []byte("console.log('gz');"))},
+		"vendor.js.gz": &fstest.MapFile{Data: fasthttp.AppendGzipBytes(nil, []byte("console.log('vendor');"))},
+	}, StaticGzipContent())
+	qt.Assert(t, qt.IsNil(err))
+
+	// Pre-compressed file is not served at its own path when the original file exists
+	resp, err := a.TestClient().Get("/app.js.gz")
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusNotFound))
+	fasthttp.ReleaseResponse(resp)
+
+	resp, err = a.TestClient().Get("/vendor.js.gz")
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+	fasthttp.ReleaseResponse(resp)
+}
+
+func TestRouterStaticReplacerEncodings(t *testing.T) {
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	err := a.StaticEmbedded("/", &testdata, StaticDirTrimPrefix("testdata/"), StaticGzipContent(), StaticZstdContent(), StaticContentReplacer(func(ctx *Context) (string, *strings.Replacer) {
+		return "cached-", strings.NewReplacer("{{BASE_URL}}", ctx.BaseURL(), "{{BASE_PATH}}", ctx.BasePath())
+	}))
+	qt.Assert(t, qt.IsNil(err))
+
+	for _, encoding := range []string{"zstd", "gzip", "zstd"} {
+		resp, err := a.TestClient().Get("/index.html", a.TestClient().WithHeader("Accept-Encoding", encoding))
+		qt.Assert(t, qt.IsNil(err))
+		qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+		qt.Check(t, qt.Equals(string(resp.Header.Peek("Content-Encoding")), encoding))
+
+		var body []byte
+		if encoding == "zstd" {
+			body, err = resp.BodyUnzstd()
+		} else {
+			body, err = resp.BodyGunzip()
+		}
+
+		qt.Assert(t, qt.IsNil(err))
+		qt.Check(t, qt.StringContains(string(body), `var baseURL = "http://test";`))
+		fasthttp.ReleaseResponse(resp)
+	}
+}
+
+func TestRouterStaticDevProxy(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	qt.Assert(t, qt.IsNil(err))
+
+	upstream := &fasthttp.Server{
+		Handler: func(ctx *fasthttp.RequestCtx) {
+			switch string(ctx.Path()) {
+			case "/app/index.html":
+				ctx.SetContentType("text/html; charset=utf-8")
+				ctx.SetBodyString("<html>dev</html>")
+			case "/app/main.js":
+				ctx.SetContentType("text/javascript; charset=utf-8")
+				ctx.SetBodyString("console.log('dev');")
+			default:
+				ctx.SetStatusCode(fasthttp.StatusNotFound)
+			}
+		},
+	}
+
+	go func() {
+		_ = upstream.Serve(ln)
+	}()
+	defer upstream.Shutdown() //nolint:errcheck
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	h, err := newStaticHandler(nil, StaticSPARouterPath("index.html"), StaticDevProxy(&url.URL{Scheme: "http", Host: ln.Addr().String(), Path: "/app/"}))
+	qt.Assert(t, qt.IsNil(err))
+
+	a.staticDevProxy("/", h)
+
+	// Development server is listed with proxy upstreams
+	upstreams := a.ProxyUpstreams()["/"]
+	qt.Assert(t, qt.HasLen(upstreams, 1))
+	qt.Check(t, qt.Equals(upstreams[0].URL().Host, ln.Addr().String()))
+
+	resp, err := a.TestClient().Get("/main.js")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+	qt.Check(t, qt.Equals(string(resp.Body()), "console.log('dev');"))
+
+	resp, err = a.TestClient().Get("/users/1")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+	qt.Check(t, qt.Equals(string(resp.Header.ContentType()), "text/html; charset=utf-8"))
+	qt.Check(t, qt.Equals(string(resp.Body()), "<html>dev</html>"))
+}
+
+func TestRouterStaticDevProxyUpgrade(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	qt.Assert(t, qt.IsNil(err))
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		br := bufio.NewReader(conn)
+
+		var req fasthttp.Request
+		if err := req.Read(br); err != nil {
+			return
+		}
+
+		if !req.Header.ConnectionUpgrade() || string(req.Header.Peek(http.HeaderUpgrade)) != "websocket" {
+			_, _ = conn.Write([]byte("HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\n\r\n"))
+
+			return
+		}
+
+		_, _ = conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"))
+
+		// Echo back everything received from the client
+		_, _ = io.Copy(conn, br)
+	}()
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	h, err := newStaticHandler(nil, StaticDevProxy(&url.URL{Scheme: "http", Host: ln.Addr().String()}))
+	qt.Assert(t, qt.IsNil(err))
+
+	a.staticDevProxy("/", h)
+
+	conn, err := a.ln.Dial()
+	qt.Assert(t, qt.IsNil(err))
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"))
+	qt.Assert(t, qt.IsNil(err))
+
+	br := bufio.NewReader(conn)
+
+	var header fasthttp.ResponseHeader
+	qt.Assert(t, qt.IsNil(header.Read(br)))
+	qt.Check(t, qt.Equals(header.StatusCode(), fasthttp.StatusSwitchingProtocols))
+	qt.Check(t, qt.IsTrue(header.ConnectionUpgrade()))
+	qt.Check(t, qt.Equals(string(header.Peek(http.HeaderUpgrade)), "websocket"))
+
+	_, err = conn.Write([]byte("ping"))
+	qt.Assert(t, qt.IsNil(err))
+
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(br, buf)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(buf), "ping"))
+}
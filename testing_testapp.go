@@ -68,6 +68,8 @@ func (a *TestApp) Start(t *testing.T) {
 	a.initLogs()
 	qt.Assert(t, qt.IsNil(a.App.App.Start()), qt.Commentf("Failed to start test app"))
 
+	a.startTasks()
+
 	server := &fasthttp.Server{
 		NoDefaultServerHeader:        true,
 		Handler:                      a.Handler,
@@ -95,6 +97,8 @@ func (a *TestApp) StartBenchmark() {
 		panic(err)
 	}
 
+	a.startTasks()
+
 	server := &fasthttp.Server{
 		NoDefaultServerHeader:        true,
 		Handler:                      a.Handler,
@@ -2,9 +2,13 @@ package azugo
 
 import (
 	"bytes"
-	"crypto/tls"
+	"hash/fnv"
+	"io"
 	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"azugo.io/azugo/internal/proxy"
 
@@ -14,18 +18,60 @@ import (
 	"go.uber.org/zap"
 )
 
-type proxyUpstream struct {
-	Scheme  []byte
-	Host    []byte
-	Path    []byte
-	BaseURL []byte
+// maxBufferedResponseBodySize is the maximum size of upstream response body with known
+// length that is read to memory. Larger response bodies are streamed to the client.
+const maxBufferedResponseBodySize = 64 << 10
+
+// ProxyTarget is an upstream server the proxy forwards requests to.
+type ProxyTarget struct {
+	url         *url.URL
+	weight      int
+	outstanding atomic.Int64
+	health      proxyTargetHealth
+
+	scheme  []byte
+	host    []byte
+	path    []byte
+	baseURL []byte
+}
+
+func newProxyTarget(u *url.URL, weight int) *ProxyTarget {
+	return &ProxyTarget{
+		url:     u,
+		weight:  weight,
+		scheme:  []byte(u.Scheme),
+		host:    []byte(u.Host),
+		path:    []byte(strings.TrimRight(u.Path, "/")),
+		baseURL: []byte(strings.TrimRight(u.String(), "/")),
+	}
+}
+
+// URL returns the upstream server URL.
+func (t *ProxyTarget) URL() *url.URL {
+	return t.url
+}
+
+// Weight returns the relative weight of the upstream server.
+func (t *ProxyTarget) Weight() int {
+	return t.weight
+}
+
+// Outstanding returns the number of requests currently in flight to the upstream server.
+func (t *ProxyTarget) Outstanding() int64 {
+	return t.outstanding.Load()
 }
 
 // Proxy is the proxy handler.
 type Proxy struct {
-	client        *fasthttp.Client
-	options       *proxyOptions
-	upstreamIndex uint
+	app     *App
+	client  *fasthttp.Client
+	options *proxyOptions
+	budget  *retryBudget
+	mirrors []*mirror
+
+	// Current upstreams replaced as a whole when resolved upstreams change
+	upstreams   atomic.Pointer[[]*ProxyTarget]
+	upstreamsMu sync.Mutex
 }
 
 // ProxyOption is a proxy option.
@@ -34,17 +80,33 @@ type ProxyOption interface {
 }
 
 type proxyOptions struct {
-	BasePath           string
-	InsecureSkipVerify bool
-	BodyRewriter       *proxy.BodyRewriter
-	Upstream           []*proxyUpstream
+	Name              string
+	BasePath          string
+	TLS               proxyTLSOptions
+	BodyRewriter      *proxy.BodyRewriter
+	Balancer          ProxyBalancer
+	HealthCheck       *ProxyHealthCheck
+	OutlierDetection  *ProxyOutlierDetection
+	Retry             *ProxyRetry
+	KeepPrefix        bool
+	PathRewrites      []*proxyPathRewrite
+	Forwarded         ProxyForwarded
+	Host              string
+	Resolver          ProxyUpstreamResolver
+	Mirrors           []*proxyMirrorOption
+	RequestModifiers  []ProxyRequestModifier
+	ResponseModifiers []ProxyResponseModifier
+	Upstream          []*ProxyTarget
+	// Errors of invalid options reported when the proxy is registered
+	Errors []error
 }
 
 // ProxyUpstreamInsecureSkipVerify skips TLS certificate verification for upstream request.
+// Upstream certificates are verified by default.
 type ProxyUpstreamInsecureSkipVerify bool
 
 func (o ProxyUpstreamInsecureSkipVerify) apply(opts *proxyOptions) {
-	opts.InsecureSkipVerify = bool(o)
+	opts.TLS.InsecureSkipVerify = bool(o)
 }
 
 type bodyRewriterRule struct {
@@ -67,7 +129,32 @@ func (o ProxyUpstreamBodyReplaceURL) apply(opts *proxyOptions) {
 	opts.BodyRewriter.RewriteBaseURL = bool(o)
 }
 
-type proxyUpstreams []*proxyUpstream
+// ProxyBodyRewriteFunc rewrites the decoded upstream response body read from src writing
+// the result to dst. Body is rewritten while it is streamed to the client.
+//
+// RewriteURL returns the URL pointing to the upstream rewritten to point to the proxy
+// or the URL unchanged otherwise.
+type ProxyBodyRewriteFunc func(dst io.Writer, src io.Reader, rewriteURL func(u []byte) []byte) error
+
+type bodyRewriteFunc struct {
+	contentType string
+	fn          ProxyBodyRewriteFunc
+}
+
+func (o *bodyRewriteFunc) apply(opts *proxyOptions) {
+	opts.BodyRewriter.Register(o.contentType, proxy.RewriteFunc(o.fn))
+}
+
+// ProxyBodyRewrite registers the response body rewrite function for the content type
+// replacing the built-in rewriting of that content type. Content type is matched by prefix.
+//
+// By default upstream URLs are rewritten in HTML href, src, action, srcset and style
+// attributes, CSS url() references, JSON string values and anywhere in other text content.
+func ProxyBodyRewrite(contentType string, fn ProxyBodyRewriteFunc) ProxyOption {
+	return &bodyRewriteFunc{contentType, fn}
+}
+
+type proxyUpstreams []*ProxyTarget
 
 func (o proxyUpstreams) apply(opts *proxyOptions) {
 	opts.Upstream = append(opts.Upstream, o...)
@@ -75,92 +162,252 @@ func (o proxyUpstreams) apply(opts *proxyOptions) {
 
 // ProxyUpstream adds one or more upstream URLs.
 func ProxyUpstream(upstream ...*url.URL) ProxyOption {
+	return ProxyUpstreamWeight(1, upstream...)
+}
+
+// ProxyUpstreamWeight adds one or more upstream URLs with the given relative weight
+// used by the weighted balancers. Upstreams with zero weight receive no traffic
+// from weighted balancers.
+func ProxyUpstreamWeight(weight int, upstream ...*url.URL) ProxyOption {
 	upstr := make(proxyUpstreams, len(upstream))
 	for i, v := range upstream {
-		upstr[i] = &proxyUpstream{
-			Scheme:  []byte(v.Scheme),
-			Host:    []byte(v.Host),
-			Path:    []byte(strings.TrimRight(v.Path, "/")),
-			BaseURL: []byte(strings.TrimRight(v.String(), "/")),
-		}
+		upstr[i] = newProxyTarget(v, max(weight, 0))
 	}
 
 	return upstr
 }
 
+type proxyBalancerOption struct {
+	balancer ProxyBalancer
+}
+
+func (o proxyBalancerOption) apply(opts *proxyOptions) {
+	opts.Balancer = o.balancer
+}
+
+// ProxyUpstreamBalancer sets the load balancing strategy used to select the upstream
+// for each request. By default upstreams are selected using round-robin.
+func ProxyUpstreamBalancer(balancer ProxyBalancer) ProxyOption {
+	return proxyBalancerOption{balancer}
+}
+
+// proxyName sets the proxy name used in logs and metrics. Defaults to the base path.
+type proxyName string
+
+func (o proxyName) apply(opts *proxyOptions) {
+	opts.Name = string(o)
+}
+
 // newUpstreamProxy creates a new proxy handler.
 func (m *mux) newUpstreamProxy(basePath string, options ...ProxyOption) *Proxy {
 	opt := &proxyOptions{
-		BasePath:           strings.TrimRight(basePath, "/"),
-		InsecureSkipVerify: true,
-		BodyRewriter:       proxy.NewBodyRewriter(),
+		BasePath:     strings.TrimRight(basePath, "/"),
+		BodyRewriter: proxy.NewBodyRewriter(),
 	}
 
 	for _, option := range options {
 		option.apply(opt)
 	}
 
-	return &Proxy{
+	if len(opt.Name) == 0 {
+		opt.Name = opt.BasePath
+	}
+
+	for _, err := range opt.Errors {
+		m.app.Log().Error("invalid proxy option", zap.String("proxy", opt.Name), zap.Error(err))
+	}
+
+	if opt.Balancer == nil {
+		opt.Balancer = ProxyRoundRobin()
+	}
+
+	tlsConfig, err := opt.TLS.config(func(err error) {
+		m.app.Log().Warn("failed to reload proxy upstream certificates", zap.String("proxy", opt.Name), zap.Error(err))
+	})
+	if err != nil {
+		// Files might become available later so only log the error
+		m.app.Log().Error("failed to load proxy upstream certificates", zap.String("proxy", opt.Name), zap.Error(err))
+	}
+
+	p := &Proxy{
+		app: m.app,
 		client: &fasthttp.Client{
 			NoDefaultUserAgentHeader: true,
-			TLSConfig: &tls.Config{
-				//nolint:gosec
-				InsecureSkipVerify: opt.InsecureSkipVerify,
+			StreamResponseBody:       true,
+			DisablePathNormalizing:   true,
+			MaxResponseBodySize:      maxBufferedResponseBodySize,
+			TLSConfig:                tlsConfig,
+			ReadBufferSize:           m.app.ServerOptions.ResponseWriteBufferSize,
+			WriteBufferSize:          m.app.ServerOptions.RequestReadBufferSize,
+			ConfigureClient: func(hc *fasthttp.HostClient) error {
+				if hc.IsTLS {
+					hc.TLSConfig = hostTLSConfig(hc.TLSConfig, hc.Addr)
+				}
+
+				return nil
 			},
-			ReadBufferSize:  m.app.ServerOptions.ResponseWriteBufferSize,
-			WriteBufferSize: m.app.ServerOptions.RequestReadBufferSize,
 		},
 		options: opt,
 	}
+
+	if opt.Retry != nil && opt.Retry.Attempts > 1 {
+		p.budget = newRetryBudget(opt.Retry.Budget, opt.Retry.BudgetBurst)
+	}
+
+	upstreams := opt.Upstream
+	p.upstreams.Store(&upstreams)
+
+	for _, t := range upstreams {
+		p.registerUpstreamMetrics(t)
+	}
+
+	if opt.HealthCheck != nil {
+		m.app.runTask(p.runHealthChecks)
+	}
+
+	if opt.Resolver != nil {
+		m.app.runTask(p.resolve)
+	}
+
+	for _, o := range opt.Mirrors {
+		p.mirrors = append(p.mirrors, newMirror(m.app, o.url, o.sample, o.options...))
+	}
+
+	return p
 }
 
 // Handler implements azugo.Handler to handle incoming request.
 func (p *Proxy) Handler(ctx *Context) {
-	if len(p.options.Upstream) == 0 {
+	p.handle(ctx, p.upstreamPath(ctx))
+}
+
+// handle proxies the request to the upstream server with the given escaped path relative to the upstream URL.
+// Path can contain query string that is merged with the request query string.
+func (p *Proxy) handle(ctx *Context, path string) {
+	targets := p.healthyTargets()
+
+	upstream := p.options.Balancer.Next(ctx, targets)
+	if upstream == nil && len(p.Upstreams()) > 0 {
+		ctx.Log().Warn("no healthy proxy upstream available")
+		ctx.StatusCode(http.StatusServiceUnavailable)
+		ctx.Text(http.StatusMessage(http.StatusServiceUnavailable))
+
+		return
+	} else if upstream == nil {
 		ctx.StatusCode(http.StatusBadGateway)
 		ctx.Text(http.StatusMessage(http.StatusBadGateway))
 
 		return
 	}
 
-	// This is not thread safe but we don't care if multiple requests goes to the same upstream.
-	p.upstreamIndex = (p.upstreamIndex + 1) % uint(len(p.options.Upstream))
-	upstream := p.options.Upstream[p.upstreamIndex]
-
 	// Copy request from original
 	req := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(req)
 
 	ctx.Request().CopyTo(req)
 
-	resp := ctx.Response()
+	// Stream request body to the upstream as it is received unless it must be buffered for retries
+	if ctx.Request().IsBodyStream() {
+		if p.bufferBody(ctx.Request()) {
+			req.SetBody(ctx.Request().Body())
+		} else {
+			// Wrap the stream as it is owned and released by the server
+			req.SetBodyStream(struct{ io.Reader }{ctx.Request().BodyStream()}, ctx.Request().Header.ContentLength())
+		}
+	}
+
+	resp := fasthttp.AcquireResponse()
+	defer func() {
+		// Response is released by the client response once it has been moved there
+		if resp != nil {
+			fasthttp.ReleaseResponse(resp)
+		}
+	}()
 
 	uri := bytebufferpool.Get()
 	defer bytebufferpool.Put(uri)
 
-	_, _ = uri.Write(upstream.Path)
-	_, _ = uri.WriteString(strings.TrimPrefix(strings.TrimPrefix(ctx.Path(), ctx.BasePath()), p.options.BasePath))
+	_, _ = uri.WriteString(path)
 
 	// Forward also query string to upstream
 	q := req.URI().QueryString()
 	if len(q) > 0 {
-		_ = uri.WriteByte('?')
+		if strings.IndexByte(path, '?') == -1 {
+			_ = uri.WriteByte('?')
+		} else {
+			_ = uri.WriteByte('&')
+		}
+
 		_, _ = uri.Write(q)
 	}
 
-	req.SetRequestURIBytes(uri.Bytes())
-	req.URI().SetSchemeBytes(upstream.Scheme)
-	req.SetHostBytes(upstream.Host)
-
 	// Downgrade HTTP/2 to HTTP/1.1
 	if ctx.IsTLS() && bytes.Equal(req.Header.Protocol(), []byte("HTTP/2")) {
 		req.Header.SetProtocolBytes([]byte("HTTP/1.1"))
 	}
 
+	upgrade := ctx.Request().Header.ConnectionUpgrade()
+
 	proxy.StripHeaders(&req.Header)
+	p.setForwardedHeaders(ctx, req)
+
+	for _, m := range p.options.RequestModifiers {
+		if err := m(ctx, req); err != nil {
+			ctx.Error(err)
 
-	if err := p.client.Do(req, resp); err != nil {
+			return
+		}
+	}
+
+	var mirrors []*mirrorRequest
+
+	if !upgrade {
+		for _, m := range p.mirrors {
+			if r := m.capture(req, uri.Bytes()); r != nil {
+				mirrors = append(mirrors, r)
+			}
+		}
+
+		teeRequestBody(req, mirrors)
+	}
+
+	var err error
+
+	start := time.Now()
+
+	if upgrade {
+		// Restore hop-by-hop headers required for the protocol switch
+		req.Header.Set(http.HeaderConnection, "Upgrade")
+		req.Header.SetBytesV(http.HeaderUpgrade, ctx.Request().Header.Peek(http.HeaderUpgrade))
+
+		p.setUpstream(req, upstream, uri.Bytes())
+
+		upstream.outstanding.Add(1)
+		defer upstream.outstanding.Add(-1)
+
+		var switched bool
+
+		switched, err = p.upgrade(ctx, upstream, req, resp)
+		p.observe(upstream, start, err, resp)
+		p.logUpstream(ctx, upstream, start)
+
+		if switched {
+			return
+		}
+
+		p.report(upstream, err == nil && resp.StatusCode() < http.StatusInternalServerError)
+	} else {
+		upstream, err = p.do(ctx, req, resp, upstream, targets, uri.Bytes())
+		p.logUpstream(ctx, upstream, start)
+	}
+
+	if err != nil {
 		ctx.Log().With(zap.Error(err)).Warn("proxy upstream failed")
+
+		for _, r := range mirrors {
+			r.enqueue(http.StatusBadGateway, nil)
+		}
+
 		ctx.StatusCode(http.StatusBadGateway)
 		ctx.Text(http.StatusMessage(http.StatusBadGateway))
 
@@ -170,7 +417,113 @@ func (p *Proxy) Handler(ctx *Context) {
 	proxy.StripHeaders(&resp.Header)
 	proxy.RewriteCookies(ctx.IsTLS(), ctx.Host(), resp)
 
-	if p.options.BodyRewriter != nil && p.options.BodyRewriter.Enabled() {
-		p.options.BodyRewriter.RewriteResponse(append([]byte(ctx.BaseURL()), []byte(p.options.BasePath)...), upstream.BaseURL, resp)
+	for _, m := range p.options.ResponseModifiers {
+		if err := m(ctx, resp); err != nil {
+			for _, r := range mirrors {
+				r.enqueue(resp.StatusCode(), nil)
+			}
+
+			ctx.Error(err)
+
+			return
+		}
+	}
+
+	p.respond(ctx, upstream, resp, mirrors)
+	resp = nil
+}
+
+// upstreamBody is the upstream response body stream that releases the upstream response when closed.
+type upstreamBody struct {
+	io.Reader
+
+	resp *fasthttp.Response
+}
+
+func (b *upstreamBody) Close() error {
+	fasthttp.ReleaseResponse(b.resp)
+
+	return nil
+}
+
+// respond moves the upstream response to the client response rewriting its body if needed.
+// Mirrored requests are queued once the response body has been sent to the client.
+// Upstream response must not be used afterwards.
+func (p *Proxy) respond(ctx *Context, upstream *ProxyTarget, resp *fasthttp.Response, mirrors []*mirrorRequest) {
+	dst := ctx.Response()
+	resp.Header.CopyTo(&dst.Header)
+
+	if !resp.IsBodyStream() {
+		if len(mirrors) > 0 {
+			h := fnv.New64a()
+			_, _ = h.Write(resp.Body())
+
+			for _, r := range mirrors {
+				r.enqueue(resp.StatusCode(), h)
+			}
+		}
+
+		// Response without body, ex. to HEAD request, is never rewritten
+		if len(resp.Body()) > 0 && p.rewrite(ctx, upstream, &upstreamBody{Reader: bytes.NewReader(resp.Body()), resp: resp}) {
+			return
+		}
+
+		dst.SetBody(resp.Body())
+		fasthttp.ReleaseResponse(resp)
+
+		return
+	}
+
+	var body io.Reader = &upstreamBody{Reader: resp.BodyStream(), resp: resp}
+
+	// Compare upstream response body before it is rewritten
+	if len(mirrors) > 0 {
+		body = &mirrorBody{Reader: body, requests: mirrors, status: resp.StatusCode(), hash: fnv.New64a()}
+	}
+
+	if p.rewrite(ctx, upstream, body) {
+		return
+	}
+
+	dst.SetBodyStream(body, resp.Header.ContentLength())
+}
+
+// rewrite sets the client response body to the rewritten upstream response body.
+// Returns false if the body is not rewritten.
+func (p *Proxy) rewrite(ctx *Context, upstream *ProxyTarget, body io.Reader) bool {
+	if p.options.BodyRewriter == nil {
+		return false
+	}
+
+	base, upstreamBase := p.rewriteBaseURL(ctx, upstream)
+
+	r := p.options.BodyRewriter.Rewrite(base, upstreamBase, &ctx.Response().Header, body)
+	if r == nil {
+		return false
+	}
+
+	ctx.Response().SetBodyStream(r, -1)
+
+	return true
+}
+
+// setUpstream sets the upstream request URI from the upstream base URL and
+// the request path with query string relative to it.
+func (p *Proxy) setUpstream(req *fasthttp.Request, upstream *ProxyTarget, uri []byte) {
+	buf := bytebufferpool.Get()
+	defer bytebufferpool.Put(buf)
+
+	_, _ = buf.Write(upstream.path)
+	_, _ = buf.Write(uri)
+
+	req.SetRequestURIBytes(buf.Bytes())
+	// Path is already cleaned, keep it escaped as is
+	req.URI().DisablePathNormalizing = true
+	req.URI().SetSchemeBytes(upstream.scheme)
+	req.SetHostBytes(upstream.host)
+
+	if len(p.options.Host) > 0 {
+		req.Header.SetHost(p.options.Host)
+		req.UseHostHeader = true
 	}
 }
@@ -0,0 +1,258 @@
+package azugo
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+)
+
+// ProxyBalancer selects the upstream target for the proxied request.
+type ProxyBalancer interface {
+	// Next returns the target to forward the request to or nil if none of the targets can be used.
+	Next(ctx *Context, targets []*ProxyTarget) *ProxyTarget
+}
+
+type roundRobinBalancer struct {
+	next atomic.Uint64
+}
+
+// ProxyRoundRobin returns balancer that selects targets in turn.
+func ProxyRoundRobin() ProxyBalancer {
+	return &roundRobinBalancer{}
+}
+
+func (b *roundRobinBalancer) index(n int) int {
+	return int((b.next.Add(1) - 1) % uint64(n))
+}
+
+func (b *roundRobinBalancer) Next(_ *Context, targets []*ProxyTarget) *ProxyTarget {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	return targets[b.index(len(targets))]
+}
+
+type weightedRoundRobinBalancer struct {
+	mu      sync.Mutex
+	current map[*ProxyTarget]int
+}
+
+// ProxyWeightedRoundRobin returns balancer that selects targets in turn proportionally
+// to their weight. Selections are spread evenly instead of sending a burst of requests
+// to the target with the highest weight.
+func ProxyWeightedRoundRobin() ProxyBalancer {
+	return &weightedRoundRobinBalancer{
+		current: make(map[*ProxyTarget]int),
+	}
+}
+
+func (b *weightedRoundRobinBalancer) Next(_ *Context, targets []*ProxyTarget) *ProxyTarget {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Forget targets that are no longer in the list
+	if len(b.current) > len(targets) {
+		clear(b.current)
+	}
+
+	var (
+		best  *ProxyTarget
+		total int
+	)
+
+	for _, t := range targets {
+		if t.weight == 0 {
+			continue
+		}
+
+		total += t.weight
+		b.current[t] += t.weight
+
+		if best == nil || b.current[t] > b.current[best] {
+			best = t
+		}
+	}
+
+	if best != nil {
+		b.current[best] -= total
+	}
+
+	return best
+}
+
+type leastOutstandingBalancer struct {
+	rr roundRobinBalancer
+}
+
+// ProxyLeastOutstanding returns balancer that selects the target with the least
+// number of requests in flight. Ties are resolved in round-robin order.
+func ProxyLeastOutstanding() ProxyBalancer {
+	return &leastOutstandingBalancer{}
+}
+
+func (b *leastOutstandingBalancer) Next(_ *Context, targets []*ProxyTarget) *ProxyTarget {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	start := b.rr.index(len(targets))
+
+	var best *ProxyTarget
+
+	for i := range targets {
+		t := targets[(start+i)%len(targets)]
+		if best == nil || t.Outstanding() < best.Outstanding() {
+			best = t
+		}
+	}
+
+	return best
+}
+
+type randomTwoChoicesBalancer struct{}
+
+// ProxyRandomTwoChoices returns balancer that picks two random targets and selects
+// the one with the least number of requests in flight.
+func ProxyRandomTwoChoices() ProxyBalancer {
+	return randomTwoChoicesBalancer{}
+}
+
+func (randomTwoChoicesBalancer) Next(_ *Context, targets []*ProxyTarget) *ProxyTarget {
+	switch len(targets) {
+	case 0:
+		return nil
+	case 1:
+		return targets[0]
+	}
+
+	//nolint:gosec
+	i, j := rand.IntN(len(targets)), rand.IntN(len(targets)-1)
+	if j >= i {
+		j++
+	}
+
+	if targets[j].Outstanding() < targets[i].Outstanding() {
+		return targets[j]
+	}
+
+	return targets[i]
+}
+
+// ProxyHashKey returns the key used by the consistent hash balancer to select
+// the target for the request. Empty key means that request has no affinity.
+type ProxyHashKey func(ctx *Context) string
+
+// ProxyHashKeyCookie uses the value of the request cookie as the hash key.
+func ProxyHashKeyCookie(name string) ProxyHashKey {
+	return func(ctx *Context) string {
+		return ctx.Cookie.Get(name)
+	}
+}
+
+// ProxyHashKeyHeader uses the value of the request header as the hash key.
+func ProxyHashKeyHeader(name string) ProxyHashKey {
+	return func(ctx *Context) string {
+		return ctx.Header.Get(name)
+	}
+}
+
+// ProxyHashKeyClientIP uses the client IP address as the hash key.
+func ProxyHashKeyClientIP() ProxyHashKey {
+	return func(ctx *Context) string {
+		ip := ctx.IP()
+		if ip == nil {
+			return ""
+		}
+
+		return ip.String()
+	}
+}
+
+// ProxyHashKeyUserID uses the authorized user ID as the hash key.
+func ProxyHashKeyUserID() ProxyHashKey {
+	return func(ctx *Context) string {
+		u := ctx.User()
+		if u == nil || !u.Authorized() {
+			return ""
+		}
+
+		return u.ID()
+	}
+}
+
+type consistentHashBalancer struct {
+	key ProxyHashKey
+	rr  roundRobinBalancer
+}
+
+// ProxyConsistentHash returns balancer that always selects the same target for
+// the same hash key, ex. for sticky sessions. When a target is added or removed
+// only requests mapped to that target move to other targets. Targets are chosen
+// proportionally to their weight. Requests without hash key are balanced using
+// round-robin.
+func ProxyConsistentHash(key ProxyHashKey) ProxyBalancer {
+	return &consistentHashBalancer{
+		key: key,
+	}
+}
+
+func (b *consistentHashBalancer) Next(ctx *Context, targets []*ProxyTarget) *ProxyTarget {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	key := b.key(ctx)
+	if len(key) == 0 {
+		// Round-robin skipping targets with zero weight
+		n := len(targets)
+		start := b.rr.index(n)
+
+		for i := range n {
+			if t := targets[(start+i)%n]; t.weight > 0 {
+				return t
+			}
+		}
+
+		return nil
+	}
+
+	// Weighted rendezvous hashing
+	var (
+		best  *ProxyTarget
+		score float64
+	)
+
+	for _, t := range targets {
+		if t.weight == 0 {
+			continue
+		}
+
+		s := float64(t.weight) / -math.Log(hashUnit(key, t.baseURL))
+		if best == nil || s > score {
+			best, score = t, s
+		}
+	}
+
+	return best
+}
+
+// hashUnit hashes the key and the target to a number in the open interval (0, 1).
+func hashUnit(key string, target []byte) float64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write(target)
+
+	// Finalize with splitmix64 to spread similar inputs
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+
+	return (float64(x>>11) + 0.5) / (1 << 53)
+}
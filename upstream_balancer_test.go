@@ -0,0 +1,138 @@
+package azugo
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+)
+
+func testProxyTargets(weights ...int) []*ProxyTarget {
+	targets := make([]*ProxyTarget, len(weights))
+	for i, w := range weights {
+		targets[i] = newProxyTarget(&url.URL{Scheme: "http", Host: "upstream" + strconv.Itoa(i)}, w)
+	}
+
+	return targets
+}
+
+func TestProxyRoundRobin(t *testing.T) {
+	targets := testProxyTargets(1, 1, 1)
+	b := ProxyRoundRobin()
+
+	for i := range 6 {
+		qt.Check(t, qt.Equals(b.Next(nil, targets), targets[i%3]))
+	}
+
+	qt.Check(t, qt.IsNil(b.Next(nil, nil)))
+}
+
+func TestProxyWeightedRoundRobin(t *testing.T) {
+	targets := testProxyTargets(5, 1, 1, 0)
+	b := ProxyWeightedRoundRobin()
+
+	counts := make(map[*ProxyTarget]int)
+
+	var prev *ProxyTarget
+
+	bursts := 0
+
+	for range 70 {
+		next := b.Next(nil, targets)
+		counts[next]++
+
+		if next == prev {
+			bursts++
+		}
+
+		prev = next
+	}
+
+	qt.Check(t, qt.Equals(counts[targets[0]], 50))
+	qt.Check(t, qt.Equals(counts[targets[1]], 10))
+	qt.Check(t, qt.Equals(counts[targets[2]], 10))
+	qt.Check(t, qt.Equals(counts[targets[3]], 0))
+	// Smooth selection does not send all requests of the same target in a row
+	qt.Check(t, qt.IsTrue(bursts < 40))
+}
+
+func TestProxyLeastOutstanding(t *testing.T) {
+	targets := testProxyTargets(1, 1, 1)
+	targets[0].outstanding.Store(3)
+	targets[1].outstanding.Store(1)
+	targets[2].outstanding.Store(2)
+
+	b := ProxyLeastOutstanding()
+
+	for range 3 {
+		qt.Check(t, qt.Equals(b.Next(nil, targets), targets[1]))
+	}
+}
+
+func TestProxyRandomTwoChoices(t *testing.T) {
+	targets := testProxyTargets(1, 1)
+	targets[0].outstanding.Store(5)
+
+	b := ProxyRandomTwoChoices()
+
+	for range 10 {
+		qt.Check(t, qt.Equals(b.Next(nil, targets), targets[1]))
+	}
+
+	qt.Check(t, qt.Equals(b.Next(nil, targets[:1]), targets[0]))
+}
+
+func TestProxyConsistentHash(t *testing.T) {
+	targets := testProxyTargets(1, 1, 1, 1)
+
+	var key string
+
+	b := ProxyConsistentHash(func(_ *Context) string {
+		return key
+	})
+
+	selected := make(map[string]*ProxyTarget, 100)
+	counts := make(map[*ProxyTarget]int)
+
+	for i := range 100 {
+		key = "session-" + strconv.Itoa(i)
+		selected[key] = b.Next(nil, targets)
+		counts[selected[key]]++
+
+		qt.Check(t, qt.Equals(b.Next(nil, targets), selected[key]))
+	}
+
+	for _, target := range targets {
+		qt.Check(t, qt.IsTrue(counts[target] > 0))
+	}
+
+	// Removing target moves only keys mapped to the removed target
+	removed := targets[3]
+
+	for k, target := range selected {
+		key = k
+
+		next := b.Next(nil, targets[:3])
+		if target != removed {
+			qt.Check(t, qt.Equals(next, target))
+		} else {
+			qt.Check(t, qt.Not(qt.Equals(next, removed)))
+		}
+	}
+
+	// Requests without hash key use round-robin
+	key = ""
+
+	qt.Check(t, qt.Equals(b.Next(nil, targets), targets[0]))
+	qt.Check(t, qt.Equals(b.Next(nil, targets), targets[1]))
+
+	// Targets with zero weight are skipped by round-robin as well
+	targets = testProxyTargets(0, 1, 0)
+
+	for range 3 {
+		qt.Check(t, qt.Equals(b.Next(nil, targets), targets[1]))
+	}
+
+	qt.Check(t, qt.IsNil(b.Next(nil, testProxyTargets(0, 0))))
+}
@@ -0,0 +1,276 @@
+package azugo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+)
+
+// ProxyHealthCheck enables periodic active health checks of the proxy upstreams.
+//
+// Upstreams failing the health check receive no traffic until the check succeeds again.
+type ProxyHealthCheck struct {
+	// Path to request on the upstream. Defaults to "/".
+	Path string
+	// Status is the expected response status code. By default any 2xx status code is accepted.
+	Status int
+	// Interval between health checks. Defaults to 10 seconds.
+	Interval time.Duration
+	// Timeout of a single health check. Defaults to 2 seconds.
+	Timeout time.Duration
+}
+
+func (o ProxyHealthCheck) apply(opts *proxyOptions) {
+	if len(o.Path) == 0 {
+		o.Path = "/"
+	}
+
+	if o.Interval <= 0 {
+		o.Interval = 10 * time.Second
+	}
+
+	if o.Timeout <= 0 {
+		o.Timeout = 2 * time.Second
+	}
+
+	opts.HealthCheck = &o
+}
+
+// ProxyOutlierDetection enables passive health checking of the proxy upstreams.
+//
+// Upstream is ejected when requests to it fail with connection errors or 5xx
+// status codes consecutively. Ejected upstreams receive no traffic for the
+// ejection time that doubles every time the same upstream is ejected again
+// before it recovers.
+type ProxyOutlierDetection struct {
+	// Failures is the number of consecutive failures after which upstream is ejected. Defaults to 5.
+	Failures int
+	// Window in which failures are counted. Failures older than window are forgotten. Defaults to 10 seconds.
+	Window time.Duration
+	// EjectionTime is the base time upstream is ejected for. Defaults to 30 seconds.
+	EjectionTime time.Duration
+	// MaxEjectionTime is the maximum time upstream is ejected for. Defaults to 5 minutes.
+	MaxEjectionTime time.Duration
+}
+
+func (o ProxyOutlierDetection) apply(opts *proxyOptions) {
+	if o.Failures <= 0 {
+		o.Failures = 5
+	}
+
+	if o.Window <= 0 {
+		o.Window = 10 * time.Second
+	}
+
+	if o.EjectionTime <= 0 {
+		o.EjectionTime = 30 * time.Second
+	}
+
+	if o.MaxEjectionTime < o.EjectionTime {
+		o.MaxEjectionTime = max(5*time.Minute, o.EjectionTime)
+	}
+
+	opts.OutlierDetection = &o
+}
+
+// proxyTargetHealth holds the health state of the upstream.
+type proxyTargetHealth struct {
+	mu sync.Mutex
+	// down is set when upstream fails active health check.
+	down bool
+	// ejectedUntil is set when upstream is ejected by outlier detection.
+	ejectedUntil time.Time
+	ejections    int
+	failures     int
+	lastFailure  time.Time
+}
+
+// Healthy reports whether the upstream can receive traffic.
+func (t *ProxyTarget) Healthy() bool {
+	t.health.mu.Lock()
+	defer t.health.mu.Unlock()
+
+	return !t.health.down && !time.Now().Before(t.health.ejectedUntil)
+}
+
+// healthyTargets returns upstreams that can receive traffic.
+func (p *Proxy) healthyTargets() []*ProxyTarget {
+	targets := p.Upstreams()
+	if p.options.HealthCheck == nil && p.options.OutlierDetection == nil {
+		return targets
+	}
+
+	for i, t := range targets {
+		if t.Healthy() {
+			continue
+		}
+
+		// Copy only when some upstream is unhealthy
+		healthy := make([]*ProxyTarget, i, len(targets)-1)
+		copy(healthy, targets[:i])
+
+		for _, t := range targets[i+1:] {
+			if t.Healthy() {
+				healthy = append(healthy, t)
+			}
+		}
+
+		return healthy
+	}
+
+	return targets
+}
+
+func (p *Proxy) metricLabels(t *ProxyTarget) string {
+	return fmt.Sprintf("{proxy=%q,upstream=%q}", p.options.Name, t.url.String())
+}
+
+// registerHealthMetrics registers health metrics of the upstream.
+func (p *Proxy) registerHealthMetrics(t *ProxyTarget) {
+	if p.options.HealthCheck == nil && p.options.OutlierDetection == nil {
+		return
+	}
+
+	metrics.GetOrCreateGauge("proxy_upstream_healthy"+p.metricLabels(t), func() float64 {
+		if t.Healthy() {
+			return 1
+		}
+
+		return 0
+	})
+}
+
+// report records the result of the request to the upstream for outlier detection.
+func (p *Proxy) report(t *ProxyTarget, success bool) {
+	od := p.options.OutlierDetection
+	if od == nil {
+		return
+	}
+
+	now := time.Now()
+
+	t.health.mu.Lock()
+
+	if success {
+		recovered := t.health.ejections > 0 && !now.Before(t.health.ejectedUntil)
+		t.health.failures = 0
+		if recovered {
+			t.health.ejections = 0
+		}
+
+		t.health.mu.Unlock()
+
+		if recovered {
+			p.app.Log().Info("proxy upstream recovered", zap.String("upstream.address", t.url.String()))
+		}
+
+		return
+	}
+
+	if now.Sub(t.health.lastFailure) > od.Window {
+		t.health.failures = 0
+	}
+
+	t.health.failures++
+	t.health.lastFailure = now
+
+	if t.health.failures < od.Failures || now.Before(t.health.ejectedUntil) {
+		t.health.mu.Unlock()
+
+		return
+	}
+
+	d := min(od.EjectionTime<<min(t.health.ejections, 16), od.MaxEjectionTime)
+	t.health.ejections++
+	t.health.failures = 0
+	t.health.ejectedUntil = now.Add(d)
+
+	t.health.mu.Unlock()
+
+	metrics.GetOrCreateCounter("proxy_upstream_ejections_total" + p.metricLabels(t)).Inc()
+
+	p.app.Log().Warn("proxy upstream ejected",
+		zap.String("upstream.address", t.url.String()),
+		zap.Duration("duration", d),
+	)
+}
+
+// runHealthChecks checks health of all upstreams periodically until the context is done.
+func (p *Proxy) runHealthChecks(ctx context.Context) {
+	ticker := time.NewTicker(p.options.HealthCheck.Interval)
+	defer ticker.Stop()
+
+	for {
+		var wg sync.WaitGroup
+
+		for _, t := range p.Upstreams() {
+			wg.Go(func() {
+				p.checkHealth(t)
+			})
+		}
+
+		wg.Wait()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkHealth does active health check of the upstream and updates its health state.
+func (p *Proxy) checkHealth(t *ProxyTarget) {
+	check := p.options.HealthCheck
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.Header.SetMethod(fasthttp.MethodGet)
+	req.SetRequestURI(string(t.baseURL) + check.Path)
+
+	err := p.client.DoTimeout(req, resp, check.Timeout)
+
+	healthy := err == nil
+	if healthy && check.Status > 0 {
+		healthy = resp.StatusCode() == check.Status
+	} else if healthy {
+		healthy = resp.StatusCode() >= 200 && resp.StatusCode() < 300
+	}
+
+	if !healthy {
+		metrics.GetOrCreateCounter("proxy_upstream_health_check_failures_total" + p.metricLabels(t)).Inc()
+	}
+
+	t.health.mu.Lock()
+	changed := t.health.down == healthy
+	t.health.down = !healthy
+	t.health.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	if healthy {
+		p.app.Log().Info("proxy upstream is healthy", zap.String("upstream.address", t.url.String()))
+
+		return
+	}
+
+	fields := []zap.Field{zap.String("upstream.address", t.url.String())}
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	} else {
+		fields = append(fields, zap.Int("status", resp.StatusCode()))
+	}
+
+	p.app.Log().Warn("proxy upstream is unhealthy", fields...)
+}
@@ -0,0 +1,127 @@
+package azugo
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"azugo.io/core/http"
+	"github.com/go-quicktest/qt"
+	"github.com/valyala/fasthttp"
+)
+
+func TestProxyOutlierDetection(t *testing.T) {
+	failing := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+	})
+	working := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString("ok")
+	})
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Proxy("/api", ProxyUpstream(failing, working), ProxyOutlierDetection{Failures: 2, EjectionTime: time.Minute})
+
+	statuses := make(map[int]int)
+
+	for range 10 {
+		resp, err := a.TestClient().Get("/api/test")
+		qt.Assert(t, qt.IsNil(err))
+		statuses[resp.StatusCode()]++
+		fasthttp.ReleaseResponse(resp)
+	}
+
+	// Failing upstream is ejected after two failures
+	qt.Check(t, qt.Equals(statuses[http.StatusInternalServerError], 2))
+	qt.Check(t, qt.Equals(statuses[http.StatusOK], 8))
+}
+
+func TestProxyHealthCheck(t *testing.T) {
+	unhealthy := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		if string(ctx.Path()) == "/healthz" {
+			ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+
+			return
+		}
+
+		ctx.SetBodyString("unhealthy")
+	})
+	healthy := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString("healthy")
+	})
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Proxy("/api", ProxyUpstream(unhealthy, healthy), ProxyHealthCheck{Path: "/healthz", Interval: 10 * time.Millisecond})
+
+	time.Sleep(100 * time.Millisecond)
+
+	for range 4 {
+		resp, err := a.TestClient().Get("/api/test")
+		qt.Assert(t, qt.IsNil(err))
+		qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+		qt.Check(t, qt.Equals(string(resp.Body()), "healthy"))
+		fasthttp.ReleaseResponse(resp)
+	}
+}
+
+func TestProxyHealthCheckRestart(t *testing.T) {
+	var checks atomic.Int32
+
+	upstream := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		if string(ctx.Path()) == "/healthz" {
+			checks.Add(1)
+		}
+	})
+
+	a := NewTestApp()
+	a.Proxy("/api", ProxyUpstream(upstream), ProxyHealthCheck{Path: "/healthz", Interval: 10 * time.Millisecond})
+
+	time.Sleep(50 * time.Millisecond)
+
+	// Health checks are not run before the application is started
+	qt.Check(t, qt.Equals(checks.Load(), int32(0)))
+
+	waitChecks := func() {
+		start := checks.Load()
+
+		for deadline := time.Now().Add(5 * time.Second); checks.Load() == start && time.Now().Before(deadline); {
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		qt.Check(t, qt.IsTrue(checks.Load() > start))
+	}
+
+	a.Start(t)
+	waitChecks()
+	a.Stop()
+
+	// Health checks are run again after the application is restarted
+	a.Start(t)
+	defer a.Stop()
+
+	waitChecks()
+}
+
+func TestProxyNoHealthyUpstream(t *testing.T) {
+	unhealthy := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+	})
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Proxy("/api", ProxyUpstream(unhealthy), ProxyHealthCheck{Interval: 10 * time.Millisecond})
+
+	time.Sleep(100 * time.Millisecond)
+
+	resp, err := a.TestClient().Get("/api/test")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusServiceUnavailable))
+}
@@ -0,0 +1,120 @@
+package azugo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+)
+
+var upstreamDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 15, 20, 30, 40, 50, 60}
+
+// Upstream request error categories used as metric label values.
+const (
+	upstreamErrorConnect = "connect"
+	upstreamErrorTimeout = "timeout"
+	upstreamErrorTLS     = "tls"
+	upstreamError5xx     = "5xx"
+	upstreamErrorOther   = "other"
+)
+
+// registerUpstreamMetrics registers metrics of the upstream that are collected on scrape.
+func (p *Proxy) registerUpstreamMetrics(t *ProxyTarget) {
+	metrics.GetOrCreateGauge("proxy_upstream_in_flight"+p.metricLabels(t), func() float64 {
+		return float64(t.Outstanding())
+	})
+
+	p.registerHealthMetrics(t)
+}
+
+// unregisterUpstreamMetrics unregisters all metrics of the upstream that has been removed.
+func (p *Proxy) unregisterUpstreamMetrics(t *ProxyTarget) {
+	labels := p.metricLabels(t)
+
+	for _, name := range []string{
+		"proxy_upstream_in_flight",
+		"proxy_upstream_healthy",
+		"proxy_upstream_requests_total",
+		"proxy_upstream_request_duration_seconds",
+		"proxy_upstream_retries_total",
+		"proxy_upstream_ejections_total",
+		"proxy_upstream_health_check_failures_total",
+	} {
+		metrics.UnregisterMetric(name + labels)
+	}
+
+	for _, category := range []string{
+		upstreamErrorConnect, upstreamErrorTimeout, upstreamErrorTLS, upstreamError5xx, upstreamErrorOther,
+	} {
+		metrics.UnregisterMetric(p.errorMetricName(t, category))
+	}
+}
+
+// observe records the result of a single request to the upstream.
+func (p *Proxy) observe(t *ProxyTarget, start time.Time, err error, resp *fasthttp.Response) {
+	labels := p.metricLabels(t)
+
+	metrics.GetOrCreateCounter("proxy_upstream_requests_total" + labels).Inc()
+	metrics.GetOrCreatePrometheusHistogramExt("proxy_upstream_request_duration_seconds"+labels, upstreamDurationBuckets).
+		Update(time.Since(start).Seconds())
+
+	var category string
+
+	switch {
+	case err != nil:
+		category = upstreamErrorCategory(err)
+	case resp.StatusCode() >= fasthttp.StatusInternalServerError:
+		category = upstreamError5xx
+	default:
+		return
+	}
+
+	metrics.GetOrCreateCounter(p.errorMetricName(t, category)).Inc()
+}
+
+func (p *Proxy) errorMetricName(t *ProxyTarget, category string) string {
+	return fmt.Sprintf("proxy_upstream_errors_total{proxy=%q,upstream=%q,type=%q}", p.options.Name, t.url.String(), category)
+}
+
+// upstreamErrorCategory returns the category of the upstream request error.
+func upstreamErrorCategory(err error) string {
+	var (
+		netErr     net.Error
+		opErr      *net.OpError
+		recordErr  tls.RecordHeaderError
+		alertErr   tls.AlertError
+		verifyErr  *tls.CertificateVerificationError
+		unknownErr x509.UnknownAuthorityError
+		hostErr    x509.HostnameError
+		invalidErr x509.CertificateInvalidError
+	)
+
+	switch {
+	case errors.Is(err, fasthttp.ErrTimeout), errors.Is(err, fasthttp.ErrDialTimeout),
+		errors.Is(err, os.ErrDeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return upstreamErrorTimeout
+	case errors.As(err, &recordErr), errors.As(err, &alertErr), errors.As(err, &verifyErr),
+		errors.As(err, &unknownErr), errors.As(err, &hostErr), errors.As(err, &invalidErr):
+		return upstreamErrorTLS
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return upstreamErrorConnect
+	default:
+		return upstreamErrorOther
+	}
+}
+
+// logUpstream adds the upstream that handled the request and the time spent
+// waiting for its response to the request log.
+func (p *Proxy) logUpstream(ctx *Context, t *ProxyTarget, start time.Time) {
+	_ = ctx.AddLogFields(
+		zap.String("upstream.address", t.url.String()),
+		zap.Int64("upstream.duration", time.Since(start).Nanoseconds()),
+	)
+}
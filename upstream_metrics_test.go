@@ -0,0 +1,127 @@
+package azugo
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"azugo.io/core/http"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/go-quicktest/qt"
+	"github.com/valyala/fasthttp"
+)
+
+func upstreamErrors(proxy string, u *url.URL, category string) uint64 {
+	return metrics.GetOrCreateCounter(fmt.Sprintf("proxy_upstream_errors_total{proxy=%q,upstream=%q,type=%q}", proxy, u.String(), category)).Get()
+}
+
+func TestProxyUpstreamMetrics(t *testing.T) {
+	u := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		switch string(ctx.Path()) {
+		case "/fail":
+			ctx.SetStatusCode(http.StatusInternalServerError)
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		}
+	})
+
+	// Closed port to fail connecting
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	qt.Assert(t, qt.IsNil(err))
+
+	closed := &url.URL{Scheme: "http", Host: ln.Addr().String()}
+	_ = ln.Close()
+
+	ca := newTestCert(t, nil, "ca")
+	untrusted := testTLSUpstream(t, ca, func(_ *fasthttp.RequestCtx) {})
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Proxy("/metrics-ok", ProxyUpstream(u), ProxyResponseModifier(func(ctx *Context, _ *fasthttp.Response) error {
+		ctx.Log().Info("proxied")
+
+		return nil
+	}))
+	a.Proxy("/metrics-slow", ProxyUpstream(u), ProxyRetry{Attempts: 1, TryTimeout: 50 * time.Millisecond})
+	a.Proxy("/metrics-closed", ProxyUpstream(closed))
+	a.Proxy("/metrics-tls", ProxyUpstream(untrusted))
+
+	tests := []struct {
+		path, proxy string
+		upstream    *url.URL
+		status      int
+		category    string
+	}{
+		{"/metrics-ok/fail", "/metrics-ok", u, http.StatusInternalServerError, upstreamError5xx},
+		{"/metrics-slow/slow", "/metrics-slow", u, http.StatusBadGateway, upstreamErrorTimeout},
+		{"/metrics-closed/test", "/metrics-closed", closed, http.StatusBadGateway, upstreamErrorConnect},
+		{"/metrics-tls/test", "/metrics-tls", untrusted, http.StatusBadGateway, upstreamErrorTLS},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := a.TestClient().Get(tt.path)
+			defer fasthttp.ReleaseResponse(resp)
+			qt.Assert(t, qt.IsNil(err))
+			qt.Check(t, qt.Equals(resp.StatusCode(), tt.status))
+			qt.Check(t, qt.Equals(upstreamErrors(tt.proxy, tt.upstream, tt.category), 1))
+		})
+	}
+
+	labels := fmt.Sprintf("{proxy=%q,upstream=%q}", "/metrics-ok", u.String())
+	qt.Check(t, qt.Equals(metrics.GetOrCreateCounter("proxy_upstream_requests_total"+labels).Get(), 1))
+	qt.Check(t, qt.Equals(metrics.GetOrCreateGauge("proxy_upstream_in_flight"+labels, nil).Get(), 0))
+
+	entries := a.logs.FilterMessage("proxied").All()
+	qt.Assert(t, qt.HasLen(entries, 1))
+
+	fields := entries[0].ContextMap()
+	qt.Check(t, qt.Equals(fields["upstream.address"], any(u.String())))
+
+	d, ok := fields["upstream.duration"].(int64)
+	qt.Assert(t, qt.IsTrue(ok))
+	qt.Check(t, qt.IsTrue(d > 0))
+}
+
+func TestProxyUpstreamMetricsUnregister(t *testing.T) {
+	u1 := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(http.StatusInternalServerError)
+	})
+	u2 := testNamedUpstream(t, "two")
+
+	r := NewProxyStaticResolver(ProxyEndpoint{URL: u1, Weight: 1})
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Proxy("/metrics-removed", ProxyUpstreamDiscovery(r), ProxyRetry{Attempts: 2, StatusCodes: []int{http.StatusInternalServerError}})
+
+	resp, err := a.TestClient().Get("/metrics-removed/test")
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusInternalServerError))
+	fasthttp.ReleaseResponse(resp)
+
+	upstreamMetrics := func(u *url.URL) []string {
+		var names []string
+
+		for _, name := range metrics.ListMetricNames() {
+			if strings.HasPrefix(name, "proxy_upstream_") && strings.Contains(name, fmt.Sprintf("upstream=%q", u.String())) {
+				names = append(names, name)
+			}
+		}
+
+		return names
+	}
+
+	qt.Check(t, qt.Not(qt.HasLen(upstreamMetrics(u1), 0)))
+
+	r.SetUpstreams(ProxyEndpoint{URL: u2, Weight: 1})
+
+	qt.Check(t, qt.HasLen(upstreamMetrics(u1), 0))
+}
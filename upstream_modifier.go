@@ -0,0 +1,204 @@
+package azugo
+
+import (
+	"net"
+	"strings"
+
+	"azugo.io/core/http"
+	"github.com/valyala/fasthttp"
+)
+
+const headerXForwardedPrefix = "X-Forwarded-Prefix"
+
+// ProxyRequestModifier is a function that modifies the request sent to the upstream.
+//
+// Modifiers are called in the order they were added after hop-by-hop and forwarding
+// headers are processed. If modifier returns an error request is not sent to the
+// upstream and error is returned to the client.
+type ProxyRequestModifier func(ctx *Context, req *fasthttp.Request) error
+
+func (m ProxyRequestModifier) apply(opts *proxyOptions) {
+	opts.RequestModifiers = append(opts.RequestModifiers, m)
+}
+
+// ProxyResponseModifier is a function that modifies the response received from the upstream.
+//
+// Modifiers are called in the order they were added after hop-by-hop headers are
+// removed and cookies are rewritten but before the response body is rewritten.
+// Response body is streamed from the upstream, reading or replacing it buffers
+// the whole body in memory. If modifier returns an error it is returned to the
+// client instead of the upstream response.
+type ProxyResponseModifier func(ctx *Context, resp *fasthttp.Response) error
+
+func (m ProxyResponseModifier) apply(opts *proxyOptions) {
+	opts.ResponseModifiers = append(opts.ResponseModifiers, m)
+}
+
+// ProxyRequestHeaderSet sets the request header sent to the upstream.
+func ProxyRequestHeaderSet(key, value string) ProxyRequestModifier {
+	return func(_ *Context, req *fasthttp.Request) error {
+		req.Header.Set(key, value)
+
+		return nil
+	}
+}
+
+// ProxyRequestHeaderAdd adds the request header value sent to the upstream
+// keeping existing values of the header.
+func ProxyRequestHeaderAdd(key, value string) ProxyRequestModifier {
+	return func(_ *Context, req *fasthttp.Request) error {
+		req.Header.Add(key, value)
+
+		return nil
+	}
+}
+
+// ProxyRequestHeaderRemove removes the request headers before request is sent to the upstream.
+func ProxyRequestHeaderRemove(keys ...string) ProxyRequestModifier {
+	return func(_ *Context, req *fasthttp.Request) error {
+		for _, key := range keys {
+			req.Header.Del(key)
+		}
+
+		return nil
+	}
+}
+
+// ProxyResponseHeaderSet sets the response header returned to the client.
+func ProxyResponseHeaderSet(key, value string) ProxyResponseModifier {
+	return func(_ *Context, resp *fasthttp.Response) error {
+		resp.Header.Set(key, value)
+
+		return nil
+	}
+}
+
+// ProxyResponseHeaderAdd adds the response header value returned to the client
+// keeping existing values of the header.
+func ProxyResponseHeaderAdd(key, value string) ProxyResponseModifier {
+	return func(_ *Context, resp *fasthttp.Response) error {
+		resp.Header.Add(key, value)
+
+		return nil
+	}
+}
+
+// ProxyResponseHeaderRemove removes the upstream response headers before response is returned to the client.
+func ProxyResponseHeaderRemove(keys ...string) ProxyResponseModifier {
+	return func(_ *Context, resp *fasthttp.Response) error {
+		for _, key := range keys {
+			resp.Header.Del(key)
+		}
+
+		return nil
+	}
+}
+
+// ProxyUpstreamHost sets the Host header sent to the upstream. By default
+// host of the upstream URL is used.
+type ProxyUpstreamHost string
+
+func (o ProxyUpstreamHost) apply(opts *proxyOptions) {
+	opts.Host = string(o)
+}
+
+// ProxyForwarded sets how forwarding headers Forwarded, X-Forwarded-For,
+// X-Forwarded-Proto, X-Forwarded-Host and X-Forwarded-Prefix are sent to
+// the upstream.
+type ProxyForwarded int
+
+const (
+	// ProxyForwardedAppend appends client address to the forwarding headers if request
+	// comes from the trusted proxy, otherwise forwarding headers are replaced.
+	// This is the default.
+	ProxyForwardedAppend ProxyForwarded = iota
+	// ProxyForwardedReplace always replaces forwarding headers.
+	ProxyForwardedReplace
+	// ProxyForwardedOff sends forwarding headers received from the client unchanged.
+	ProxyForwardedOff
+)
+
+func (o ProxyForwarded) apply(opts *proxyOptions) {
+	opts.Forwarded = o
+}
+
+// setForwardedHeaders sets forwarding headers to the upstream request.
+func (p *Proxy) setForwardedHeaders(ctx *Context, req *fasthttp.Request) {
+	if p.options.Forwarded == ProxyForwardedOff {
+		return
+	}
+
+	appendValues := p.options.Forwarded == ProxyForwardedAppend && ctx.IsTrustedProxy()
+
+	proto := "http"
+	if ctx.IsTLS() {
+		proto = "https"
+	}
+
+	host := ctx.Host()
+
+	var addr string
+	if ip := ctx.IP(); ip != nil {
+		addr = ip.String()
+	}
+
+	// RFC 7239 forwarded element
+	var elem strings.Builder
+
+	if len(addr) > 0 {
+		elem.WriteString("for=")
+		elem.WriteString(forwardedNode(ctx.IP()))
+		elem.WriteByte(';')
+	}
+
+	elem.WriteString("host=")
+	elem.WriteString(forwardedValue(host))
+	elem.WriteString(";proto=")
+	elem.WriteString(proto)
+
+	forwarded := elem.String()
+	if prev := req.Header.Peek(fasthttp.HeaderForwarded); appendValues && len(prev) > 0 {
+		forwarded = string(prev) + ", " + forwarded
+	}
+
+	req.Header.Set(fasthttp.HeaderForwarded, forwarded)
+
+	if prev := req.Header.Peek(http.HeaderXForwardedFor); appendValues && len(prev) > 0 && len(addr) > 0 {
+		addr = string(prev) + ", " + addr
+	}
+
+	if len(addr) > 0 {
+		req.Header.Set(http.HeaderXForwardedFor, addr)
+	} else if !appendValues {
+		req.Header.Del(http.HeaderXForwardedFor)
+	}
+
+	req.Header.Set(http.HeaderXForwardedProto, proto)
+	req.Header.Set(http.HeaderXForwardedHost, host)
+
+	if prefix := ctx.BasePath() + p.prefix(ctx); len(prefix) > 0 {
+		req.Header.Set(headerXForwardedPrefix, prefix)
+	} else {
+		req.Header.Del(headerXForwardedPrefix)
+	}
+}
+
+// forwardedNode formats IP address as RFC 7239 node identifier.
+func forwardedNode(ip net.IP) string {
+	if ip.To4() == nil {
+		return `"[` + ip.String() + `]"`
+	}
+
+	return ip.String()
+}
+
+// forwardedValue quotes RFC 7239 parameter value if it is not a valid token.
+func forwardedValue(v string) string {
+	for _, c := range v {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && !strings.ContainsRune("!#$%&'*+-.^_`|~", c) {
+			return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+		}
+	}
+
+	return v
+}
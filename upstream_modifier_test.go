@@ -0,0 +1,125 @@
+package azugo
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"azugo.io/core/http"
+	"github.com/go-quicktest/qt"
+	"github.com/valyala/fasthttp"
+)
+
+func TestProxyForwardedHeaders(t *testing.T) {
+	u := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.Response.Header.SetBytesV("X-Seen-Forwarded", ctx.Request.Header.Peek(fasthttp.HeaderForwarded))
+		ctx.Response.Header.SetBytesV("X-Seen-For", ctx.Request.Header.Peek(http.HeaderXForwardedFor))
+		ctx.Response.Header.SetBytesV("X-Seen-Proto", ctx.Request.Header.Peek(http.HeaderXForwardedProto))
+		ctx.Response.Header.SetBytesV("X-Seen-Host", ctx.Request.Header.Peek(http.HeaderXForwardedHost))
+		ctx.Response.Header.SetBytesV("X-Seen-Prefix", ctx.Request.Header.Peek("X-Forwarded-Prefix"))
+	})
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Proxy("/api", ProxyUpstream(u))
+	a.Proxy("/replace", ProxyUpstream(u), ProxyForwardedReplace)
+
+	c := a.TestClient()
+
+	resp, err := c.Get("/api/test", c.WithHeader(http.HeaderXForwardedFor, "10.0.0.1"), c.WithHeader(fasthttp.HeaderForwarded, "for=10.0.0.1"))
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	// Test client connection has no IP address so only existing value is kept
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("X-Seen-For")), "10.0.0.1"))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("X-Seen-Forwarded")), "for=10.0.0.1, host=test;proto=http"))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("X-Seen-Proto")), "http"))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("X-Seen-Host")), "test"))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("X-Seen-Prefix")), "/api"))
+
+	resp, err = c.Get("/replace/test", c.WithHeader(http.HeaderXForwardedFor, "10.0.0.1"))
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("X-Seen-For")), ""))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("X-Seen-Prefix")), "/replace"))
+}
+
+func TestProxyModifiers(t *testing.T) {
+	u := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.Response.Header.SetBytesV("X-Seen-Host", ctx.Request.Header.Host())
+		ctx.Response.Header.SetBytesV("X-Seen-Tenant", ctx.Request.Header.Peek("X-Tenant"))
+		ctx.Response.Header.SetBytesV("X-Seen-Secret", ctx.Request.Header.Peek("X-Secret"))
+		ctx.Response.Header.Set("X-Internal", "yes")
+
+		if string(ctx.Path()) == "/stream" {
+			ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+				_, _ = w.WriteString(strings.Repeat("stream", 4096))
+			})
+
+			return
+		}
+
+		ctx.SetBodyString("ok")
+	})
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Proxy("/api",
+		ProxyUpstream(u),
+		ProxyUpstreamHost("internal.example.com"),
+		ProxyRequestHeaderSet("X-Tenant", "acme"),
+		ProxyRequestHeaderRemove("X-Secret"),
+		ProxyResponseHeaderRemove("X-Internal"),
+		ProxyResponseHeaderSet("X-Proxy", "azugo"),
+		ProxyRequestModifier(func(ctx *Context, _ *fasthttp.Request) error {
+			if ctx.Header.Get("X-Block") != "" {
+				return BadRequestError{Description: "blocked"}
+			}
+
+			return nil
+		}),
+		ProxyResponseModifier(func(_ *Context, resp *fasthttp.Response) error {
+			resp.SetBodyString(strings.ToUpper(string(resp.Body())))
+
+			return nil
+		}),
+	)
+
+	c := a.TestClient()
+
+	resp, err := c.Get("/api/test", c.WithHeader("X-Secret", "value"))
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("X-Seen-Host")), "internal.example.com"))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("X-Seen-Tenant")), "acme"))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("X-Seen-Secret")), ""))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("X-Internal")), ""))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("X-Proxy")), "azugo"))
+	qt.Check(t, qt.Equals(string(resp.Body()), "OK"))
+
+	resp, err = c.Get("/api/stream")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+	qt.Check(t, qt.Equals(string(resp.Body()), strings.Repeat("STREAM", 4096)))
+
+	resp, err = c.Get("/api/test", c.WithHeader("X-Block", "1"))
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusBadRequest))
+}
+
+func TestForwardedNode(t *testing.T) {
+	qt.Check(t, qt.Equals(forwardedNode(net.ParseIP("192.0.2.43")), "192.0.2.43"))
+	qt.Check(t, qt.Equals(forwardedNode(net.ParseIP("2001:db8:cafe::17")), `"[2001:db8:cafe::17]"`))
+}
+
+func TestForwardedValue(t *testing.T) {
+	qt.Check(t, qt.Equals(forwardedValue("example.com"), "example.com"))
+	qt.Check(t, qt.Equals(forwardedValue("example.com:8080"), `"example.com:8080"`))
+}
@@ -0,0 +1,241 @@
+package azugo
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"azugo.io/azugo/internal/utils"
+)
+
+// ProxyKeepPrefix keeps the proxy mount path in the path sent to the upstream.
+// By default mount path is removed from the request path.
+type ProxyKeepPrefix bool
+
+func (o ProxyKeepPrefix) apply(opts *proxyOptions) {
+	opts.KeepPrefix = bool(o)
+}
+
+type proxyPathRewrite struct {
+	re          *regexp.Regexp
+	replacement string
+	err         error
+}
+
+func (r *proxyPathRewrite) apply(opts *proxyOptions) {
+	if r.err != nil {
+		opts.Errors = append(opts.Errors, r.err)
+
+		return
+	}
+
+	opts.PathRewrites = append(opts.PathRewrites, r)
+}
+
+// ProxyPathRewrite rewrites the path sent to the upstream if it matches the regular
+// expression pattern. Pattern is matched against the escaped request path relative
+// to the proxy mount path, or the full path if ProxyKeepPrefix is set.
+//
+// Replacement can reference capture groups using $1 or ${name} syntax and route
+// parameters using {name} syntax. Replacement can also contain query string that
+// is merged with the request query string.
+//
+// Rules are evaluated in the order they were added and the first matching rule wins.
+// Invalid pattern is reported when the proxy is registered and the rule is ignored.
+//
+//	app.Proxy("/api/v1/users/{id}",
+//	    azugo.ProxyUpstream(upstream),
+//	    azugo.ProxyPathRewrite(`^(/.*)?$`, "/internal/users$1?id={id}"),
+//	)
+func ProxyPathRewrite(pattern, replacement string) ProxyOption {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return &proxyPathRewrite{err: fmt.Errorf("invalid proxy path rewrite pattern %q: %w", pattern, err)}
+	}
+
+	return &proxyPathRewrite{
+		re:          re,
+		replacement: replacement,
+	}
+}
+
+// expand returns replacement with route parameters replaced by their escaped values.
+func (r *proxyPathRewrite) expand(ctx *Context) string {
+	if !strings.Contains(r.replacement, "{") {
+		return r.replacement
+	}
+
+	var b strings.Builder
+
+	s := r.replacement
+	for {
+		i := strings.IndexByte(s, '{')
+		if i == -1 {
+			break
+		}
+
+		j := strings.IndexByte(s[i:], '}')
+		if j == -1 {
+			break
+		}
+
+		// Capture group reference ${name}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i+j+1])
+			s = s[i+j+1:]
+
+			continue
+		}
+
+		b.WriteString(s[:i])
+		// Escape $ in the value so that it is not expanded as capture group
+		b.WriteString(strings.ReplaceAll(url.PathEscape(ctx.Params.String(s[i+1:i+j])), "$", "$$"))
+		s = s[i+j+1:]
+	}
+
+	b.WriteString(s)
+
+	return b.String()
+}
+
+// splitPath splits the escaped request path without the base path into the proxy mount
+// path and the rest of the path. Mount path is empty if ProxyKeepPrefix is set.
+func (p *Proxy) splitPath(ctx *Context) (string, string) {
+	raw := utils.B2S(ctx.Request().URI().PathOriginal())
+
+	// Remove base path the same way as router does
+	if l := len(ctx.BasePath()); l > 0 && len(raw) >= l && strings.EqualFold(ctx.BasePath(), raw[:l]) {
+		raw = raw[l:]
+	}
+
+	if p.options.KeepPrefix {
+		return "", raw
+	}
+
+	// Mount path can contain route parameters so remove it by the number of path
+	// segments of the matched route excluding the wildcard segment
+	mount := strings.TrimRight(strings.TrimSuffix(ctx.RouterPath(), "{path:*}"), "/")
+
+	path := cleanEscapedPath(raw)
+	rest := trimPathSegments(path, strings.Count(mount, "/"))
+
+	return path[:len(path)-len(rest)], rest
+}
+
+// prefix returns the mount path removed from the request path sent to the upstream.
+func (p *Proxy) prefix(ctx *Context) string {
+	prefix, _ := p.splitPath(ctx)
+
+	return prefix
+}
+
+// upstreamPath returns the path to send to the upstream with optional query string.
+func (p *Proxy) upstreamPath(ctx *Context) string {
+	_, rest := p.splitPath(ctx)
+
+	return p.rewritePath(ctx, cleanEscapedPath(rest))
+}
+
+// rewritePath returns the path rewritten by the first matching path rewrite rule.
+func (p *Proxy) rewritePath(ctx *Context, path string) string {
+	for _, r := range p.options.PathRewrites {
+		if r.re.MatchString(path) {
+			return r.re.ReplaceAllString(path, r.expand(ctx))
+		}
+	}
+
+	return path
+}
+
+// rewriteBaseURL returns the proxy and the upstream base URLs used to rewrite upstream
+// URLs in the response body. If the path is rewritten the trailing path segments kept
+// unchanged by the rewrite are excluded from both so that the rewritten upstream path
+// maps back to the request path.
+func (p *Proxy) rewriteBaseURL(ctx *Context, upstream *ProxyTarget) ([]byte, []byte) {
+	prefix, rest := p.splitPath(ctx)
+	base := ctx.BaseURL() + prefix
+
+	if len(p.options.PathRewrites) == 0 {
+		return []byte(base), upstream.baseURL
+	}
+
+	rest = cleanEscapedPath(rest)
+
+	path := p.rewritePath(ctx, rest)
+	if i := strings.IndexByte(path, '?'); i != -1 {
+		path = path[:i]
+	}
+
+	for {
+		i, j := strings.LastIndexByte(rest, '/'), strings.LastIndexByte(path, '/')
+		if i == -1 || j == -1 || rest[i:] != path[j:] {
+			break
+		}
+
+		rest, path = rest[:i], path[:j]
+	}
+
+	return []byte(base + rest), append(slices.Clone(upstream.baseURL), path...)
+}
+
+// trimPathSegments removes n leading segments from the path.
+func trimPathSegments(path string, n int) string {
+	for range n {
+		if len(path) == 0 {
+			return ""
+		}
+
+		i := strings.IndexByte(path[1:], '/')
+		if i == -1 {
+			return ""
+		}
+
+		path = path[i+1:]
+	}
+
+	return path
+}
+
+// cleanEscapedPath removes dot segments and repeated slashes from the path and
+// escapes each path segment keeping escaped slashes within segments intact.
+func cleanEscapedPath(path string) string {
+	if len(path) == 0 {
+		return ""
+	}
+
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	clean := make([]string, 0, len(segments))
+
+	for i, s := range segments {
+		v, err := url.PathUnescape(s)
+		if err != nil {
+			v = s
+		}
+
+		switch v {
+		case ".":
+		case "..":
+			if len(clean) > 0 {
+				clean = clean[:len(clean)-1]
+			}
+		case "":
+			// Keep trailing slash
+			if i == len(segments)-1 {
+				clean = append(clean, "")
+			}
+		default:
+			clean = append(clean, url.PathEscape(v))
+
+			continue
+		}
+
+		// Path ending with dot segment is a directory
+		if i == len(segments)-1 && v != "" {
+			clean = append(clean, "")
+		}
+	}
+
+	return "/" + strings.Join(clean, "/")
+}
@@ -0,0 +1,145 @@
+package azugo
+
+import (
+	"bufio"
+	"net/url"
+	"testing"
+
+	"azugo.io/core/http"
+	"github.com/go-quicktest/qt"
+	"github.com/valyala/fasthttp"
+)
+
+func TestCleanEscapedPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"", ""},
+		{"/", "/"},
+		{"/users/1", "/users/1"},
+		{"/users/", "/users/"},
+		{"/files/a%2Fb", "/files/a%2Fb"},
+		{"/files/a%20b", "/files/a%20b"},
+		{"/files/a%3Fb", "/files/a%3Fb"},
+		{"/a//b", "/a/b"},
+		{"/a/./b", "/a/b"},
+		{"/a/../../b", "/b"},
+		{"/a/%2e%2e/b", "/b"},
+		{"/a/..", "/"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			qt.Check(t, qt.Equals(cleanEscapedPath(test.path), test.expected))
+		})
+	}
+}
+
+func TestTrimPathSegments(t *testing.T) {
+	qt.Check(t, qt.Equals(trimPathSegments("/api/users", 0), "/api/users"))
+	qt.Check(t, qt.Equals(trimPathSegments("/api/users", 1), "/users"))
+	qt.Check(t, qt.Equals(trimPathSegments("/api/users", 2), ""))
+	qt.Check(t, qt.Equals(trimPathSegments("/api/users/", 2), "/"))
+	qt.Check(t, qt.Equals(trimPathSegments("/api", 3), ""))
+}
+
+func TestProxyPathRewrite(t *testing.T) {
+	u := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBody(ctx.RequestURI())
+		ctx.Response.Header.SetBytesV("X-Seen-Prefix", ctx.Request.Header.Peek("X-Forwarded-Prefix"))
+	})
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	// Invalid pattern is reported when the proxy is registered
+	opts := &proxyOptions{}
+	ProxyPathRewrite(`(`, "/").apply(opts)
+	qt.Check(t, qt.HasLen(opts.PathRewrites, 0))
+	qt.Assert(t, qt.HasLen(opts.Errors, 1))
+	qt.Check(t, qt.ErrorMatches(opts.Errors[0], `invalid proxy path rewrite pattern "\(": .*`))
+
+	a.Proxy("/api/v1/users/{id}", ProxyUpstream(u), ProxyPathRewrite(`^(/.*)?$`, "/internal/users$1?id={id}"))
+	a.Proxy("/keep", ProxyUpstream(u), ProxyKeepPrefix(true))
+	a.Proxy("/files", ProxyUpstream(u))
+
+	resp, err := a.TestClient().Get("/api/v1/users/42", a.TestClient().WithQuery(map[string]any{"x": 1}))
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+	qt.Check(t, qt.Equals(string(resp.Body()), "/internal/users?id=42&x=1"))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("X-Seen-Prefix")), "/api/v1/users/42"))
+
+	resp, err = a.TestClient().Get("/api/v1/users/42/roles")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(resp.Body()), "/internal/users/roles?id=42"))
+
+	resp, err = a.TestClient().Get("/keep/test")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(resp.Body()), "/keep/test"))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("X-Seen-Prefix")), ""))
+
+	// Test client normalizes the path so send the request as is
+	conn, err := a.ln.Dial()
+	qt.Assert(t, qt.IsNil(err))
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("GET /files/a%2Fb%3Fc HTTP/1.1\r\nHost: test\r\n\r\n"))
+	qt.Assert(t, qt.IsNil(err))
+
+	br := bufio.NewReader(conn)
+
+	var raw fasthttp.Response
+	qt.Assert(t, qt.IsNil(raw.Read(br)))
+	qt.Check(t, qt.Equals(string(raw.Body()), "/a%2Fb%3Fc"))
+
+	_, err = conn.Write([]byte("GET /files/../files//x HTTP/1.1\r\nHost: test\r\n\r\n"))
+	qt.Assert(t, qt.IsNil(err))
+
+	qt.Assert(t, qt.IsNil(raw.Read(br)))
+	qt.Check(t, qt.Equals(string(raw.Body()), "/x"))
+	qt.Check(t, qt.Equals(string(raw.Header.Peek("X-Seen-Prefix")), "/files"))
+}
+
+func TestProxyPathGroup(t *testing.T) {
+	u := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBody(ctx.RequestURI())
+		ctx.Response.Header.SetBytesV("X-Seen-Prefix", ctx.Request.Header.Peek("X-Forwarded-Prefix"))
+	})
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Group("/v1").Group("/tenants/{tenant}").Proxy("/api", ProxyUpstream(u))
+
+	resp, err := a.TestClient().Get("/v1/tenants/acme/api/users")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(resp.Body()), "/users"))
+	qt.Check(t, qt.Equals(string(resp.Header.Peek("X-Seen-Prefix")), "/v1/tenants/acme/api"))
+}
+
+func TestProxyPathRewriteBody(t *testing.T) {
+	var u *url.URL
+
+	u = testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetContentType("text/html; charset=utf-8")
+		ctx.SetBodyString(`<a href="` + u.String() + `/internal/users/roles">roles</a><a href="` + u.String() + `/other">other</a>`)
+	})
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Proxy("/api/v1/users/{id}", ProxyUpstream(u), ProxyPathRewrite(`^(/.*)?$`, "/internal/users$1?id={id}"))
+
+	resp, err := a.TestClient().Get("/api/v1/users/42/roles")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(resp.Body()), `<a href="http://test/api/v1/users/42/roles">roles</a><a href="`+u.String()+`/other">other</a>`))
+}
@@ -0,0 +1,413 @@
+package azugo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.yaml.in/yaml/v3"
+)
+
+// ProxyEndpoint is the upstream server supplied by the upstream resolver.
+type ProxyEndpoint struct {
+	// URL of the upstream server.
+	URL *url.URL
+	// Weight is the relative weight of the upstream server used by the weighted balancers.
+	Weight int
+}
+
+// ProxyUpstreamResolver supplies proxy upstreams dynamically.
+type ProxyUpstreamResolver interface {
+	// Resolve calls update with the current upstream endpoints and again every time
+	// they change until the context is canceled. Update is called with the error if
+	// the upstreams can not be resolved, in that case current upstreams are kept.
+	// Current upstreams are also kept if no endpoints are resolved.
+	Resolve(ctx context.Context, update func(endpoints []ProxyEndpoint, err error))
+}
+
+type proxyResolverOption struct {
+	resolver ProxyUpstreamResolver
+}
+
+func (o proxyResolverOption) apply(opts *proxyOptions) {
+	opts.Resolver = o.resolver
+}
+
+// ProxyUpstreamDiscovery sets the resolver that supplies the proxy upstreams. Resolved
+// upstreams replace the upstreams added with ProxyUpstream when they are resolved.
+func ProxyUpstreamDiscovery(resolver ProxyUpstreamResolver) ProxyOption {
+	return proxyResolverOption{resolver}
+}
+
+// Upstreams returns the current proxy upstreams.
+func (p *Proxy) Upstreams() []*ProxyTarget {
+	return *p.upstreams.Load()
+}
+
+// resolve applies upstreams supplied by the resolver until the context is done.
+func (p *Proxy) resolve(ctx context.Context) {
+	p.options.Resolver.Resolve(ctx, func(endpoints []ProxyEndpoint, err error) {
+		if err != nil {
+			p.app.Log().Warn("failed to resolve proxy upstreams", zap.String("proxy", p.options.Name), zap.Error(err))
+
+			return
+		}
+
+		// Empty result is most likely a temporary failure of the service discovery
+		if len(endpoints) == 0 {
+			p.app.Log().Warn("no proxy upstreams resolved, keeping current upstreams", zap.String("proxy", p.options.Name))
+
+			return
+		}
+
+		p.setUpstreams(endpoints)
+	})
+}
+
+// setUpstreams atomically replaces the current upstreams. Upstreams with the same URL and weight
+// are kept so that their health state is preserved. Requests in flight to removed upstreams
+// are completed.
+func (p *Proxy) setUpstreams(endpoints []ProxyEndpoint) {
+	p.upstreamsMu.Lock()
+	defer p.upstreamsMu.Unlock()
+
+	current := make(map[string]*ProxyTarget)
+	for _, t := range p.Upstreams() {
+		current[t.url.String()] = t
+	}
+
+	next := make([]*ProxyTarget, 0, len(endpoints))
+	added := make([]*ProxyTarget, 0, len(endpoints))
+
+	for _, e := range endpoints {
+		key := e.URL.String()
+		if t, ok := current[key]; ok && t.weight == max(e.Weight, 0) {
+			delete(current, key)
+
+			next = append(next, t)
+
+			continue
+		}
+
+		t := newProxyTarget(e.URL, max(e.Weight, 0))
+		next = append(next, t)
+		added = append(added, t)
+	}
+
+	if len(added) == 0 && len(current) == 0 {
+		return
+	}
+
+	p.upstreams.Store(&next)
+
+	for _, t := range current {
+		p.unregisterUpstreamMetrics(t)
+	}
+
+	for _, t := range added {
+		p.registerUpstreamMetrics(t)
+
+		// Check health of the new upstream right away
+		if p.options.HealthCheck != nil {
+			p.app.runTaskOnce(func(context.Context) {
+				p.checkHealth(t)
+			})
+		}
+	}
+
+	p.app.Log().Info("proxy upstreams updated", zap.String("proxy", p.options.Name),
+		zap.Int("upstream.added", len(added)), zap.Int("upstream.removed", len(current)), zap.Int("upstream.count", len(next)))
+}
+
+// ProxyStaticResolver supplies the upstreams that are set programmatically.
+type ProxyStaticResolver struct {
+	mu        sync.Mutex
+	endpoints []ProxyEndpoint
+	updates   []*func(endpoints []ProxyEndpoint, err error)
+}
+
+// NewProxyStaticResolver returns upstream resolver with the initial upstreams.
+func NewProxyStaticResolver(endpoints ...ProxyEndpoint) *ProxyStaticResolver {
+	return &ProxyStaticResolver{
+		endpoints: endpoints,
+	}
+}
+
+// SetUpstreams replaces the upstreams of all proxies using the resolver.
+func (r *ProxyStaticResolver) SetUpstreams(endpoints ...ProxyEndpoint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.endpoints = slices.Clone(endpoints)
+
+	for _, update := range r.updates {
+		(*update)(r.endpoints, nil)
+	}
+}
+
+// Resolve implements ProxyUpstreamResolver.
+func (r *ProxyStaticResolver) Resolve(ctx context.Context, update func(endpoints []ProxyEndpoint, err error)) {
+	r.mu.Lock()
+	r.updates = append(r.updates, &update)
+	update(r.endpoints, nil)
+	r.mu.Unlock()
+
+	<-ctx.Done()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.updates = slices.DeleteFunc(r.updates, func(u *func([]ProxyEndpoint, error)) bool {
+		return u == &update
+	})
+}
+
+// ProxyFileResolver supplies the upstreams listed in the JSON or YAML file. The file
+// is checked for changes periodically.
+//
+// File contains a list of upstream URLs or objects with url and weight keys, ex.:
+//
+//	["http://10.0.0.1:8080", {"url": "http://10.0.0.2:8080", "weight": 2}]
+type ProxyFileResolver struct {
+	// Path to the file.
+	Path string
+	// Interval between checks for file changes. Defaults to 5 seconds.
+	Interval time.Duration
+}
+
+// Resolve implements ProxyUpstreamResolver.
+func (r ProxyFileResolver) Resolve(ctx context.Context, update func(endpoints []ProxyEndpoint, err error)) {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var (
+		size    int64 = -1
+		modTime int64
+	)
+
+	for {
+		fi, err := os.Stat(r.Path)
+		if err != nil {
+			// Report only once until the file is available again
+			if size != -2 {
+				update(nil, err)
+			}
+
+			size = -2
+		} else if fi.Size() != size || fi.ModTime().UnixNano() != modTime {
+			endpoints, err := r.read()
+			if err == nil {
+				size, modTime = fi.Size(), fi.ModTime().UnixNano()
+			}
+
+			update(endpoints, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r ProxyFileResolver) read() ([]ProxyEndpoint, error) {
+	data, err := os.ReadFile(r.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// YAML is a superset of JSON
+	var list []yaml.Node
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&list); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid upstream list in %s: %w", r.Path, err)
+	}
+
+	endpoints := make([]ProxyEndpoint, 0, len(list))
+
+	for _, n := range list {
+		var item struct {
+			URL    string `yaml:"url"`
+			Weight *int   `yaml:"weight"`
+		}
+
+		if n.Kind == yaml.ScalarNode {
+			err = n.Decode(&item.URL)
+		} else {
+			err = n.Decode(&item)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid upstream in %s at line %d: %w", r.Path, n.Line, err)
+		}
+
+		u, err := url.Parse(item.URL)
+		if err != nil || len(u.Scheme) == 0 || len(u.Host) == 0 {
+			return nil, fmt.Errorf("invalid upstream URL %q in %s at line %d", item.URL, r.Path, n.Line)
+		}
+
+		weight := 1
+		if item.Weight != nil {
+			weight = *item.Weight
+		}
+
+		endpoints = append(endpoints, ProxyEndpoint{URL: u, Weight: weight})
+	}
+
+	return endpoints, nil
+}
+
+// defaultResolverTTL is the time resolved DNS records are cached for.
+const defaultResolverTTL = 30 * time.Second
+
+// ProxyDNSResolver supplies the upstreams from the DNS A and AAAA records of the host.
+//
+// Go resolver does not expose the TTL of the DNS records so records are resolved
+// again after the configured TTL.
+type ProxyDNSResolver struct {
+	// Scheme of the upstream URLs. Defaults to "http".
+	Scheme string
+	// Host name to resolve.
+	Host string
+	// Port of the upstreams.
+	Port int
+	// TTL is the time resolved records are used for. Defaults to 30 seconds.
+	TTL time.Duration
+	// Resolver to use. Defaults to net.DefaultResolver.
+	Resolver *net.Resolver
+}
+
+// Resolve implements ProxyUpstreamResolver.
+func (r ProxyDNSResolver) Resolve(ctx context.Context, update func(endpoints []ProxyEndpoint, err error)) {
+	pollDNS(ctx, r.TTL, update, func(ctx context.Context) ([]ProxyEndpoint, error) {
+		addrs, err := dnsResolver(r.Resolver).LookupIPAddr(ctx, r.Host)
+		if err != nil {
+			return nil, err
+		}
+
+		endpoints := make([]ProxyEndpoint, 0, len(addrs))
+		for _, addr := range addrs {
+			endpoints = append(endpoints, ProxyEndpoint{
+				URL:    &url.URL{Scheme: dnsScheme(r.Scheme), Host: net.JoinHostPort(addr.String(), strconv.Itoa(r.Port))},
+				Weight: 1,
+			})
+		}
+
+		return endpoints, nil
+	})
+}
+
+// ProxySRVResolver supplies the upstreams from the DNS SRV records. Only records with the
+// lowest priority are used and record weights are used as upstream weights.
+//
+// Go resolver does not expose the TTL of the DNS records so records are resolved
+// again after the configured TTL.
+type ProxySRVResolver struct {
+	// Scheme of the upstream URLs. Defaults to "http".
+	Scheme string
+	// Service and Proto to look up, ex. "http" and "tcp". If both are empty,
+	// Name is looked up directly.
+	Service, Proto string
+	// Name is the domain name of the SRV records.
+	Name string
+	// TTL is the time resolved records are used for. Defaults to 30 seconds.
+	TTL time.Duration
+	// Resolver to use. Defaults to net.DefaultResolver.
+	Resolver *net.Resolver
+}
+
+// Resolve implements ProxyUpstreamResolver.
+func (r ProxySRVResolver) Resolve(ctx context.Context, update func(endpoints []ProxyEndpoint, err error)) {
+	pollDNS(ctx, r.TTL, update, func(ctx context.Context) ([]ProxyEndpoint, error) {
+		_, records, err := dnsResolver(r.Resolver).LookupSRV(ctx, r.Service, r.Proto, r.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		endpoints := make([]ProxyEndpoint, 0, len(records))
+		for _, rec := range records {
+			// Records are sorted by priority
+			if rec.Priority != records[0].Priority {
+				break
+			}
+
+			endpoints = append(endpoints, ProxyEndpoint{
+				URL:    &url.URL{Scheme: dnsScheme(r.Scheme), Host: net.JoinHostPort(strings.TrimSuffix(rec.Target, "."), strconv.Itoa(int(rec.Port)))},
+				Weight: int(rec.Weight),
+			})
+		}
+
+		// Zero weights mean that there is no preference
+		if !slices.ContainsFunc(endpoints, func(e ProxyEndpoint) bool { return e.Weight > 0 }) {
+			for i := range endpoints {
+				endpoints[i].Weight = 1
+			}
+		}
+
+		return endpoints, nil
+	})
+}
+
+func dnsResolver(r *net.Resolver) *net.Resolver {
+	if r == nil {
+		return net.DefaultResolver
+	}
+
+	return r
+}
+
+func dnsScheme(scheme string) string {
+	if len(scheme) == 0 {
+		return "http"
+	}
+
+	return scheme
+}
+
+// pollDNS resolves the upstreams every TTL until the context is done.
+func pollDNS(ctx context.Context, ttl time.Duration, update func([]ProxyEndpoint, error), lookup func(ctx context.Context) ([]ProxyEndpoint, error)) {
+	if ttl <= 0 {
+		ttl = defaultResolverTTL
+	}
+
+	ticker := time.NewTicker(ttl)
+	defer ticker.Stop()
+
+	for {
+		endpoints, err := lookup(ctx)
+		if err == nil {
+			// Resolver might return addresses in random order
+			slices.SortFunc(endpoints, func(a, b ProxyEndpoint) int {
+				return strings.Compare(a.URL.Host, b.URL.Host)
+			})
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		update(endpoints, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
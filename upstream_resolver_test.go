@@ -0,0 +1,187 @@
+package azugo
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-quicktest/qt"
+	"github.com/valyala/fasthttp"
+)
+
+func proxyBody(t *testing.T, a *TestApp, path string) string {
+	t.Helper()
+
+	resp, err := a.TestClient().Get(path)
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+
+	return string(resp.Body())
+}
+
+func waitProxyBody(t *testing.T, a *TestApp, path, expected string) {
+	t.Helper()
+
+	body := proxyBody(t, a, path)
+	for deadline := time.Now().Add(5 * time.Second); body != expected && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+
+		body = proxyBody(t, a, path)
+	}
+
+	qt.Check(t, qt.Equals(body, expected))
+}
+
+func testNamedUpstream(t *testing.T, name string) *url.URL {
+	t.Helper()
+
+	return testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString(name)
+	})
+}
+
+func TestProxyStaticResolver(t *testing.T) {
+	u1 := testNamedUpstream(t, "one")
+	u2 := testNamedUpstream(t, "two")
+
+	r := NewProxyStaticResolver(ProxyEndpoint{URL: u1, Weight: 1})
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Proxy("/api", ProxyUpstreamDiscovery(r))
+
+	waitProxyBody(t, a, "/api/test", "one")
+
+	r.SetUpstreams(ProxyEndpoint{URL: u2, Weight: 1})
+
+	qt.Check(t, qt.Equals(proxyBody(t, a, "/api/test"), "two"))
+
+	upstreams := a.ProxyUpstreams()["/api"]
+	qt.Assert(t, qt.HasLen(upstreams, 1))
+	qt.Check(t, qt.Equals(upstreams[0].URL().String(), u2.String()))
+
+	// Empty result keeps current upstreams
+	r.SetUpstreams()
+
+	qt.Check(t, qt.HasLen(a.ProxyUpstreams()["/api"], 1))
+	qt.Check(t, qt.Equals(proxyBody(t, a, "/api/test"), "two"))
+}
+
+func TestProxySetUpstreamsKeepsTargets(t *testing.T) {
+	u1 := &url.URL{Scheme: "http", Host: "upstream1"}
+	u2 := &url.URL{Scheme: "http", Host: "upstream2"}
+
+	a := NewTestApp()
+
+	p := a.defaultMux.newUpstreamProxy("/api", ProxyUpstream(u1))
+	t1 := p.Upstreams()[0]
+
+	p.setUpstreams([]ProxyEndpoint{{URL: u1, Weight: 1}, {URL: u2, Weight: 1}})
+
+	upstreams := p.Upstreams()
+	qt.Assert(t, qt.HasLen(upstreams, 2))
+	qt.Check(t, qt.Equals(upstreams[0], t1))
+
+	// Weight change replaces the upstream
+	p.setUpstreams([]ProxyEndpoint{{URL: u1, Weight: 2}})
+
+	upstreams = p.Upstreams()
+	qt.Assert(t, qt.HasLen(upstreams, 1))
+	qt.Check(t, qt.Not(qt.Equals(upstreams[0], t1)))
+	qt.Check(t, qt.Equals(upstreams[0].Weight(), 2))
+}
+
+// writeFileAtomic replaces the file so that the resolver never reads partially written content.
+func writeFileAtomic(t *testing.T, file, content string) {
+	t.Helper()
+
+	tmp := file + ".tmp"
+	qt.Assert(t, qt.IsNil(os.WriteFile(tmp, []byte(content), 0o600)))
+	qt.Assert(t, qt.IsNil(os.Rename(tmp, file)))
+}
+
+func TestProxyFileResolver(t *testing.T) {
+	u1 := testNamedUpstream(t, "one")
+	u2 := testNamedUpstream(t, "two")
+
+	file := filepath.Join(t.TempDir(), "upstreams.yaml")
+	qt.Assert(t, qt.IsNil(os.WriteFile(file, []byte("- "+u1.String()+"\n"), 0o600)))
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Proxy("/api", ProxyUpstreamDiscovery(ProxyFileResolver{Path: file, Interval: 10 * time.Millisecond}))
+
+	waitProxyBody(t, a, "/api/test", "one")
+
+	// JSON is accepted as well
+	writeFileAtomic(t, file, `[{"url": "`+u2.String()+`", "weight": 3}]`)
+
+	waitProxyBody(t, a, "/api/test", "two")
+
+	upstreams := a.ProxyUpstreams()["/api"]
+	qt.Assert(t, qt.HasLen(upstreams, 1))
+	qt.Check(t, qt.Equals(upstreams[0].Weight(), 3))
+
+	// Invalid file keeps current upstreams
+	writeFileAtomic(t, file, "- not an url\n")
+	time.Sleep(50 * time.Millisecond)
+
+	qt.Check(t, qt.Equals(proxyBody(t, a, "/api/test"), "two"))
+
+	// Empty file keeps current upstreams
+	writeFileAtomic(t, file, "[]")
+	time.Sleep(50 * time.Millisecond)
+
+	qt.Check(t, qt.Equals(proxyBody(t, a, "/api/test"), "two"))
+}
+
+func TestProxyFileResolverInvalid(t *testing.T) {
+	tests := []struct {
+		name, content string
+	}{
+		{"not a list", "url: http://upstream"},
+		{"no scheme", "- upstream:8080"},
+		{"invalid weight", "- url: http://upstream\n  weight: heavy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "upstreams.yaml")
+			qt.Assert(t, qt.IsNil(os.WriteFile(file, []byte(tt.content), 0o600)))
+
+			_, err := ProxyFileResolver{Path: file}.read()
+			qt.Check(t, qt.IsNotNil(err))
+		})
+	}
+}
+
+func TestProxyDNSResolver(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	var endpoints []ProxyEndpoint
+
+	ProxyDNSResolver{Host: "localhost", Port: 8080}.Resolve(ctx, func(e []ProxyEndpoint, err error) {
+		qt.Assert(t, qt.IsNil(err))
+
+		endpoints = e
+
+		cancel()
+	})
+
+	hosts := make([]string, 0, len(endpoints))
+	for _, e := range endpoints {
+		qt.Check(t, qt.Equals(e.URL.Scheme, "http"))
+		hosts = append(hosts, e.URL.Host)
+	}
+
+	qt.Check(t, qt.IsTrue(slices.Contains(hosts, "127.0.0.1:8080")), qt.Commentf("hosts: %v", hosts))
+}
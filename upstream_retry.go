@@ -0,0 +1,244 @@
+package azugo
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+)
+
+// ProxyRetry enables retrying failed proxy requests on the next upstream.
+//
+// Requests are retried on connection errors, timeouts and on the listed
+// response status codes. Only requests with idempotent methods are retried
+// unless NonIdempotent is set for the proxy route. Request body is buffered
+// to allow retrying the request only if it is not larger than MaxBodySize,
+// otherwise body is streamed to the upstream and request is not retried.
+// With a single attempt only the timeouts are applied and request body is
+// always streamed.
+type ProxyRetry struct {
+	// Attempts is the maximum number of attempts including the first one. Defaults to 3.
+	Attempts int
+	// StatusCodes lists response status codes that are retried, ex. 502, 503 and 504.
+	StatusCodes []int
+	// NonIdempotent allows retrying requests with non-idempotent methods, ex. POST and PATCH.
+	NonIdempotent bool
+	// TryTimeout is the timeout of a single attempt. As response body is streamed
+	// to the client, timeout also limits the time to receive the response body.
+	// No timeout is set by default.
+	TryTimeout time.Duration
+	// Timeout is the overall deadline for all attempts. Deadline of the request context
+	// is always honored. No additional deadline is set by default.
+	Timeout time.Duration
+	// Budget is the number of retries earned by every request, ex. 0.2 allows
+	// retrying 20% of requests. Defaults to 0.2.
+	Budget float64
+	// BudgetBurst is the maximum number of retries that can be made when
+	// the earned budget is exhausted. Defaults to 10.
+	BudgetBurst int
+	// MaxBodySize is the maximum size of request body buffered to allow retrying
+	// the request. Defaults to 1 MiB.
+	MaxBodySize int
+}
+
+func (o ProxyRetry) apply(opts *proxyOptions) {
+	if o.Attempts <= 0 {
+		o.Attempts = 3
+	}
+
+	if o.Budget <= 0 {
+		o.Budget = 0.2
+	}
+
+	if o.BudgetBurst <= 0 {
+		o.BudgetBurst = 10
+	}
+
+	if o.MaxBodySize <= 0 {
+		o.MaxBodySize = 1 << 20
+	}
+
+	opts.Retry = &o
+}
+
+// methodRetryable reports whether requests with the method can be retried.
+func (o *ProxyRetry) methodRetryable(method []byte) bool {
+	return o.NonIdempotent || isIdempotentMethod(method)
+}
+
+func (o *ProxyRetry) retryable(err error, resp *fasthttp.Response) bool {
+	if err != nil {
+		return true
+	}
+
+	return slices.Contains(o.StatusCodes, resp.StatusCode())
+}
+
+// retryBudget limits retries to a fraction of requests so that retries can not
+// overload the already failing upstreams.
+type retryBudget struct {
+	mu     sync.Mutex
+	tokens float64
+	ratio  float64
+	burst  float64
+}
+
+func newRetryBudget(ratio float64, burst int) *retryBudget {
+	return &retryBudget{
+		tokens: float64(burst),
+		ratio:  ratio,
+		burst:  float64(burst),
+	}
+}
+
+// deposit earns retry budget for the request.
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	b.tokens = min(b.tokens+b.ratio, b.burst)
+	b.mu.Unlock()
+}
+
+// withdraw reports whether retry is allowed by the budget.
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+
+	return true
+}
+
+func isIdempotentMethod(method []byte) bool {
+	switch string(method) {
+	case fasthttp.MethodGet, fasthttp.MethodHead, fasthttp.MethodOptions, fasthttp.MethodTrace,
+		fasthttp.MethodPut, fasthttp.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// bufferBody reports whether streamed request body must be read to memory
+// so that the request can be retried.
+func (p *Proxy) bufferBody(req *fasthttp.Request) bool {
+	r := p.options.Retry
+	if r == nil || r.Attempts <= 1 || !r.methodRetryable(req.Header.Method()) {
+		return false
+	}
+
+	n := req.Header.ContentLength()
+
+	return n >= 0 && n <= r.MaxBodySize
+}
+
+// try sends the request to the upstream once.
+func (p *Proxy) try(req *fasthttp.Request, resp *fasthttp.Response, upstream *ProxyTarget, uri []byte, deadline time.Time) error {
+	upstream.outstanding.Add(1)
+	defer upstream.outstanding.Add(-1)
+
+	p.setUpstream(req, upstream, uri)
+
+	start := time.Now()
+
+	var err error
+	if deadline.IsZero() {
+		err = p.client.Do(req, resp)
+	} else {
+		err = p.client.DoDeadline(req, resp, deadline)
+	}
+
+	p.observe(upstream, start, err, resp)
+	p.report(upstream, err == nil && resp.StatusCode() < fasthttp.StatusInternalServerError)
+
+	return err
+}
+
+// do sends the request to the upstream retrying on the next upstream if allowed
+// by the retry policy. Upstream that returned the response is returned.
+func (p *Proxy) do(ctx *Context, req *fasthttp.Request, resp *fasthttp.Response, upstream *ProxyTarget, targets []*ProxyTarget, uri []byte) (*ProxyTarget, error) {
+	r := p.options.Retry
+	if r == nil {
+		return upstream, p.try(req, resp, upstream, uri, time.Time{})
+	}
+
+	// Budget is not used if requests are never retried
+	if p.budget != nil {
+		p.budget.deposit()
+	}
+
+	var deadline time.Time
+	if r.Timeout > 0 {
+		deadline = time.Now().Add(r.Timeout)
+	}
+
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+	}
+
+	// Streamed request body can not be sent again
+	retryable := !req.IsBodyStream() && r.methodRetryable(req.Header.Method())
+	labels := fmt.Sprintf("{proxy=%q}", p.options.Name)
+	tried := make([]*ProxyTarget, 0, r.Attempts)
+
+	var (
+		attempt int
+		err     error
+	)
+
+	for {
+		attempt++
+
+		tryDeadline := deadline
+		if r.TryTimeout > 0 {
+			if d := time.Now().Add(r.TryTimeout); tryDeadline.IsZero() || d.Before(tryDeadline) {
+				tryDeadline = d
+			}
+		}
+
+		err = p.try(req, resp, upstream, uri, tryDeadline)
+		tried = append(tried, upstream)
+
+		if !retryable || attempt >= r.Attempts || !r.retryable(err, resp) || ctx.Err() != nil ||
+			(!deadline.IsZero() && !time.Now().Before(deadline)) {
+			break
+		}
+
+		if !p.budget.withdraw() {
+			metrics.GetOrCreateCounter("proxy_retry_budget_exhausted_total" + labels).Inc()
+
+			break
+		}
+
+		// Prefer upstreams that have not been tried yet
+		next := p.options.Balancer.Next(ctx, slices.DeleteFunc(slices.Clone(targets), func(t *ProxyTarget) bool {
+			return slices.Contains(tried, t)
+		}))
+		if next == nil {
+			next = p.options.Balancer.Next(ctx, targets)
+		}
+
+		if next == nil {
+			break
+		}
+
+		metrics.GetOrCreateCounter("proxy_retries_total" + labels).Inc()
+		metrics.GetOrCreateCounter("proxy_upstream_retries_total" + p.metricLabels(upstream)).Inc()
+
+		upstream = next
+
+		resp.Reset()
+	}
+
+	metrics.GetOrCreateHistogram("proxy_request_attempts" + labels).Update(float64(attempt))
+	_ = ctx.AddLogFields(zap.Int("upstream.attempts", attempt))
+
+	return upstream, err
+}
@@ -0,0 +1,128 @@
+package azugo
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"azugo.io/core/http"
+	"github.com/go-quicktest/qt"
+	"github.com/valyala/fasthttp"
+)
+
+func TestProxyRetryNextUpstream(t *testing.T) {
+	failing := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+	})
+	working := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString("ok")
+	})
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Proxy("/api", ProxyUpstream(failing, working), ProxyRetry{StatusCodes: []int{http.StatusServiceUnavailable}})
+
+	for range 4 {
+		resp, err := a.TestClient().Get("/api/test")
+		qt.Assert(t, qt.IsNil(err))
+		qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+		qt.Check(t, qt.Equals(string(resp.Body()), "ok"))
+		fasthttp.ReleaseResponse(resp)
+	}
+}
+
+func TestProxyRetryNonIdempotent(t *testing.T) {
+	var hits atomic.Int32
+
+	failing := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		hits.Add(1)
+		ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+	})
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Proxy("/api", ProxyUpstream(failing), ProxyRetry{StatusCodes: []int{http.StatusServiceUnavailable}})
+	a.Proxy("/optin", ProxyUpstream(failing), ProxyRetry{StatusCodes: []int{http.StatusServiceUnavailable}, NonIdempotent: true})
+
+	resp, err := a.TestClient().Post("/api/test", []byte("body"))
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusServiceUnavailable))
+	qt.Check(t, qt.Equals(hits.Swap(0), int32(1)))
+
+	resp, err = a.TestClient().Post("/optin/test", []byte("body"))
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusServiceUnavailable))
+	qt.Check(t, qt.Equals(hits.Load(), int32(3)))
+}
+
+func TestProxyRetryTryTimeout(t *testing.T) {
+	slow := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		time.Sleep(500 * time.Millisecond)
+		ctx.SetBodyString("slow")
+	})
+	fast := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString("fast")
+	})
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Proxy("/api", ProxyUpstream(slow, fast), ProxyRetry{TryTimeout: 50 * time.Millisecond})
+
+	resp, err := a.TestClient().Get("/api/test")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+	qt.Check(t, qt.Equals(string(resp.Body()), "fast"))
+}
+
+func TestProxyRetryBudget(t *testing.T) {
+	var hits atomic.Int32
+
+	failing := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		hits.Add(1)
+		ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+	})
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Proxy("/api", ProxyUpstream(failing), ProxyRetry{
+		StatusCodes: []int{http.StatusServiceUnavailable},
+		Budget:      0.01,
+		BudgetBurst: 1,
+	})
+
+	resp, err := a.TestClient().Get("/api/test")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusServiceUnavailable))
+	// Only one retry is allowed by the budget
+	qt.Check(t, qt.Equals(hits.Load(), int32(2)))
+}
+
+func TestProxyRetrySingleAttempt(t *testing.T) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	req.Header.SetMethod(fasthttp.MethodPut)
+	req.Header.SetContentLength(10)
+
+	opts := &proxyOptions{}
+	ProxyRetry{Attempts: 1, Timeout: time.Second}.apply(opts)
+
+	// Request body is not buffered when the request is never retried
+	qt.Check(t, qt.IsFalse((&Proxy{options: opts}).bufferBody(req)))
+
+	ProxyRetry{Attempts: 2}.apply(opts)
+
+	qt.Check(t, qt.IsTrue((&Proxy{options: opts}).bufferBody(req)))
+}
@@ -0,0 +1,240 @@
+package azugo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+
+	"azugo.io/core/http"
+	"github.com/go-quicktest/qt"
+	"github.com/valyala/fasthttp"
+)
+
+// testUpstream starts HTTP server to be used as proxy upstream in tests.
+func testUpstream(t *testing.T, handler fasthttp.RequestHandler) *url.URL {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	qt.Assert(t, qt.IsNil(err))
+
+	server := &fasthttp.Server{
+		Handler: handler,
+	}
+
+	go func() {
+		_ = server.Serve(ln)
+	}()
+
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+
+	return &url.URL{Scheme: "http", Host: ln.Addr().String()}
+}
+
+func TestProxy(t *testing.T) {
+	u := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString(string(ctx.Path()) + "?" + string(ctx.QueryArgs().QueryString()))
+	})
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Proxy("/api", ProxyUpstream(u))
+
+	resp, err := a.TestClient().Get("/api/users", a.TestClient().WithQuery(map[string]any{"page": 2}))
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+	qt.Check(t, qt.Equals(string(resp.Body()), "/users?page=2"))
+}
+
+func TestProxyRequestBody(t *testing.T) {
+	u := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBody(ctx.PostBody())
+	})
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Proxy("/api", ProxyUpstream(u))
+
+	for _, size := range []int{10, 1 << 20} {
+		body := bytes.Repeat([]byte("a"), size)
+
+		resp, err := a.TestClient().Post("/api/echo", body)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+		qt.Check(t, qt.Equals(len(resp.Body()), size))
+		fasthttp.ReleaseResponse(resp)
+	}
+}
+
+func TestProxyStreamResponse(t *testing.T) {
+	release := make(chan struct{})
+
+	u := testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetContentType("text/event-stream")
+		ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+			_, _ = w.WriteString("data: first\n\n")
+			_ = w.Flush()
+
+			<-release
+
+			_, _ = w.WriteString("data: second\n\n")
+		})
+	})
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Proxy("/api", ProxyUpstream(u))
+
+	conn, err := a.ln.Dial()
+	qt.Assert(t, qt.IsNil(err))
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("GET /api/events HTTP/1.1\r\nHost: test\r\n\r\n"))
+	qt.Assert(t, qt.IsNil(err))
+
+	br := bufio.NewReader(conn)
+
+	var header fasthttp.ResponseHeader
+	qt.Assert(t, qt.IsNil(header.Read(br)))
+	qt.Check(t, qt.Equals(header.StatusCode(), http.StatusOK))
+
+	// First event is received before upstream finishes the response
+	chunk, err := br.ReadString('\n')
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(chunk, "d\r\n"))
+
+	event, err := br.ReadString('\n')
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(event, "data: first\n"))
+
+	close(release)
+}
+
+func TestProxyUpgrade(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	qt.Assert(t, qt.IsNil(err))
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		br := bufio.NewReader(conn)
+
+		var req fasthttp.Request
+		if err := req.Read(br); err != nil {
+			return
+		}
+
+		if string(req.URI().Path()) != "/socket" || string(req.Header.Peek(http.HeaderKeepAlive)) != "" {
+			_, _ = conn.Write([]byte("HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\n\r\n"))
+
+			return
+		}
+
+		_, _ = conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"))
+
+		_, _ = io.Copy(conn, br)
+	}()
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Proxy("/ws", ProxyUpstream(&url.URL{Scheme: "http", Host: ln.Addr().String()}))
+
+	conn, err := a.ln.Dial()
+	qt.Assert(t, qt.IsNil(err))
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("GET /ws/socket HTTP/1.1\r\nHost: test\r\nConnection: keep-alive, Upgrade\r\nKeep-Alive: timeout=5\r\nUpgrade: websocket\r\n\r\n"))
+	qt.Assert(t, qt.IsNil(err))
+
+	br := bufio.NewReader(conn)
+
+	var header fasthttp.ResponseHeader
+	qt.Assert(t, qt.IsNil(header.Read(br)))
+	qt.Check(t, qt.Equals(header.StatusCode(), fasthttp.StatusSwitchingProtocols))
+
+	_, err = conn.Write([]byte("hello"))
+	qt.Assert(t, qt.IsNil(err))
+
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(br, buf)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(buf), "hello"))
+}
+
+func TestProxyDialUpstreamCanceled(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	qt.Assert(t, qt.IsNil(err))
+	defer ln.Close()
+
+	a := NewTestApp()
+	p := a.defaultMux.newUpstreamProxy("/ws", ProxyUpstream(&url.URL{Scheme: "http", Host: ln.Addr().String()}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = p.dialUpstream(ctx, newProxyTarget(&url.URL{Scheme: "http", Host: ln.Addr().String()}, 1))
+	qt.Check(t, qt.ErrorIs(err, context.Canceled))
+}
+
+func TestProxyBodyRewrite(t *testing.T) {
+	var u *url.URL
+
+	u = testUpstream(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetContentType("text/html; charset=utf-8")
+		ctx.Response.Header.SetContentEncoding("gzip")
+		ctx.SetBody(fasthttp.AppendGzipBytes(nil, []byte(`<a href="`+u.String()+`/page">`+u.String()+`</a>`)))
+	})
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Proxy("/api", ProxyUpstream(u))
+	a.Proxy("/custom", ProxyUpstream(u), ProxyBodyRewrite("text/html", func(dst io.Writer, src io.Reader, rewriteURL func(u []byte) []byte) error {
+		b, err := io.ReadAll(src)
+		if err != nil {
+			return err
+		}
+
+		_, err = dst.Write(bytes.ToUpper(b))
+
+		return err
+	}))
+
+	resp, err := a.TestClient().Get("/api/index.html")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(resp.StatusCode(), http.StatusOK))
+
+	body, err := resp.BodyGunzip()
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(body), `<a href="http://test/api/page">`+u.String()+`</a>`))
+
+	resp, err = a.TestClient().Get("/custom/index.html")
+	defer fasthttp.ReleaseResponse(resp)
+	qt.Assert(t, qt.IsNil(err))
+
+	body, err = resp.BodyGunzip()
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(body), strings.ToUpper(`<a href="`+u.String()+`/page">`+u.String()+`</a>`)))
+}
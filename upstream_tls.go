@@ -0,0 +1,248 @@
+package azugo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"sync"
+)
+
+// ProxyUpstreamRootCA sets the path to PEM file with CA certificates used to verify
+// upstream server certificates instead of the system certificate pool.
+//
+// File is reloaded when it changes on disk.
+type ProxyUpstreamRootCA string
+
+func (o ProxyUpstreamRootCA) apply(opts *proxyOptions) {
+	opts.TLS.RootCAFile = string(o)
+}
+
+type proxyClientCert struct {
+	certFile, keyFile string
+}
+
+func (o proxyClientCert) apply(opts *proxyOptions) {
+	opts.TLS.CertFile = o.certFile
+	opts.TLS.KeyFile = o.keyFile
+}
+
+// ProxyUpstreamClientCert sets the paths to PEM encoded client certificate and private key
+// presented to the upstream servers that require mutual TLS authentication.
+//
+// Files are reloaded when they change on disk.
+func ProxyUpstreamClientCert(certFile, keyFile string) ProxyOption {
+	return proxyClientCert{certFile, keyFile}
+}
+
+// ProxyUpstreamServerName overrides the server name used to verify upstream server
+// certificate and sent in TLS SNI extension. By default host of the upstream URL is used.
+type ProxyUpstreamServerName string
+
+func (o ProxyUpstreamServerName) apply(opts *proxyOptions) {
+	opts.TLS.ServerName = string(o)
+}
+
+// ProxyUpstreamTLSMinVersion sets the minimum TLS version used to connect to the upstream,
+// ex. tls.VersionTLS13. Defaults to TLS 1.2.
+type ProxyUpstreamTLSMinVersion uint16
+
+func (o ProxyUpstreamTLSMinVersion) apply(opts *proxyOptions) {
+	opts.TLS.MinVersion = uint16(o)
+}
+
+type proxyCipherSuites []uint16
+
+func (o proxyCipherSuites) apply(opts *proxyOptions) {
+	opts.TLS.CipherSuites = o
+}
+
+// ProxyUpstreamTLSCipherSuites limits the cipher suites used to connect to the upstream
+// with TLS 1.2 and older. TLS 1.3 cipher suites are not configurable.
+func ProxyUpstreamTLSCipherSuites(suites ...uint16) ProxyOption {
+	return proxyCipherSuites(suites)
+}
+
+// proxyTLSOptions holds TLS settings for upstream connections.
+type proxyTLSOptions struct {
+	InsecureSkipVerify bool
+	RootCAFile         string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	MinVersion         uint16
+	CipherSuites       []uint16
+}
+
+// config returns TLS client configuration for upstream connections. Errors of
+// reloading certificate files are reported to onError.
+func (o *proxyTLSOptions) config(onError func(err error)) (*tls.Config, error) {
+	cfg := &tls.Config{
+		//nolint:gosec
+		InsecureSkipVerify: o.InsecureSkipVerify,
+		ServerName:         o.ServerName,
+		MinVersion:         max(o.MinVersion, tls.VersionTLS12),
+		CipherSuites:       o.CipherSuites,
+	}
+
+	var errs []error
+
+	if len(o.CertFile) > 0 || len(o.KeyFile) > 0 {
+		cert := newTLSFileCache(func() (*tls.Certificate, error) {
+			c, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+			if err != nil {
+				return nil, err
+			}
+
+			return &c, nil
+		}, onError, o.CertFile, o.KeyFile)
+
+		_, err := cert.get()
+		errs = append(errs, err)
+
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cert.get()
+		}
+	}
+
+	if len(o.RootCAFile) > 0 && !o.InsecureSkipVerify {
+		roots := newTLSFileCache(func() (*x509.CertPool, error) {
+			data, err := os.ReadFile(o.RootCAFile)
+			if err != nil {
+				return nil, err
+			}
+
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(data) {
+				return nil, fmt.Errorf("no CA certificates found in %s", o.RootCAFile)
+			}
+
+			return pool, nil
+		}, onError, o.RootCAFile)
+
+		_, err := roots.get()
+		errs = append(errs, err)
+
+		// Certificate is verified against reloadable root CAs instead of the static pool
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			pool, err := roots.get()
+			if err != nil {
+				return err
+			}
+
+			return verifyPeerCertificate(cs, pool)
+		}
+	}
+
+	return cfg, errors.Join(errs...)
+}
+
+// hostTLSConfig returns TLS client configuration for connections to the upstream address.
+// Server name defaults to the upstream host and is also used to verify the server
+// certificate against reloadable root CAs, as IP addresses are not sent in the TLS SNI
+// extension and so are missing from the connection state.
+func hostTLSConfig(cfg *tls.Config, addr string) *tls.Config {
+	c := cfg.Clone()
+
+	if len(c.ServerName) == 0 {
+		c.ServerName = addr
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			c.ServerName = host
+		}
+	}
+
+	if verify := c.VerifyConnection; verify != nil {
+		serverName := c.ServerName
+		c.VerifyConnection = func(cs tls.ConnectionState) error {
+			cs.ServerName = serverName
+
+			return verify(cs)
+		}
+	}
+
+	return c
+}
+
+// verifyPeerCertificate verifies server certificate chain and host name against the given root CAs.
+func verifyPeerCertificate(cs tls.ConnectionState, roots *x509.CertPool) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("tls: upstream did not provide a certificate")
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+
+	for _, c := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+
+	_, err := cs.PeerCertificates[0].Verify(opts)
+
+	return err
+}
+
+// tlsFileCache caches the value loaded from files and reloads it when any of the files change.
+// Previously loaded value is kept if reloading fails.
+type tlsFileCache[T any] struct {
+	mu      sync.Mutex
+	files   []string
+	load    func() (T, error)
+	onError func(err error)
+	stats   []fileStat
+	value   T
+	loaded  bool
+	err     error
+}
+
+type fileStat struct {
+	size    int64
+	modTime int64
+}
+
+func newTLSFileCache[T any](load func() (T, error), onError func(err error), files ...string) *tlsFileCache[T] {
+	return &tlsFileCache[T]{
+		files:   files,
+		load:    load,
+		onError: onError,
+	}
+}
+
+func (c *tlsFileCache[T]) get() (T, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := make([]fileStat, len(c.files))
+	for i, f := range c.files {
+		if st, err := os.Stat(f); err == nil {
+			stats[i] = fileStat{size: st.Size(), modTime: st.ModTime().UnixNano()}
+		}
+	}
+
+	if c.stats == nil || !slices.Equal(stats, c.stats) {
+		first := c.stats == nil
+		c.stats = stats
+
+		v, err := c.load()
+		if err == nil {
+			c.value, c.loaded = v, true
+		} else if !first && c.onError != nil {
+			c.onError(err)
+		}
+
+		c.err = err
+	}
+
+	// Keep using previously loaded value until files are fixed
+	if c.loaded {
+		return c.value, nil
+	}
+
+	return c.value, c.err
+}
@@ -0,0 +1,268 @@
+package azugo
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"azugo.io/core/http"
+	"github.com/go-quicktest/qt"
+	"github.com/valyala/fasthttp"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// newTestCert creates a certificate signed by the parent or self-signed CA certificate if parent is nil.
+func newTestCert(t *testing.T, parent *testCert, cn string) *testCert {
+	t.Helper()
+
+	return newTestCertSAN(t, parent, cn, []net.IP{net.IPv4(127, 0, 0, 1)}, []string{"upstream.local"})
+}
+
+// newTestCertSAN creates a certificate for the given IP addresses and DNS names.
+func newTestCertSAN(t *testing.T, parent *testCert, cn string, ips []net.IP, dnsNames []string) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	qt.Assert(t, qt.IsNil(err))
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  ips,
+		DNSNames:     dnsNames,
+	}
+
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	qt.Assert(t, qt.IsNil(err))
+
+	cert, err := x509.ParseCertificate(der)
+	qt.Assert(t, qt.IsNil(err))
+
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func (c *testCert) tls() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+// writeFiles writes certificate and private key PEM files to the directory.
+func (c *testCert) writeFiles(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+
+	key, err := x509.MarshalECPrivateKey(c.key)
+	qt.Assert(t, qt.IsNil(err))
+
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+
+	qt.Assert(t, qt.IsNil(os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600)))
+	qt.Assert(t, qt.IsNil(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0o600)))
+
+	return certFile, keyFile
+}
+
+// testTLSUpstream starts HTTPS server that requires client certificate signed by the CA.
+func testTLSUpstream(t *testing.T, ca *testCert, handler fasthttp.RequestHandler) *url.URL {
+	t.Helper()
+
+	return testTLSUpstreamCert(t, ca, newTestCert(t, ca, "upstream"), handler)
+}
+
+// testTLSUpstreamCert starts HTTPS server with the certificate that requires client certificate signed by the CA.
+func testTLSUpstreamCert(t *testing.T, ca, cert *testCert, handler fasthttp.RequestHandler) *url.URL {
+	t.Helper()
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	qt.Assert(t, qt.IsNil(err))
+
+	ln = tls.NewListener(ln, &tls.Config{
+		Certificates: []tls.Certificate{cert.tls()},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+		MinVersion:   tls.VersionTLS12,
+	})
+
+	server := &fasthttp.Server{
+		Handler: handler,
+	}
+
+	go func() {
+		_ = server.Serve(ln)
+	}()
+
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+
+	return &url.URL{Scheme: "https", Host: ln.Addr().String()}
+}
+
+func TestProxyUpstreamTLS(t *testing.T) {
+	dir := t.TempDir()
+
+	ca := newTestCert(t, nil, "ca")
+	caFile, _ := ca.writeFiles(t, dir, "ca")
+	certFile, keyFile := newTestCert(t, ca, "client").writeFiles(t, dir, "client")
+
+	u := testTLSUpstream(t, ca, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString(ctx.TLSConnectionState().PeerCertificates[0].Subject.CommonName)
+	})
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Proxy("/untrusted", ProxyUpstream(u), ProxyUpstreamClientCert(certFile, keyFile))
+	a.Proxy("/nocert", ProxyUpstream(u), ProxyUpstreamRootCA(caFile))
+	a.Proxy("/mtls", ProxyUpstream(u), ProxyUpstreamRootCA(caFile), ProxyUpstreamClientCert(certFile, keyFile))
+	a.Proxy("/insecure", ProxyUpstream(u), ProxyUpstreamInsecureSkipVerify(true), ProxyUpstreamClientCert(certFile, keyFile))
+	a.Proxy("/servername", ProxyUpstream(u), ProxyUpstreamRootCA(caFile), ProxyUpstreamClientCert(certFile, keyFile),
+		ProxyUpstreamServerName("other.local"))
+	a.Proxy("/tls13", ProxyUpstream(u), ProxyUpstreamRootCA(caFile), ProxyUpstreamClientCert(certFile, keyFile),
+		ProxyUpstreamTLSMinVersion(tls.VersionTLS13))
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/untrusted/test", http.StatusBadGateway},
+		{"/nocert/test", http.StatusBadGateway},
+		{"/mtls/test", http.StatusOK},
+		{"/insecure/test", http.StatusOK},
+		{"/servername/test", http.StatusBadGateway},
+		{"/tls13/test", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := a.TestClient().Get(tt.path)
+			defer fasthttp.ReleaseResponse(resp)
+			qt.Assert(t, qt.IsNil(err))
+			qt.Check(t, qt.Equals(resp.StatusCode(), tt.status))
+
+			if tt.status == http.StatusOK {
+				qt.Check(t, qt.Equals(string(resp.Body()), "client"))
+			}
+		})
+	}
+}
+
+func TestProxyUpstreamTLSIPAddress(t *testing.T) {
+	dir := t.TempDir()
+
+	ca := newTestCert(t, nil, "ca")
+	caFile, _ := ca.writeFiles(t, dir, "ca")
+	certFile, keyFile := newTestCert(t, ca, "client").writeFiles(t, dir, "client")
+
+	handler := func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString("ok")
+	}
+
+	// Certificate is issued for other IP address than the upstream is dialed at
+	wrong := testTLSUpstreamCert(t, ca, newTestCertSAN(t, ca, "upstream", []net.IP{net.IPv4(127, 0, 0, 2)}, []string{"upstream.local"}), handler)
+	valid := testTLSUpstream(t, ca, handler)
+
+	a := NewTestApp()
+	a.Start(t)
+	defer a.Stop()
+
+	a.Proxy("/wrong", ProxyUpstream(wrong), ProxyUpstreamRootCA(caFile), ProxyUpstreamClientCert(certFile, keyFile))
+	a.Proxy("/valid", ProxyUpstream(valid), ProxyUpstreamRootCA(caFile), ProxyUpstreamClientCert(certFile, keyFile))
+	a.Proxy("/servername", ProxyUpstream(wrong), ProxyUpstreamRootCA(caFile), ProxyUpstreamClientCert(certFile, keyFile),
+		ProxyUpstreamServerName("upstream.local"))
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/wrong/test", http.StatusBadGateway},
+		{"/valid/test", http.StatusOK},
+		{"/servername/test", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := a.TestClient().Get(tt.path)
+			defer fasthttp.ReleaseResponse(resp)
+			qt.Assert(t, qt.IsNil(err))
+			qt.Check(t, qt.Equals(resp.StatusCode(), tt.status))
+		})
+	}
+}
+
+func TestTLSFileCacheReload(t *testing.T) {
+	dir := t.TempDir()
+
+	ca := newTestCert(t, nil, "ca")
+	certFile, keyFile := newTestCert(t, ca, "first").writeFiles(t, dir, "client")
+
+	var reloadErr error
+
+	cache := newTLSFileCache(func() (*tls.Certificate, error) {
+		c, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		return &c, nil
+	}, func(err error) {
+		reloadErr = err
+	}, certFile, keyFile)
+
+	commonName := func() string {
+		c, err := cache.get()
+		qt.Assert(t, qt.IsNil(err))
+
+		cert, err := x509.ParseCertificate(c.Certificate[0])
+		qt.Assert(t, qt.IsNil(err))
+
+		return cert.Subject.CommonName
+	}
+
+	qt.Check(t, qt.Equals(commonName(), "first"))
+
+	// Rotate certificate
+	newTestCert(t, ca, "second").writeFiles(t, dir, "client")
+	touch := time.Now().Add(time.Minute)
+	qt.Assert(t, qt.IsNil(os.Chtimes(certFile, touch, touch)))
+
+	qt.Check(t, qt.Equals(commonName(), "second"))
+	qt.Check(t, qt.IsNil(reloadErr))
+
+	// Broken certificate keeps the previous one
+	qt.Assert(t, qt.IsNil(os.WriteFile(certFile, []byte("invalid"), 0o600)))
+
+	qt.Check(t, qt.Equals(commonName(), "second"))
+	qt.Check(t, qt.IsNotNil(reloadErr))
+}
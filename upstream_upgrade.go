@@ -0,0 +1,113 @@
+package azugo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+
+	"github.com/valyala/fasthttp"
+)
+
+// dialUpstream opens a new connection to the upstream server.
+func (p *Proxy) dialUpstream(ctx context.Context, upstream *ProxyTarget) (net.Conn, error) {
+	secure := bytes.Equal(upstream.scheme, []byte("https"))
+
+	addr := string(upstream.host)
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		if secure {
+			addr = net.JoinHostPort(addr, "443")
+		} else {
+			addr = net.JoinHostPort(addr, "80")
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: fasthttp.DefaultDialTimeout}
+
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if !secure {
+		return conn, nil
+	}
+
+	tlsConn := tls.Client(conn, hostTLSConfig(p.client.TLSConfig, addr))
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
+
+// upgrade forwards the protocol upgrade request, ex. WebSocket, to the upstream server.
+//
+// If the upstream switches protocols the client connection is hijacked and data is
+// tunneled between the client and the upstream until either side closes the connection.
+// Otherwise the upstream response is read into resp and false is returned.
+func (p *Proxy) upgrade(ctx *Context, upstream *ProxyTarget, req *fasthttp.Request, resp *fasthttp.Response) (bool, error) {
+	// Context is returned to the pool when the handler returns, watch the underlying request context instead
+	conn, err := p.dialUpstream(ctx.effectiveContext(), upstream)
+	if err != nil {
+		return false, err
+	}
+
+	bw := bufio.NewWriter(conn)
+	if err = req.Write(bw); err == nil {
+		err = bw.Flush()
+	}
+
+	if err != nil {
+		_ = conn.Close()
+
+		return false, err
+	}
+
+	br := bufio.NewReader(conn)
+
+	if err := resp.Header.Read(br); err != nil {
+		_ = conn.Close()
+
+		return false, err
+	}
+
+	if resp.StatusCode() != fasthttp.StatusSwitchingProtocols {
+		err := resp.ReadBody(br, 0)
+		_ = conn.Close()
+
+		return false, err
+	}
+
+	resp.Header.CopyTo(&ctx.Response().Header)
+
+	ctx.Context().Hijack(func(c net.Conn) {
+		defer conn.Close()
+
+		tunnel(c, conn, br)
+	})
+
+	return true, nil
+}
+
+// tunnel copies data between the client and the upstream connections until
+// either side closes the connection.
+func tunnel(client, upstream net.Conn, upstreamReader io.Reader) {
+	done := make(chan struct{}, 2)
+
+	go func() {
+		_, _ = io.Copy(upstream, client)
+		done <- struct{}{}
+	}()
+
+	go func() {
+		_, _ = io.Copy(client, upstreamReader)
+		done <- struct{}{}
+	}()
+
+	<-done
+}